@@ -9,6 +9,7 @@ import (
 
 const (
 	Mongod                ProcessType = "mongod"
+	Mongos                ProcessType = "mongos"
 	DefaultMongoDBDataDir string      = "/data"
 	DefaultAgentLogPath   string      = "/var/log/mongodb-mms-automation"
 )
@@ -21,6 +22,20 @@ type AutomationConfig struct {
 	TLS         TLS                    `json:"tls"`
 	Versions    []MongoDbVersionConfig `json:"mongoDbVersions"`
 	Options     Options                `json:"options"`
+	// AgentSettings are the operational settings of the automation agent
+	AgentSettings *AgentSettings `json:"agentSettings,omitempty"`
+	// AgentVersion pins the version of the automation agent
+	AgentVersion *AgentVersion `json:"agentVersion,omitempty"`
+	// Annotations is metadata about what produced the config, e.g. the generation of the resource. It is
+	// ignored when deciding if the config changed.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// withoutAnnotations returns a copy of the AutomationConfig without its annotations, which are not part of
+// its content.
+func (ac AutomationConfig) withoutAnnotations() AutomationConfig {
+	ac.Annotations = nil
+	return ac
 }
 
 type Process struct {
@@ -33,6 +48,17 @@ type Process struct {
 	AuthSchemaVersion           int         `json:"authSchemaVersion"`
 	SystemLog                   SystemLog   `json:"systemLog"`
 	WiredTiger                  WiredTiger  `json:"wiredTiger"`
+	// DefaultRWConcern is the cluster-wide default read and write concern, supported from MongoDB 4.4
+	DefaultRWConcern *DefaultRWConcern `json:"defaultRWConcern,omitempty"`
+	// AgentStartupArgs are the flags the automation agent managing the process is launched with
+	AgentStartupArgs map[string]interface{} `json:"agentStartupArgs,omitempty"`
+	// Cluster is a label grouping the processes of a logical cluster, e.g. in monitoring. The agent ignores it.
+	Cluster string `json:"cluster,omitempty"`
+	// CPUAffinity is a hint of the CPUs the process should run on, e.g. "0-3,8", for deployments where NUMA
+	// locality matters. The agent ignores it, it's up to the controller to translate it into resource settings.
+	CPUAffinity string `json:"cpuAffinity,omitempty"`
+	// Disabled processes are shut down by the agent, which keeps their data, see Builder.BuildScaledToZero
+	Disabled bool `json:"disabled,omitempty"`
 }
 
 func newProcess(name, hostName, version, replSetName string, opts ...func(process *Process)) Process {
@@ -71,8 +97,60 @@ const (
 	TLSModeRequired  TLSMode = "requireTLS"
 )
 
+// SSLMode is the equivalent of TLSMode for MongoDB versions older than 4.2,
+// which configure TLS through the net.ssl options.
+type SSLMode string
+
+const (
+	SSLModeDisabled  SSLMode = "disabled"
+	SSLModeAllowed   SSLMode = "allowSSL"
+	SSLModePreferred SSLMode = "preferSSL"
+	SSLModeRequired  SSLMode = "requireSSL"
+)
+
+// SSLMode returns the net.ssl.mode equivalent of the TLSMode.
+func (m TLSMode) SSLMode() SSLMode {
+	switch m {
+	case TLSModeAllowed:
+		return SSLModeAllowed
+	case TLSModePreferred:
+		return SSLModePreferred
+	case TLSModeRequired:
+		return SSLModeRequired
+	default:
+		return SSLModeDisabled
+	}
+}
+
 type ProcessType string
 
+var readPreferences = []string{"primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest"}
+
+func isValidReadPreference(pref string) bool {
+	for _, p := range readPreferences {
+		if p == pref {
+			return true
+		}
+	}
+	return false
+}
+
+type ClusterRole string
+
+const (
+	ClusterRoleConfigServer ClusterRole = "configsvr"
+	ClusterRoleShardServer  ClusterRole = "shardsvr"
+)
+
+type ClusterAuthMode string
+
+const (
+	ClusterAuthModeKeyFile     ClusterAuthMode = "keyFile"
+	ClusterAuthModeSendKeyFile ClusterAuthMode = "sendKeyFile"
+	ClusterAuthModeSendX509    ClusterAuthMode = "sendX509"
+	ClusterAuthModeX509        ClusterAuthMode = "x509"
+)
+
 type SystemLog struct {
 	Destination string `json:"destination"`
 	Path        string `json:"path"`
@@ -86,10 +164,59 @@ type EngineConfig struct {
 	CacheSizeGB float32 `json:"cacheSizeGB"`
 }
 
+type DefaultRWConcern struct {
+	DefaultReadConcern  *ReadConcern  `json:"defaultReadConcern,omitempty"`
+	DefaultWriteConcern *WriteConcern `json:"defaultWriteConcern,omitempty"`
+}
+
+type ReadConcern struct {
+	Level string `json:"level"`
+}
+
+type WriteConcern struct {
+	// W is either the number of members, "majority" or a custom write concern name
+	W        interface{} `json:"w,omitempty"`
+	J        *bool       `json:"j,omitempty"`
+	WTimeout int         `json:"wtimeout,omitempty"`
+}
+
 type ReplicaSet struct {
 	Id              string             `json:"_id"`
 	Members         []ReplicaSetMember `json:"members"`
 	ProtocolVersion string             `json:"protocolVersion"`
+	// WriteConcernMajorityJournalDefault determines if majority write concerns wait for the write to be journaled
+	WriteConcernMajorityJournalDefault *bool `json:"writeConcernMajorityJournalDefault,omitempty"`
+	// ConfigServer indicates that the replica set is the config server replica set of a sharded cluster
+	ConfigServer bool `json:"configsvr,omitempty"`
+	// Settings configure how the members replicate and elect a primary
+	Settings *ReplicaSetSettings `json:"settings,omitempty"`
+	// Force makes the agent reconfigure the replica set even if a majority of the members are unavailable
+	Force *ReplicaSetForceConfig `json:"force,omitempty"`
+}
+
+// ReplicaSetForceConfig requests a forced reconfig of the replica set.
+type ReplicaSetForceConfig struct {
+	// CurrentVersion is the version of the replica set config to replace, -1 replaces any version
+	CurrentVersion int64 `json:"currentVersion"`
+}
+
+// ReplicaSetSettings holds the replica set configuration settings. Unset fields use the MongoDB defaults.
+type ReplicaSetSettings struct {
+	ChainingAllowed       *bool `json:"chainingAllowed,omitempty"`
+	ElectionTimeoutMillis *int  `json:"electionTimeoutMillis,omitempty"`
+	HeartbeatTimeoutSecs  *int  `json:"heartbeatTimeoutSecs,omitempty"`
+	// HeartbeatIntervalMillis is how often the members send heartbeats to each other, 2000 by default
+	HeartbeatIntervalMillis *int `json:"heartbeatIntervalMillis,omitempty"`
+	// CatchUpTimeoutMillis is how long a new primary waits to catch up with the other members, -1 means forever
+	CatchUpTimeoutMillis *int `json:"catchUpTimeoutMillis,omitempty"`
+	// CatchUpTakeoverDelayMillis is how long a more up-to-date secondary waits before taking over from a
+	// primary which is catching up, -1 disables the takeover
+	CatchUpTakeoverDelayMillis *int `json:"catchUpTakeoverDelayMillis,omitempty"`
+	// GetLastErrorModes are named write concerns, mapping member tags to the number of distinct values
+	// of the tag which must acknowledge a write, e.g. {"multiRegion": {"region": 2}}
+	GetLastErrorModes map[string]map[string]int `json:"getLastErrorModes,omitempty"`
+	// ReplicaSetId is generated by MongoDB when the replica set is initiated, it never changes afterwards
+	ReplicaSetId string `json:"replicaSetId,omitempty"`
 }
 
 type ReplicaSetMember struct {
@@ -99,6 +226,20 @@ type ReplicaSetMember struct {
 	ArbiterOnly bool               `json:"arbiterOnly"`
 	Votes       int                `json:"votes"`
 	Horizons    ReplicaSetHorizons `json:"horizons,omitempty"`
+	// SlaveDelay is the delay of the member for MongoDB versions older than 5.0
+	SlaveDelay int `json:"slaveDelay,omitempty"`
+	// SecondaryDelaySecs replaces SlaveDelay from MongoDB 5.0
+	SecondaryDelaySecs int `json:"secondaryDelaySecs,omitempty"`
+	// Hidden members are not visible to clients and can't become primary
+	Hidden bool              `json:"hidden,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	// BuildIndexes is true by default, members which don't build indexes must be hidden and have priority 0
+	BuildIndexes *bool `json:"buildIndexes,omitempty"`
+	// NewlyAdded is set by MongoDB on members which are still catching up after being added,
+	// they don't vote until it is cleared
+	NewlyAdded bool `json:"newlyAdded,omitempty"`
+	// ClusterName is the Kubernetes cluster the member runs in, in multi-cluster mode. The agent ignores it.
+	ClusterName string `json:"clusterName,omitempty"`
 }
 
 type ReplicaSetHorizons map[string]string
@@ -189,8 +330,44 @@ type ToolsVersion struct {
 	URLs    map[string]map[string]string `json:"urls"`
 }
 
+// AgentSettings configures how the automation agent operates.
+type AgentSettings struct {
+	// LogLevel is one of DEBUG, INFO, WARN, ERROR or FATAL
+	LogLevel string `json:"logLevel,omitempty"`
+	// MaxRetries is the number of times the agent retries a failed step before giving up
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// HealthCheckIntervalSeconds is how often the agent checks the health of the processes
+	HealthCheckIntervalSeconds int `json:"healthCheckIntervalSeconds,omitempty"`
+	// DialTimeoutSeconds is how long the agent waits to connect to a process before giving up
+	DialTimeoutSeconds int `json:"dialTimeoutSeconds,omitempty"`
+	// ServerTLSCAFilePath is the CA the agents verify the certificate of Ops Manager with, e.g. when sending
+	// monitoring and backup data. It is independent of TLS.CAFilePath, which is the CA of the processes.
+	ServerTLSCAFilePath string `json:"serverTlsCAFilePath,omitempty"`
+}
+
+// ProcessManagementConfig configures how the processes are run, it is written to processManagement.
+type ProcessManagementConfig struct {
+	// Fork runs the process in the background. It must be false when running in a container,
+	// as the container stops when its main process exits.
+	Fork        bool   `json:"fork,omitempty"`
+	PIDFilePath string `json:"pidFilePath,omitempty"`
+}
+
 type Options struct {
 	DownloadBase string `json:"downloadBase"`
+	// UseBarInstaller makes the agent install MongoDB from a tarball instead of a package
+	UseBarInstaller bool `json:"useBarInstaller,omitempty"`
+	// HTTPProxy and HTTPSProxy are the proxies the agent downloads the MongoDB binaries through
+	HTTPProxy  string `json:"httpProxy,omitempty"`
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	// NoProxy is a comma separated list of hosts the agent connects to without a proxy
+	NoProxy string `json:"noProxy,omitempty"`
+	// MultiClusterMode tells the agent the members of the deployment span several Kubernetes clusters
+	MultiClusterMode bool `json:"multiClusterMode,omitempty"`
+}
+
+type AgentVersion struct {
+	Name string `json:"name"`
 }
 
 type VersionManifest struct {
@@ -0,0 +1,64 @@
+package automationconfig
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// agentQuirks are the differences in the fields an automation agent version expects, compared to the latest one.
+type agentQuirks struct {
+	// omitHints omits the fields which the latest agents ignore, as the agents of the level reject them as unknown:
+	// the cluster labels, CPU affinities and member clusters, and the annotations
+	omitHints bool
+	// noMultiClusterMode is true if the agents of the level don't support options.multiClusterMode
+	noMultiClusterMode bool
+}
+
+// agentCompatibilityLevels are the quirks of each agent compatibility level which can be configured with
+// SetAgentCompatibilityLevel, keyed by the major version of the agent.
+var agentCompatibilityLevels = map[string]agentQuirks{
+	"10.x": {omitHints: true, noMultiClusterMode: true},
+	"11.x": {},
+}
+
+// validateAgentCompatibility ensures the level is known, and that the options configured on the Builder are
+// supported by the agents of the level.
+func (b *Builder) validateAgentCompatibility() error {
+	if b.agentCompatibilityLevel == "" {
+		return nil
+	}
+	quirks, ok := agentCompatibilityLevels[b.agentCompatibilityLevel]
+	if !ok {
+		levels := make([]string, 0, len(agentCompatibilityLevels))
+		for level := range agentCompatibilityLevels {
+			levels = append(levels, level)
+		}
+		sort.Strings(levels)
+		return errors.Errorf("unknown agent compatibility level %q, must be one of %s", b.agentCompatibilityLevel, strings.Join(levels, ", "))
+	}
+	if quirks.noMultiClusterMode && b.multiClusterMode {
+		return errors.Errorf("agents of compatibility level %s don't support multi-cluster mode", b.agentCompatibilityLevel)
+	}
+	return nil
+}
+
+// applyAgentCompatibility changes the fields of the AutomationConfig to the ones the agents of the configured
+// compatibility level expect.
+func (b *Builder) applyAgentCompatibility(ac *AutomationConfig) {
+	quirks := agentCompatibilityLevels[b.agentCompatibilityLevel]
+	if !quirks.omitHints {
+		return
+	}
+	for i := range ac.Processes {
+		ac.Processes[i].Cluster = ""
+		ac.Processes[i].CPUAffinity = ""
+	}
+	for i := range ac.ReplicaSets {
+		for j := range ac.ReplicaSets[i].Members {
+			ac.ReplicaSets[i].Members[j].ClusterName = ""
+		}
+	}
+	ac.Annotations = nil
+}
@@ -0,0 +1,61 @@
+package automationconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentCompatibilityLevel(t *testing.T) {
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			SetProcessCluster("my-cluster").
+			SetProcessCPUAffinity(0, "0-3").
+			SetGoalStateAnnotations(map[string]string{"generation": "1"})
+	}
+
+	t.Run("The hints are emitted for the latest agents", func(t *testing.T) {
+		for _, level := range []string{"", "11.x"} {
+			ac, err := newBuilder().SetAgentCompatibilityLevel(level).Build()
+			assert.NoError(t, err, level)
+			assert.Equal(t, "my-cluster", ac.Processes[0].Cluster, level)
+			assert.Equal(t, "0-3", ac.Processes[0].CPUAffinity, level)
+			assert.Equal(t, map[string]string{"generation": "1"}, ac.Annotations, level)
+		}
+	})
+
+	t.Run("The hints are omitted for 10.x agents", func(t *testing.T) {
+		ac, err := newBuilder().SetAgentCompatibilityLevel("10.x").Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Empty(t, p.Cluster)
+			assert.Empty(t, p.CPUAffinity)
+		}
+		assert.Nil(t, ac.Annotations)
+	})
+
+	t.Run("Changing the level alone doesn't increase the version", func(t *testing.T) {
+		previous, err := newBuilder().Build()
+		assert.NoError(t, err)
+
+		result, err := newBuilder().SetAgentCompatibilityLevel("10.x").SetPreviousAutomationConfig(previous).BuildWithResult()
+		assert.NoError(t, err)
+		assert.False(t, result.Changed)
+	})
+
+	t.Run("Unsupported options are rejected", func(t *testing.T) {
+		_, err := newBuilder().
+			SetAgentCompatibilityLevel("10.x").
+			SetMultiClusterMode(true).
+			SetMemberCluster(0, "cluster-a").
+			SetMemberCluster(1, "cluster-a").
+			SetMemberCluster(2, "cluster-b").
+			Build()
+		assert.EqualError(t, err, "agents of compatibility level 10.x don't support multi-cluster mode")
+	})
+
+	t.Run("Unknown levels are rejected", func(t *testing.T) {
+		_, err := newBuilder().SetAgentCompatibilityLevel("9.x").Build()
+		assert.EqualError(t, err, `unknown agent compatibility level "9.x", must be one of 10.x, 11.x`)
+	})
+}
@@ -0,0 +1,62 @@
+package automationconfig
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The assertions check properties of a built AutomationConfig, so that tests don't have to index deeply into
+// it. They return nil if the property holds, and an error describing what was found otherwise.
+
+// AssertHasProcess checks that the AutomationConfig has a process with the given name.
+func (ac AutomationConfig) AssertHasProcess(name string) error {
+	names := make([]string, 0, len(ac.Processes))
+	for _, p := range ac.Processes {
+		if p.Name == name {
+			return nil
+		}
+		names = append(names, p.Name)
+	}
+	return errors.Errorf("expected a process named %s, but the processes are [%s]", name, strings.Join(names, ", "))
+}
+
+// AssertTLSEnabled checks that every process has TLS enabled, in any mode other than disabled.
+func (ac AutomationConfig) AssertTLSEnabled() error {
+	if len(ac.Processes) == 0 {
+		return errors.Errorf("expected TLS to be enabled, but there are no processes")
+	}
+	for _, p := range ac.Processes {
+		if tlsModeOrDisabled(p) == TLSModeDisabled {
+			return errors.Errorf("expected TLS to be enabled, but it is disabled for process %s", p.Name)
+		}
+	}
+	return nil
+}
+
+// AssertMemberCount checks that every replica set has the given number of members, arbiters included.
+func (ac AutomationConfig) AssertMemberCount(n int) error {
+	if len(ac.ReplicaSets) == 0 {
+		return errors.Errorf("expected %d members, but there are no replica sets", n)
+	}
+	for _, rs := range ac.ReplicaSets {
+		if len(rs.Members) != n {
+			return errors.Errorf("expected %d members, but replica set %s has %d", n, rs.Id, len(rs.Members))
+		}
+	}
+	return nil
+}
+
+// AssertAuthMechanism checks that authentication is enabled and that clients can authenticate with the given
+// mechanism, e.g. SCRAM-SHA-256.
+func (ac AutomationConfig) AssertAuthMechanism(mechanism string) error {
+	if ac.Auth.Disabled {
+		return errors.Errorf("expected the %s authentication mechanism, but authentication is disabled", mechanism)
+	}
+	for _, m := range ac.Auth.DeploymentAuthMechanisms {
+		if m == mechanism {
+			return nil
+		}
+	}
+	return errors.Errorf("expected the %s authentication mechanism, but the mechanisms are [%s]", mechanism, strings.Join(ac.Auth.DeploymentAuthMechanisms, ", "))
+}
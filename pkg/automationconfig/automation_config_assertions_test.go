@@ -0,0 +1,41 @@
+package automationconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssertions(t *testing.T) {
+	plain, err := newTestBuilder("4.4.0").Build()
+	assert.NoError(t, err)
+	secured, err := newTestBuilder("4.4.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		SetSCRAMAgentCredentials("my-password", "my-keyfile").
+		EnableSCRAM().
+		Build()
+	assert.NoError(t, err)
+
+	t.Run("AssertHasProcess", func(t *testing.T) {
+		assert.NoError(t, plain.AssertHasProcess("my-rs-2"))
+		assert.EqualError(t, plain.AssertHasProcess("my-rs-3"), "expected a process named my-rs-3, but the processes are [my-rs-0, my-rs-1, my-rs-2]")
+	})
+
+	t.Run("AssertTLSEnabled", func(t *testing.T) {
+		assert.NoError(t, secured.AssertTLSEnabled())
+		assert.EqualError(t, plain.AssertTLSEnabled(), "expected TLS to be enabled, but it is disabled for process my-rs-0")
+		assert.Error(t, AutomationConfig{}.AssertTLSEnabled())
+	})
+
+	t.Run("AssertMemberCount", func(t *testing.T) {
+		assert.NoError(t, plain.AssertMemberCount(3))
+		assert.EqualError(t, plain.AssertMemberCount(5), "expected 5 members, but replica set my-rs has 3")
+		assert.Error(t, AutomationConfig{}.AssertMemberCount(0))
+	})
+
+	t.Run("AssertAuthMechanism", func(t *testing.T) {
+		assert.NoError(t, secured.AssertAuthMechanism("SCRAM-SHA-256"))
+		assert.EqualError(t, secured.AssertAuthMechanism("MONGODB-X509"), "expected the MONGODB-X509 authentication mechanism, but the mechanisms are [SCRAM-SHA-256]")
+		assert.EqualError(t, plain.AssertAuthMechanism("SCRAM-SHA-256"), "expected the SCRAM-SHA-256 authentication mechanism, but authentication is disabled")
+	})
+}
@@ -4,6 +4,19 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scramcredentials"
+	"github.com/pkg/errors"
+	"github.com/stretchr/objx"
+	"go.uber.org/zap"
 )
 
 type Topology string
@@ -17,40 +30,233 @@ type AuthEnabler interface {
 	EnableAuth(auth Auth) Auth
 }
 
+// CompositeAuthEnabler applies each of its enablers in order, each one receiving the Auth of the previous one.
+type CompositeAuthEnabler []AuthEnabler
+
+func (c CompositeAuthEnabler) EnableAuth(auth Auth) Auth {
+	for _, enabler := range c {
+		auth = enabler.EnableAuth(auth)
+	}
+	return auth
+}
+
 type Modification func(*AutomationConfig)
 
+// ProcessMutator can make arbitrary changes to the process at the given index. Mutators are applied
+// after all of the standard options, in the order they were added.
+type ProcessMutator func(idx int, p *Process)
+
+// ReplicaSetMutator can make arbitrary changes to a replica set. Mutators are applied last,
+// after all modifications, in the order they were added.
+type ReplicaSetMutator func(rs *ReplicaSet)
+
 func NOOP() Modification {
 	return func(config *AutomationConfig) {}
 }
 
 type Builder struct {
-	enabler            AuthEnabler
+	enablers           []AuthEnabler
 	processes          []Process
 	replicaSets        []ReplicaSet
 	replicaSetHorizons []ReplicaSetHorizons
+	memberOptions      map[int]memberOptions
 	members            int
 	domain             string
 	name               string
 	fcv                string
 	topology           Topology
 	mongodbVersion     string
+	tls                tlsOptions
+	clusterAuthMode    ClusterAuthMode
 	previousAC         AutomationConfig
 	// MongoDB installable versions
 	versions      []MongoDbVersionConfig
 	modifications []Modification
+	// processMutators are applied to every process once it has been created
+	processMutators []ProcessMutator
+	// replicaSetMutators are applied to every replica set once the config has been assembled
+	replicaSetMutators []ReplicaSetMutator
+
+	// initialSyncSourceReadPreference is the read preference new members use to choose a sync source
+	initialSyncSourceReadPreference string
+	// serviceExecutor is the threading model used to execute client requests
+	serviceExecutor string
+	// defaultRWConcern is the cluster-wide default read and write concern
+	defaultRWConcern *DefaultRWConcern
+	// freeMonitoringState is the state of the free cloud monitoring service
+	freeMonitoringState string
+	// writeConcernMajorityJournalDefault is set on the replica set config when configured
+	writeConcernMajorityJournalDefault *bool
+	agentSettings                      *AgentSettings
+	clusterRole                        ClusterRole
+	// delayedBackupMembers holds the delay of each backup member, which are added after the regular members
+	delayedBackupMembers []int
+	authSchemaVersion    int
+	bindAllInterfaces    bool
+	agentStartupArgs     map[string]interface{}
+	replicaSetSettings   *ReplicaSetSettings
+	forceReconfig        bool
+	processManagement    *ProcessManagementConfig
+	userCredentials      []userCredentials
+	useBarInstaller      bool
+	architectures        []string
+	unixDomainSocket     *unixDomainSocket
+	configDB             string
+	maxArbiters          int
+	agentProxy           agentProxy
+	agentVersion         string
+	// notKubernetes is set when the processes don't run in containers, which allows them to fork
+	notKubernetes bool
+	// autoCorrectDelayedMembers sets the priority and votes of delayed members to 0 instead of rejecting them
+	autoCorrectDelayedMembers bool
+	// processArgsTemplate is the base of the args of every process, onto which the options are merged
+	processArgsTemplate json.RawMessage
+	// allowMinorityScaleDown allows removing so many voting members that the remaining ones are a minority
+	allowMinorityScaleDown bool
+	// oplogMinRetentionHours is the minimum number of hours the oplog entries are kept, 0 if not configured
+	oplogMinRetentionHours float64
+	// convertStandalone converts the standalone of the previous AutomationConfig to a replica set
+	convertStandalone bool
+	// javascriptEnabled configures server-side JavaScript, nil to keep the MongoDB default
+	javascriptEnabled *bool
+	// fcvAutoBumpOnFreshInstall sets the FCV to the version of the binary when there is no previous AutomationConfig
+	fcvAutoBumpOnFreshInstall bool
+	// localPingThresholdMs is set on the mongos processes, nil if it wasn't configured
+	localPingThresholdMs *int
+	// scram holds the users and agent credentials of the enabler added by EnableSCRAM
+	scram *scramOptions
+	// storageSyncPeriodSecs is the interval at which data is flushed to disk, 0 to keep the MongoDB default
+	storageSyncPeriodSecs int
+	// removedHosts are the members of the previous AutomationConfig which are removed, instead of the last ones
+	removedHosts []string
+	// agentDialTimeoutSeconds is added to the agent settings, nil if it wasn't configured
+	agentDialTimeoutSeconds *int
+	// diagnosticDataCollectionEnabled configures FTDC, nil to keep the MongoDB default
+	diagnosticDataCollectionEnabled *bool
+	// diagnosticDataCollectionDirectorySizeMB is the maximum size of the FTDC data, 0 to keep the MongoDB default
+	diagnosticDataCollectionDirectorySizeMB int
+	goalStateAnnotations                    map[string]string
+	// secondaryIndexPrefetch is the replication.secondaryIndexPrefetch of MongoDB before 3.2, empty if not configured
+	secondaryIndexPrefetch string
+	// previousACBytes is the marshaled previous AutomationConfig, which is parsed when building
+	previousACBytes      []byte
+	strictPreviousConfig bool
+	// wireObjectCheck configures the validation of the documents sent by clients, nil to keep the MongoDB default
+	wireObjectCheck *bool
+	// profilingFilter is the operationProfiling.filter of the processes, empty if not configured
+	profilingFilter json.RawMessage
+	// authMechanisms replace the deploymentAuthMechanisms of the auth enablers, nil if not configured
+	authMechanisms []string
+	// bumpIgnoredFields are the fields ignored when deciding if the version is increased, nil for agentManagedFields
+	bumpIgnoredFields []string
+	// processCluster is the cluster label of the processes, nil if not configured
+	processCluster *string
+	// blockCompressor is the compressor of the collections created by the processes, empty if not configured
+	blockCompressor string
+	// indexPrefixCompression configures the prefix compression of new indexes, nil to keep the MongoDB default
+	indexPrefixCompression *bool
+	// maxVersion is the highest version the config can be increased to, 0 if there is no limit
+	maxVersion int
+	// memberSpecs are the members configured with SetMembersSpec, nil if not configured
+	memberSpecs []MemberSpec
+	// processCPUAffinity are the CPU affinity hints of the processes, by index
+	processCPUAffinity map[int]string
+	// enableMajorityReadConcern configures the support of the majority read concern, nil to keep the MongoDB default
+	enableMajorityReadConcern *bool
+	// containerMode validates that the config can run in a container, see SetContainerMode
+	containerMode bool
+	// containerMountPoints are the volumes the paths must be on in container mode, nil for the defaults
+	containerMountPoints []string
+	// agentX509Subject is the subject of the certificate the agent authenticates with, empty if not configured
+	agentX509Subject string
+	// ttlMonitor configures the deletion of expired documents, nil to keep the MongoDB defaults
+	ttlMonitor *ttlMonitor
+	// balancePrioritiesByZone assigns the priorities of the members from their zones
+	balancePrioritiesByZone bool
+	// journalCompressor is the compressor of the journal, empty if not configured
+	journalCompressor string
+	// allowJournalCompressorChange allows changing the journal compressor of existing processes
+	allowJournalCompressorChange bool
+	// mongosConnectionPool is set on the mongos processes, nil if it wasn't configured
+	mongosConnectionPool *mongosConnectionPool
+	// authoritativeEmptyAuth makes a disabled Auth authoritative, see SetAuthoritativeEmptyAuth
+	authoritativeEmptyAuth bool
+	// multiClusterMode requires every member to be assigned to a Kubernetes cluster with SetMemberCluster
+	multiClusterMode bool
+	// memberClusters are the Kubernetes clusters of the members, by index
+	memberClusters map[int]string
+	// componentVerbosity are the log verbosities of the components, by component name
+	componentVerbosity map[string]int
+	// changeStreams enables the prerequisites of change streams, see EnableChangeStreams
+	changeStreams bool
+	// allowUnsafeDowngrade allows downgrading the binaries before the featureCompatibilityVersion was lowered
+	allowUnsafeDowngrade bool
+	// redactClientLogData redacts the messages logged with client data, which requires an enterprise build
+	redactClientLogData bool
+	// clearNewlyAddedWhenCaughtUp clears the newlyAdded flag of the members in memberCaughtUp
+	clearNewlyAddedWhenCaughtUp bool
+	// memberCaughtUp is the catch-up status of the members, by index
+	memberCaughtUp map[int]bool
+	// agentCompatibilityLevel selects the quirks of the agents the config is built for, empty for the latest agents
+	agentCompatibilityLevel string
+	// maxCacheOverflowFileSizeGB limits the WiredTiger cache overflow file, nil if it wasn't configured
+	maxCacheOverflowFileSizeGB *float64
+	// wiredTigerEviction tunes the WiredTiger eviction, nil if it wasn't configured
+	wiredTigerEviction *WiredTigerEviction
+	// scaledToZero disables all the processes, see BuildScaledToZero
+	scaledToZero bool
+	// agentServerTLSCAFile is added to the agent settings, empty if it wasn't configured
+	agentServerTLSCAFile string
+	// incrementalReconfigValidation rejects the member changes MongoDB doesn't allow in a single reconfig
+	incrementalReconfigValidation bool
+
+	log *zap.SugaredLogger
 }
 
 func NewBuilder() *Builder {
 	return &Builder{
 		processes:     []Process{},
 		replicaSets:   []ReplicaSet{},
+		memberOptions: map[int]memberOptions{},
 		versions:      []MongoDbVersionConfig{},
 		modifications: []Modification{},
+		log:           zap.S(),
+		maxArbiters:   1,
 	}
 }
 
+// SetLogger configures the logger used to warn about potentially unsafe configurations.
+func (b *Builder) SetLogger(log *zap.SugaredLogger) *Builder {
+	b.log = log
+	return b
+}
+
 func (b *Builder) SetAuthEnabler(enabler AuthEnabler) *Builder {
-	b.enabler = enabler
+	b.enablers = []AuthEnabler{enabler}
+	return b
+}
+
+// AddAuthEnabler adds an enabler which is applied after the ones already configured, e.g. to combine
+// SCRAM and x509. The enablers must not configure different agent authentication mechanisms.
+func (b *Builder) AddAuthEnabler(enabler AuthEnabler) *Builder {
+	b.enablers = append(b.enablers, enabler)
+	return b
+}
+
+// SetAuthoritativeEmptyAuth controls the shape of the auth block when no enabler enables authentication. By
+// default the empty fields are omitted, which agents read as authentication not being managed:
+//
+//	{"disabled": true, "authoritativeSet": false, "autoAuthMechanism": "MONGODB-CR"}
+//
+// When enabled, the block is authoritative and the empty lists are emitted, so that agents which expect a fully
+// populated block remove the users which aren't listed:
+//
+//	{"usersWanted": [], "disabled": true, "authoritativeSet": true, "autoAuthMechanisms": [],
+//	 "autoAuthMechanism": "MONGODB-CR", "deploymentAuthMechanisms": []}
+//
+// It has no effect when authentication is enabled.
+func (b *Builder) SetAuthoritativeEmptyAuth(authoritative bool) *Builder {
+	b.authoritativeEmptyAuth = authoritative
 	return b
 }
 
@@ -69,6 +275,167 @@ func (b *Builder) SetMembers(members int) *Builder {
 	return b
 }
 
+// SetMemberSecondaryDelay configures the member at the given index to replicate with a delay.
+// The delay is written to slaveDelay or secondaryDelaySecs depending on the MongoDB version.
+func (b *Builder) SetMemberSecondaryDelay(index, delaySecs int) *Builder {
+	opts := b.memberOptions[index]
+	opts.secondaryDelaySecs = delaySecs
+	b.memberOptions[index] = opts
+	return b
+}
+
+// SetMemberBuildIndexes configures whether the member at the given index builds indexes. Members which don't
+// must be hidden and have priority 0, e.g. delayed backup members.
+func (b *Builder) SetMemberBuildIndexes(index int, buildIndexes bool) *Builder {
+	opts := b.memberOptions[index]
+	opts.buildIndexes = &buildIndexes
+	b.memberOptions[index] = opts
+	return b
+}
+
+// AddDelayedBackupMember adds a member which is hidden, can't vote or become primary, and replicates
+// with the given delay. It is tagged as a backup member, so it can be targeted by backup tools.
+// Backup members are added after the members configured with SetMembers.
+func (b *Builder) AddDelayedBackupMember(delaySecs int) *Builder {
+	b.delayedBackupMembers = append(b.delayedBackupMembers, delaySecs)
+	return b
+}
+
+// SetAutoCorrectDelayedMembers sets the priority and votes of delayed members to 0, with a warning, instead
+// of rejecting the config. Delayed members must not vote or become primary, as they don't have the latest writes.
+func (b *Builder) SetAutoCorrectDelayedMembers(autoCorrect bool) *Builder {
+	b.autoCorrectDelayedMembers = autoCorrect
+	return b
+}
+
+// RemoveMemberByHost removes the member of the previous AutomationConfig with the given host, e.g. "my-rs-1",
+// instead of the member with the highest index. The other members keep their hosts and ids, and the number
+// configured with SetMembers is reached with the next unused hosts. The member options configured by index
+// refer to the positions of the members once it is removed.
+func (b *Builder) RemoveMemberByHost(host string) *Builder {
+	b.removedHosts = append(b.removedHosts, host)
+	return b
+}
+
+// SetAllowMinorityScaleDown allows scaling down the replica set by several voting members at once, so that the
+// remaining voting members are no longer a majority of the previous ones. This is rejected by default, as the
+// replica set can lose its primary until the new config is applied. Removing a single voting member is always allowed.
+func (b *Builder) SetAllowMinorityScaleDown(allow bool) *Builder {
+	b.allowMinorityScaleDown = allow
+	return b
+}
+
+// SetIncrementalReconfigValidation rejects the member changes, compared to the previous AutomationConfig, which
+// MongoDB doesn't allow in a single reconfig, e.g. changing the votes of several members at once. The error
+// describes how to split the change into steps, instead of the agent failing the reconfig.
+func (b *Builder) SetIncrementalReconfigValidation(validate bool) *Builder {
+	b.incrementalReconfigValidation = validate
+	return b
+}
+
+// SetConvertStandaloneToReplicaSet converts the standalone of the previous AutomationConfig to the replica set.
+// The replica set is first initiated with the standalone as its only member, so that it keeps its data, and
+// the other members are added by the following builds. It has no effect once the previous AutomationConfig
+// has a replica set.
+func (b *Builder) SetConvertStandaloneToReplicaSet(convert bool) *Builder {
+	b.convertStandalone = convert
+	return b
+}
+
+// MemberSpec describes a member of the replica set, see SetMembersSpec. The fields which aren't set keep
+// their defaults.
+type MemberSpec struct {
+	// Id is the id of the member, which can't be changed once it is part of the replica set
+	Id       *int
+	Priority *int
+	Votes    *int
+	// Hidden members are not visible to clients and must have priority 0
+	Hidden bool
+	// SecondaryDelaySecs is the delay the member replicates with
+	SecondaryDelaySecs int
+	Tags               map[string]string
+	// BuildIndexes false requires the member to be hidden and to have priority 0
+	BuildIndexes *bool
+	ArbiterOnly  bool
+	// HostName replaces the host name of the process of the member, e.g. with an externally reachable one
+	HostName string
+}
+
+// SetMembersSpec configures all members of the replica set at once, in order, instead of with the setters by
+// index. It replaces the options configured by index before. The number of members is the number of specs,
+// which must match the one configured with SetMembers, if any.
+func (b *Builder) SetMembersSpec(specs []MemberSpec) *Builder {
+	b.memberSpecs = append([]MemberSpec{}, specs...)
+	if b.members == 0 {
+		b.members = len(specs)
+	}
+	b.memberOptions = map[int]memberOptions{}
+	for i, spec := range specs {
+		b.memberOptions[i] = spec.toMemberOptions()
+	}
+	return b
+}
+
+func (s MemberSpec) toMemberOptions() memberOptions {
+	opts := memberOptions{
+		id:                 s.Id,
+		secondaryDelaySecs: s.SecondaryDelaySecs,
+		priority:           s.Priority,
+		votes:              s.Votes,
+		hidden:             s.Hidden,
+		buildIndexes:       s.BuildIndexes,
+		arbiterOnly:        s.ArbiterOnly,
+		hostName:           s.HostName,
+	}
+	if s.Tags != nil {
+		opts.tags = map[string]string{}
+		for name, value := range s.Tags {
+			opts.tags[name] = value
+		}
+	}
+	return opts
+}
+
+// SetMemberId configures the id of the member at the given index. The id of a member which is
+// already part of the replica set can't be changed.
+func (b *Builder) SetMemberId(index, id int) *Builder {
+	opts := b.memberOptions[index]
+	opts.id = &id
+	b.memberOptions[index] = opts
+	return b
+}
+
+// ConfigureRegionTags tags each member with the region it runs in, e.g. {"region": "us-east-1"}, keyed by
+// the index of the member. The tags can be used for tag-aware reads in deployments spanning multiple regions.
+func (b *Builder) ConfigureRegionTags(regions map[int]string) *Builder {
+	for index, region := range regions {
+		opts := b.memberOptions[index]
+		tags := map[string]string{}
+		for name, value := range opts.tags {
+			tags[name] = value
+		}
+		tags["region"] = region
+		opts.tags = tags
+		b.memberOptions[index] = opts
+	}
+	return b
+}
+
+// SetZoneForMember tags the member with the given index with the availability zone it runs in, e.g.
+// {"zone": "us-east-1a"}. The zones can be read back with MemberZones, e.g. to configure pod anti-affinity,
+// and a warning is logged when all voting members run in the same zone.
+func (b *Builder) SetZoneForMember(index int, zone string) *Builder {
+	opts := b.memberOptions[index]
+	tags := map[string]string{}
+	for name, value := range opts.tags {
+		tags[name] = value
+	}
+	tags[zoneTag] = zone
+	opts.tags = tags
+	b.memberOptions[index] = opts
+	return b
+}
+
 func (b *Builder) SetDomain(domain string) *Builder {
 	b.domain = domain
 	return b
@@ -84,6 +451,14 @@ func (b *Builder) SetFCV(fcv string) *Builder {
 	return b
 }
 
+// SetFCVAutoBumpOnFreshInstall sets the FCV to the major and minor version of MongoDB, when it isn't configured
+// with SetFCV and there is no previous AutomationConfig. Existing deployments are not affected, as their FCV
+// should only be raised once the upgrade has been confirmed.
+func (b *Builder) SetFCVAutoBumpOnFreshInstall(autoBump bool) *Builder {
+	b.fcvAutoBumpOnFreshInstall = autoBump
+	return b
+}
+
 func (b *Builder) AddVersion(version MongoDbVersionConfig) *Builder {
 	for idx := range version.Builds {
 		if version.Builds[idx].Modules == nil {
@@ -99,90 +474,3390 @@ func (b *Builder) SetMongoDBVersion(version string) *Builder {
 	return b
 }
 
-func (b *Builder) SetPreviousAutomationConfig(previousAC AutomationConfig) *Builder {
-	b.previousAC = previousAC
+// SetTLS configures TLS for every process in the deployment. The CA file is also
+// configured as the trusted CA of the agent.
+func (b *Builder) SetTLS(mode TLSMode, caFile, certAndKeyFile string) *Builder {
+	b.tls.mode = mode
+	b.tls.caFile = caFile
+	b.tls.certAndKeyFile = certAndKeyFile
 	return b
 }
 
-func (b *Builder) AddModifications(mod ...Modification) *Builder {
-	b.modifications = append(b.modifications, mod...)
+// SetMemberTLSCertFile configures the certificate and key file of the member at the given index, for deployments
+// where every member has its own certificate. The members without one use the file configured with SetTLS.
+func (b *Builder) SetMemberTLSCertFile(index int, path string) *Builder {
+	if b.tls.memberCertificateKeyFiles == nil {
+		b.tls.memberCertificateKeyFiles = map[int]string{}
+	}
+	b.tls.memberCertificateKeyFiles[index] = path
 	return b
 }
 
-func (b *Builder) Build() (AutomationConfig, error) {
-	hostnames := make([]string, b.members)
-	for i := 0; i < b.members; i++ {
-		hostnames[i] = fmt.Sprintf("%s-%d.%s", b.name, i, b.domain)
+// SetTLSClusterFile configures a certificate used for internal membership authentication
+// which is different from the certificate presented to clients. It requires x509 cluster authentication.
+func (b *Builder) SetTLSClusterFile(clusterFile string) *Builder {
+	b.tls.clusterFile = clusterFile
+	return b
+}
+
+// SetTLSClusterCAFile configures the CA which validates the certificates used for internal membership
+// authentication, when it is different from the CA of the clients. It requires x509 cluster authentication.
+func (b *Builder) SetTLSClusterCAFile(clusterCAFile string) *Builder {
+	b.tls.clusterCAFile = clusterCAFile
+	return b
+}
+
+// SetTLSAllowInvalid allows invalid certificates and/or hostnames to be presented when connecting with TLS.
+// This weakens security and should only be used temporarily, e.g. while migrating certificates.
+func (b *Builder) SetTLSAllowInvalid(certificates, hostnames bool) *Builder {
+	b.tls.allowInvalidCertificates = certificates
+	b.tls.allowInvalidHostnames = hostnames
+	return b
+}
+
+// SetTLSWeakCertificateValidation accepts clients which don't present a certificate, e.g. legacy drivers which
+// are migrated onto a cluster requiring TLS. weakCertificateValidation is the net.ssl name of
+// allowConnectionsWithoutCertificates, which is written instead from MongoDB 4.2, so it can't be combined with
+// disallowing connections without certificates. Like SetTLSAllowInvalid, it weakens security and is rejected
+// with strict TLS.
+func (b *Builder) SetTLSWeakCertificateValidation(weak bool) *Builder {
+	b.tls.weakCertificateValidation = weak
+	return b
+}
+
+// SetTLSLogVersions configures the TLS protocol versions, e.g. "TLS1_2,TLS1_3", for which a message
+// is logged when a client connects with them. It requires TLS to be enabled and MongoDB 4.4 or later.
+func (b *Builder) SetTLSLogVersions(versions string) *Builder {
+	b.tls.logVersions = versions
+	return b
+}
+
+// SetTLSCertificateKeyFilePassword configures the password which decrypts the certificate and key file. The
+// config is readable by anyone who can read the Secret it is stored in, so pass a reference to the password which
+// the agent resolves, e.g. the path of a file only mounted into its container, rather than the password itself.
+// The reference is emitted unchanged. It requires TLS to be enabled.
+func (b *Builder) SetTLSCertificateKeyFilePassword(ref string) *Builder {
+	b.tls.certificateKeyFilePassword = &ref
+	return b
+}
+
+// SetTLSCipherConfig configures the OpenSSL cipher string, e.g. "HIGH:!EXPORT:!aNULL@STRENGTH", which restricts
+// the cipher suites the processes accept. It is written to setParameter.opensslCipherConfig, as there is no
+// net.tls option for it. It requires TLS to be enabled.
+func (b *Builder) SetTLSCipherConfig(cipherConfig string) *Builder {
+	b.tls.cipherConfig = &cipherConfig
+	return b
+}
+
+// SetTLSCertificateSelector configures the certificate to be selected from the certificate store of the OS,
+// e.g. "subject=mongod", instead of a PEM file. The certificate and key file must not be configured with it.
+func (b *Builder) SetTLSCertificateSelector(selector string) *Builder {
+	b.tls.certificateSelector = selector
+	return b
+}
+
+// SetTLSFileValidation checks that the CA and certificate files exist and are readable when building.
+// This is only useful when the files are mounted where the config is built, which isn't the case when
+// they are only available to the agent.
+func (b *Builder) SetTLSFileValidation(validate bool) *Builder {
+	b.tls.validateFiles = validate
+	return b
+}
+
+// SetTLSRollingValidation rejects TLS mode changes, compared to the previous AutomationConfig, which skip an
+// intermediate mode, e.g. from disabled straight to requireTLS. Enabling TLS in a single step locks out the
+// clients and agents which don't use TLS yet.
+func (b *Builder) SetTLSRollingValidation(validate bool) *Builder {
+	b.tls.rollingValidation = validate
+	return b
+}
+
+// SetTLSAllowConnectionsWithoutCertificates configures whether processes of the given type accept clients
+// which don't present a certificate, which is allowed by default. Configuring it per process type allows
+// rolling out mutual TLS in a sharded cluster one process type at a time.
+func (b *Builder) SetTLSAllowConnectionsWithoutCertificates(processType ProcessType, allow bool) *Builder {
+	if b.tls.allowConnectionsWithoutCertificates == nil {
+		b.tls.allowConnectionsWithoutCertificates = map[ProcessType]bool{}
 	}
+	b.tls.allowConnectionsWithoutCertificates[processType] = allow
+	return b
+}
 
-	members := make([]ReplicaSetMember, b.members)
-	processes := make([]Process, b.members)
-	for i, h := range hostnames {
-		opts := []func(*Process){
-			withFCV(b.fcv),
-		}
+// SetAllowTLSDisable allows disabling TLS on processes which had it enabled in the previous AutomationConfig.
+// This is rejected by default, as disabling TLS while the agents still use it can lock them out.
+func (b *Builder) SetAllowTLSDisable(allow bool) *Builder {
+	b.tls.allowDisable = allow
+	return b
+}
+
+// SetStrictTLS rejects any TLS option which weakens the validation of certificates.
+func (b *Builder) SetStrictTLS(strict bool) *Builder {
+	b.tls.strict = strict
+	return b
+}
 
-		process := newProcess(toHostName(b.name, i), h, b.mongodbVersion, b.name, opts...)
-		processes[i] = process
+func (b *Builder) SetClusterAuthMode(mode ClusterAuthMode) *Builder {
+	b.clusterAuthMode = mode
+	return b
+}
 
-		if b.replicaSetHorizons != nil {
-			members[i] = newReplicaSetMember(process, i, b.replicaSetHorizons[i])
-		} else {
-			members[i] = newReplicaSetMember(process, i, nil)
+// SetInitialSyncSourceReadPreference configures the read preference used by members to choose
+// a sync source during their initial sync. This allows new members to sync from secondaries,
+// reducing the load on the primary. It requires MongoDB 4.4 or later.
+func (b *Builder) SetInitialSyncSourceReadPreference(pref string) *Builder {
+	b.initialSyncSourceReadPreference = pref
+	return b
+}
+
+// SetServiceExecutor configures the threading model used by mongod to execute client requests,
+// either "synchronous" or "adaptive". The option was removed in MongoDB 5.0.
+func (b *Builder) SetServiceExecutor(serviceExecutor string) *Builder {
+	b.serviceExecutor = serviceExecutor
+	return b
+}
+
+// SetDefaultRWConcern configures the cluster-wide default read and write concern.
+// It requires MongoDB 4.4 or later.
+func (b *Builder) SetDefaultRWConcern(concern DefaultRWConcern) *Builder {
+	b.defaultRWConcern = &concern
+	return b
+}
+
+// SetFreeMonitoring configures the state of the free cloud monitoring service, one of "runtime", "on" or "off".
+// It requires MongoDB 4.0 or later.
+func (b *Builder) SetFreeMonitoring(state string) *Builder {
+	b.freeMonitoringState = state
+	return b
+}
+
+// SetStorageSyncPeriodSecs configures the interval at which the processes flush data to disk, which is a
+// checkpoint with WiredTiger. The MongoDB default of 60 seconds should only be changed for specialized
+// workloads, as the journal already makes writes durable in between.
+func (b *Builder) SetStorageSyncPeriodSecs(secs int) *Builder {
+	b.storageSyncPeriodSecs = secs
+	return b
+}
+
+// SetOplogMinRetentionHours configures the minimum number of hours the oplog entries are kept, even if the
+// oplog grows beyond its configured size. This ensures delayed members and backups can catch up with the
+// oplog. It requires MongoDB 4.4 or later.
+func (b *Builder) SetOplogMinRetentionHours(hours float64) *Builder {
+	b.oplogMinRetentionHours = hours
+	return b
+}
+
+// SetSecondaryIndexPrefetch configures which indexes the secondaries load into memory before applying the
+// oplog entries, one of "none", "_id_only" or "all". The option only exists for the MMAPv1 storage engine
+// of MongoDB before 3.2, for newer versions ErrOptionNotSupported is returned.
+func (b *Builder) SetSecondaryIndexPrefetch(mode string) *Builder {
+	b.secondaryIndexPrefetch = mode
+	return b
+}
+
+// SetDiagnosticDataCollectionEnabled configures whether the processes capture full-time diagnostic data (FTDC).
+// It is enabled by default and only holds performance statistics, not any data, but some compliance regimes
+// require disabling it. MongoDB support relies on it to investigate issues.
+func (b *Builder) SetDiagnosticDataCollectionEnabled(enabled bool) *Builder {
+	b.diagnosticDataCollectionEnabled = &enabled
+	return b
+}
+
+// SetDiagnosticDataCollectionDirectorySizeMB configures the maximum size of the diagnostic data kept by each
+// process. A larger directory covers a longer period of time.
+func (b *Builder) SetDiagnosticDataCollectionDirectorySizeMB(sizeMB int) *Builder {
+	b.diagnosticDataCollectionDirectorySizeMB = sizeMB
+	return b
+}
+
+// SetBlockCompressor configures the compressor of the data of new collections, one of "snappy", "zlib",
+// "zstd" or "none". zstd requires MongoDB 4.2 or later. Existing collections keep their compressor, so
+// changing it on an existing deployment doesn't recompress the existing data.
+func (b *Builder) SetBlockCompressor(compressor string) *Builder {
+	b.blockCompressor = compressor
+	return b
+}
+
+// SetMaxCacheOverflowFileSizeGB limits the size of the file WiredTiger moves the cache to when it is under
+// pressure, 0 for no limit. The file only exists in MongoDB 4.0 and 4.2, MongoDB 4.4 replaced it with the history
+// store, so other versions return ErrOptionNotSupported.
+func (b *Builder) SetMaxCacheOverflowFileSizeGB(sizeGB float64) *Builder {
+	b.maxCacheOverflowFileSizeGB = &sizeGB
+	return b
+}
+
+// WiredTigerEviction are the thresholds and threads of the WiredTiger eviction. The fields which are 0 keep
+// the WiredTiger default.
+type WiredTigerEviction struct {
+	// ThreadsMin and ThreadsMax are the number of eviction threads, between 1 and 20
+	ThreadsMin int
+	ThreadsMax int
+	// Target and Trigger are the percentages of the cache in use at which eviction starts, and at which
+	// application threads help evicting
+	Target  int
+	Trigger int
+	// DirtyTarget and DirtyTrigger are the same percentages for the dirty data in the cache
+	DirtyTarget  int
+	DirtyTrigger int
+}
+
+// configString returns the WiredTiger configuration string of the eviction settings which are set.
+func (e WiredTigerEviction) configString() string {
+	var settings []string
+	var threads []string
+	if e.ThreadsMin > 0 {
+		threads = append(threads, fmt.Sprintf("threads_min=%d", e.ThreadsMin))
+	}
+	if e.ThreadsMax > 0 {
+		threads = append(threads, fmt.Sprintf("threads_max=%d", e.ThreadsMax))
+	}
+	if len(threads) > 0 {
+		settings = append(settings, "eviction=("+strings.Join(threads, ",")+")")
+	}
+	for _, setting := range []struct {
+		name  string
+		value int
+	}{
+		{"eviction_target", e.Target},
+		{"eviction_trigger", e.Trigger},
+		{"eviction_dirty_target", e.DirtyTarget},
+		{"eviction_dirty_trigger", e.DirtyTrigger},
+	} {
+		if setting.value > 0 {
+			settings = append(settings, fmt.Sprintf("%s=%d", setting.name, setting.value))
 		}
 	}
+	return strings.Join(settings, ",")
+}
 
-	auth := disabledAuth()
-	if b.enabler != nil {
-		auth = b.enabler.EnableAuth(auth)
+// validate ensures the eviction settings which are set are in range, and that the targets are below the triggers.
+func (e WiredTigerEviction) validate() error {
+	if e == (WiredTigerEviction{}) {
+		return errors.Errorf("at least one WiredTiger eviction setting must be configured")
 	}
-
-	currentAc := AutomationConfig{
-		Version:   b.previousAC.Version,
-		Processes: processes,
-		ReplicaSets: []ReplicaSet{
-			{
-				Id:              b.name,
-				Members:         members,
-				ProtocolVersion: "1",
-			},
-		},
-		Versions: b.versions,
-		Options:  Options{DownloadBase: "/var/lib/mongodb-mms-automation"},
-		Auth:     auth,
-		TLS: TLS{
-			ClientCertificateMode: ClientCertificateModeOptional,
-		},
+	for _, threads := range []int{e.ThreadsMin, e.ThreadsMax} {
+		if threads < 0 || threads > 20 {
+			return errors.Errorf("the number of WiredTiger eviction threads must be between 1 and 20, but got %d", threads)
+		}
 	}
-
-	// Apply all modifications
-	for _, modification := range b.modifications {
-		modification(&currentAc)
+	if e.ThreadsMin > 0 && e.ThreadsMax > 0 && e.ThreadsMin > e.ThreadsMax {
+		return errors.Errorf("the minimum number of WiredTiger eviction threads %d must not exceed the maximum %d", e.ThreadsMin, e.ThreadsMax)
+	}
+	for _, percentage := range []int{e.Target, e.Trigger, e.DirtyTarget, e.DirtyTrigger} {
+		if percentage < 0 || percentage > 99 {
+			return errors.Errorf("the WiredTiger eviction percentages must be between 1 and 99, but got %d", percentage)
+		}
+	}
+	if e.Target > 0 && e.Trigger > 0 && e.Target >= e.Trigger {
+		return errors.Errorf("the WiredTiger eviction target %d must be below the trigger %d", e.Target, e.Trigger)
 	}
+	if e.DirtyTarget > 0 && e.DirtyTrigger > 0 && e.DirtyTarget >= e.DirtyTrigger {
+		return errors.Errorf("the WiredTiger dirty eviction target %d must be below the trigger %d", e.DirtyTarget, e.DirtyTrigger)
+	}
+	return nil
+}
 
-	// Here we compare the bytes of the two automationconfigs,
-	// we can't use reflect.DeepEqual() as it treats nil entries as different from empty ones,
-	// and in the AutomationConfig Struct we use omitempty to set empty field to nil
-	// The agent requires the nil value we provide, otherwise the agent attempts to configure authentication.
+// SetWiredTigerEviction tunes the WiredTiger eviction of memory-pressured processes. The settings are applied
+// through setParameter.wiredTigerEngineRuntimeConfig, which all supported MongoDB versions accept.
+func (b *Builder) SetWiredTigerEviction(eviction WiredTigerEviction) *Builder {
+	b.wiredTigerEviction = &eviction
+	return b
+}
 
-	newAcBytes, err := json.Marshal(b.previousAC)
-	if err != nil {
-		return AutomationConfig{}, err
-	}
+// SetJournalCompressor configures the compressor of the journal, one of "snappy", "zlib", "zstd" or "none".
+// zstd requires MongoDB 4.2 or later. The compressor can't be changed once the dbPath is initialized, so
+// changing it for the processes of the previous AutomationConfig fails unless SetAllowJournalCompressorChange
+// is used, e.g. when the data of the processes is resynced.
+func (b *Builder) SetJournalCompressor(compressor string) *Builder {
+	b.journalCompressor = compressor
+	return b
+}
 
-	currentAcBytes, err := json.Marshal(currentAc)
-	if err != nil {
-		return AutomationConfig{}, err
-	}
+// SetAllowJournalCompressorChange allows changing the journal compressor of the processes of the previous
+// AutomationConfig.
+func (b *Builder) SetAllowJournalCompressorChange(allow bool) *Builder {
+	b.allowJournalCompressorChange = allow
+	return b
+}
 
-	if !bytes.Equal(newAcBytes, currentAcBytes) {
-		currentAc.Version++
+// SetAllowUnsafeDowngrade allows downgrading the MongoDB version of the processes of the previous AutomationConfig
+// to an older major.minor, while their featureCompatibilityVersion is still newer. MongoDB requires lowering the
+// featureCompatibilityVersion first, and downgrading the binaries in a later change, which is enforced by default.
+func (b *Builder) SetAllowUnsafeDowngrade(allow bool) *Builder {
+	b.allowUnsafeDowngrade = allow
+	return b
+}
+
+// SetIndexPrefixCompression configures whether new indexes are stored with prefix compression, which is enabled
+// by default. Existing indexes are not rebuilt, so changing it on an existing deployment only affects the indexes
+// built afterwards.
+func (b *Builder) SetIndexPrefixCompression(enabled bool) *Builder {
+	b.indexPrefixCompression = &enabled
+	return b
+}
+
+// SetProfilingFilter configures the query predicate, e.g. {"ns": "app.orders"}, which selects the operations
+// the profiler records, instead of recording all of them. It requires MongoDB 4.4.2 or later.
+func (b *Builder) SetProfilingFilter(filter json.RawMessage) *Builder {
+	b.profilingFilter = filter
+	return b
+}
+
+// SetAuthMechanisms configures the mechanisms clients can authenticate with, e.g. "SCRAM-SHA-256", replacing
+// the ones of the auth enablers. The processes are configured with the matching setParameter.authenticationMechanisms,
+// so that the servers accept exactly these mechanisms. Authentication has to be enabled.
+func (b *Builder) SetAuthMechanisms(mechanisms ...string) *Builder {
+	b.authMechanisms = append([]string{}, mechanisms...)
+	return b
+}
+
+// SetWireObjectCheck configures whether the processes validate the documents sent by clients before
+// storing them. Disabling it increases throughput, but invalid documents can be stored. It is enabled by default.
+func (b *Builder) SetWireObjectCheck(enabled bool) *Builder {
+	b.wireObjectCheck = &enabled
+	return b
+}
+
+// SetEnableMajorityReadConcern configures whether the processes support the majority read concern. It can only be
+// disabled before MongoDB 5.0, e.g. to limit the cache pressure of PSA replica sets, and disabling it makes change
+// streams and multi-document transactions unavailable. A config which also requires majority reads can't be built.
+func (b *Builder) SetEnableMajorityReadConcern(enabled bool) *Builder {
+	b.enableMajorityReadConcern = &enabled
+	return b
+}
+
+// EnableChangeStreams configures the prerequisites of change streams: MongoDB 3.6 or later, with a
+// featureCompatibilityVersion of at least 3.6, and the majority read concern enabled, which MongoDB 3.6 and
+// 4.0 require and which is also written for newer versions so that it can't be disabled by accident. Processes
+// using the MMAPv1 storage engine are rejected. A config conflicting with these, e.g. one disabling the
+// majority read concern with SetEnableMajorityReadConcern, can't be built.
+func (b *Builder) EnableChangeStreams() *Builder {
+	b.changeStreams = true
+	return b
+}
+
+// SetTTLMonitor configures the background task deleting the documents expired according to TTL indexes:
+// whether it runs, e.g. it can be disabled temporarily during bulk loads, and how many seconds it sleeps
+// between runs, 60 by default.
+func (b *Builder) SetTTLMonitor(enabled bool, sleepSecs int) *Builder {
+	b.ttlMonitor = &ttlMonitor{enabled: enabled, sleepSecs: sleepSecs}
+	return b
+}
+
+// SetComponentVerbosity configures the log verbosity, from 0 to 5, of individual components, e.g.
+// {"query": 2, "replication.election": 5}, so that a subsystem can be debugged without raising the verbosity
+// of every log message. They are written to systemLog.component.<component>.verbosity.
+func (b *Builder) SetComponentVerbosity(verbosity map[string]int) *Builder {
+	b.componentVerbosity = verbosity
+	return b
+}
+
+// SetJavascriptEnabled configures whether the processes allow server-side JavaScript execution, e.g. in
+// $where and mapReduce. Hardened deployments disable it. It is enabled by default.
+func (b *Builder) SetJavascriptEnabled(enabled bool) *Builder {
+	b.javascriptEnabled = &enabled
+	return b
+}
+
+// SetRedactClientLogData configures the processes to redact the client data, such as documents and query
+// values, from the messages they log, to keep PII out of the logs. It is only available in MongoDB Enterprise,
+// so the version of the processes must be an enterprise build. It is only written when enabled.
+func (b *Builder) SetRedactClientLogData(redact bool) *Builder {
+	b.redactClientLogData = redact
+	return b
+}
+
+// SetWriteConcernMajorityJournalDefault configures whether majority write concerns wait for the write
+// to be journaled on a majority of members. Disabling it is only meaningful for replica sets with
+// non-journaled members, such as members using the in-memory storage engine.
+func (b *Builder) SetWriteConcernMajorityJournalDefault(journalDefault bool) *Builder {
+	b.writeConcernMajorityJournalDefault = &journalDefault
+	return b
+}
+
+// SetAgentSettings configures the operational settings of the automation agent.
+func (b *Builder) SetAgentSettings(settings AgentSettings) *Builder {
+	b.agentSettings = &settings
+	return b
+}
+
+// SetAgentDialTimeout configures how long the automation agent waits to connect to a process before giving up.
+// Slow starting processes or high latency networks can need a longer timeout than the default. It is added to
+// the settings configured with SetAgentSettings.
+func (b *Builder) SetAgentDialTimeout(seconds int) *Builder {
+	b.agentDialTimeoutSeconds = &seconds
+	return b
+}
+
+// SetAgentServerTLSCAFile configures the CA the agents verify Ops Manager with, for deployments where the
+// PKI of Ops Manager is separate from the one of the processes configured with SetTLS. It is added to the
+// settings configured with SetAgentSettings.
+func (b *Builder) SetAgentServerTLSCAFile(caFile string) *Builder {
+	b.agentServerTLSCAFile = caFile
+	return b
+}
+
+// SetProcessArgsTemplate configures a JSON object, in the args2_6 format, which is the base of the args
+// of every process. The options of the Builder, including the defaults such as net.port, are merged onto it.
+// This allows using the options of new MongoDB versions before they are supported by the Builder.
+func (b *Builder) SetProcessArgsTemplate(template json.RawMessage) *Builder {
+	b.processArgsTemplate = template
+	return b
+}
+
+// SetAgentStartupArgs configures the flags the automation agent managing each process is launched with,
+// e.g. to use a proxy or a nonstandard directory layout. Only the flags in agentStartupArgNames are supported.
+func (b *Builder) SetAgentStartupArgs(args map[string]interface{}) *Builder {
+	b.agentStartupArgs = args
+	return b
+}
+
+// SetReplicaSetSettings configures the settings of the replica set. Only the fields which are set are
+// changed, so the settings can be combined with a preset such as ApplyWANPreset.
+func (b *Builder) SetReplicaSetSettings(settings ReplicaSetSettings) *Builder {
+	if b.replicaSetSettings == nil {
+		b.replicaSetSettings = &ReplicaSetSettings{}
+	}
+	if settings.ChainingAllowed != nil {
+		b.replicaSetSettings.ChainingAllowed = settings.ChainingAllowed
+	}
+	if settings.ElectionTimeoutMillis != nil {
+		b.replicaSetSettings.ElectionTimeoutMillis = settings.ElectionTimeoutMillis
+	}
+	if settings.HeartbeatTimeoutSecs != nil {
+		b.replicaSetSettings.HeartbeatTimeoutSecs = settings.HeartbeatTimeoutSecs
 	}
-	return currentAc, nil
+	if settings.HeartbeatIntervalMillis != nil {
+		b.replicaSetSettings.HeartbeatIntervalMillis = settings.HeartbeatIntervalMillis
+	}
+	if settings.CatchUpTimeoutMillis != nil {
+		b.replicaSetSettings.CatchUpTimeoutMillis = settings.CatchUpTimeoutMillis
+	}
+	if settings.CatchUpTakeoverDelayMillis != nil {
+		b.replicaSetSettings.CatchUpTakeoverDelayMillis = settings.CatchUpTakeoverDelayMillis
+	}
+	if settings.GetLastErrorModes != nil {
+		b.replicaSetSettings.GetLastErrorModes = settings.GetLastErrorModes
+	}
+	if settings.ReplicaSetId != "" {
+		b.replicaSetSettings.ReplicaSetId = settings.ReplicaSetId
+	}
+	return b
 }
 
-func toHostName(name string, index int) string {
-	return fmt.Sprintf("%s-%d", name, index)
+// SetWriteConcernModes configures named write concerns which require writes to be acknowledged by members
+// with distinct values of a tag, e.g. {"multiRegion": {"region": 2}} with ConfigureRegionTags.
+func (b *Builder) SetWriteConcernModes(modes map[string]map[string]int) *Builder {
+	return b.SetReplicaSetSettings(ReplicaSetSettings{GetLastErrorModes: modes})
+}
+
+// SetChainingAllowed configures whether secondaries may replicate from other secondaries, which MongoDB allows
+// by default. Disabling chaining forces every secondary to sync from the primary: the replication lag of the
+// secondaries diverges less, but the primary serves the oplog to all of them, which increases its load. Read
+// preferences are not affected, clients are still routed to secondaries.
+func (b *Builder) SetChainingAllowed(allowed bool) *Builder {
+	return b.SetReplicaSetSettings(ReplicaSetSettings{ChainingAllowed: &allowed})
+}
+
+// ApplyWANPreset configures settings suited to replica sets with members in different regions, where
+// latency is higher and less predictable. It tolerates slower heartbeats before calling an election,
+// and lets secondaries replicate from a closer secondary rather than from the primary:
+//
+//	electionTimeoutMillis: 20000 (default 10000)
+//	heartbeatTimeoutSecs:  20 (default 10)
+//	catchUpTimeoutMillis:  60000 (default -1)
+//	chainingAllowed:       true
+//
+// Any of these can be overridden by calling SetReplicaSetSettings afterwards.
+func (b *Builder) ApplyWANPreset() *Builder {
+	chainingAllowed := true
+	electionTimeoutMillis := 20000
+	heartbeatTimeoutSecs := 20
+	catchUpTimeoutMillis := 60000
+	return b.SetReplicaSetSettings(ReplicaSetSettings{
+		ChainingAllowed:       &chainingAllowed,
+		ElectionTimeoutMillis: &electionTimeoutMillis,
+		HeartbeatTimeoutSecs:  &heartbeatTimeoutSecs,
+		CatchUpTimeoutMillis:  &catchUpTimeoutMillis,
+	})
+}
+
+// ApplyLowLatencyElection configures settings suited to replica sets on a low latency network which
+// should fail over quickly. A failed primary is detected sooner, and a new primary doesn't wait long
+// for lagging writes, which may be rolled back:
+//
+//	electionTimeoutMillis:      5000 (default 10000)
+//	heartbeatIntervalMillis:    1000 (default 2000)
+//	catchUpTimeoutMillis:       2000 (default -1)
+//	catchUpTakeoverDelayMillis: 10000 (default 30000)
+//
+// Any of these can be overridden by calling SetReplicaSetSettings afterwards.
+func (b *Builder) ApplyLowLatencyElection() *Builder {
+	electionTimeoutMillis := 5000
+	heartbeatIntervalMillis := 1000
+	catchUpTimeoutMillis := 2000
+	catchUpTakeoverDelayMillis := 10000
+	return b.SetReplicaSetSettings(ReplicaSetSettings{
+		ElectionTimeoutMillis:      &electionTimeoutMillis,
+		HeartbeatIntervalMillis:    &heartbeatIntervalMillis,
+		CatchUpTimeoutMillis:       &catchUpTimeoutMillis,
+		CatchUpTakeoverDelayMillis: &catchUpTakeoverDelayMillis,
+	})
+}
+
+// ApplyHighStabilityElection configures settings suited to replica sets where unnecessary elections are
+// more harmful than a slower failover, e.g. on a network with short outages. Members tolerate missed
+// heartbeats for longer, and a new primary catches up with all the writes of the previous one:
+//
+//	electionTimeoutMillis:      30000 (default 10000)
+//	heartbeatTimeoutSecs:       20 (default 10)
+//	catchUpTimeoutMillis:       -1 (default -1)
+//	catchUpTakeoverDelayMillis: 60000 (default 30000)
+//
+// Any of these can be overridden by calling SetReplicaSetSettings afterwards.
+func (b *Builder) ApplyHighStabilityElection() *Builder {
+	electionTimeoutMillis := 30000
+	heartbeatTimeoutSecs := 20
+	catchUpTimeoutMillis := -1
+	catchUpTakeoverDelayMillis := 60000
+	return b.SetReplicaSetSettings(ReplicaSetSettings{
+		ElectionTimeoutMillis:      &electionTimeoutMillis,
+		HeartbeatTimeoutSecs:       &heartbeatTimeoutSecs,
+		CatchUpTimeoutMillis:       &catchUpTimeoutMillis,
+		CatchUpTakeoverDelayMillis: &catchUpTakeoverDelayMillis,
+	})
+}
+
+// SetUserSCRAMCredentials configures the exact SCRAM credentials of a user, so that the config is
+// reproducible. The credentials replace the ones of the user added by the AuthEnabler or modifications,
+// and the user is added without any roles if it doesn't exist.
+func (b *Builder) SetUserSCRAMCredentials(username, db string, sha1, sha256 scramcredentials.ScramCreds) *Builder {
+	b.userCredentials = append(b.userCredentials, userCredentials{
+		username: username,
+		db:       db,
+		sha1:     sha1,
+		sha256:   sha256,
+	})
+	return b
+}
+
+// SetProcessManagement configures how every process is run. Processes can't fork when running in
+// Kubernetes, see SetKubernetesMode.
+func (b *Builder) SetProcessManagement(config ProcessManagementConfig) *Builder {
+	b.processManagement = &config
+	return b
+}
+
+// SetKubernetesMode configures whether the processes run in Kubernetes, which is the default.
+func (b *Builder) SetKubernetesMode(kubernetes bool) *Builder {
+	b.notKubernetes = !kubernetes
+	return b
+}
+
+// defaultDownloadBase is the directory the agent downloads the MongoDB binaries to.
+const defaultDownloadBase = "/var/lib/mongodb-mms-automation"
+
+// defaultContainerMountPoints are the volumes of the containers created by the operator.
+var defaultContainerMountPoints = []string{DefaultMongoDBDataDir, DefaultAgentLogPath, defaultDownloadBase}
+
+// SetContainerMode configures whether building checks that the config can run in a container: the download base,
+// the dbPath and the log paths of the processes must be on a mounted volume, so they are writable and persisted,
+// and the processes must not fork. The mount points can be configured with SetContainerMountPoints.
+func (b *Builder) SetContainerMode(enabled bool) *Builder {
+	b.containerMode = enabled
+	return b
+}
+
+// SetContainerMountPoints configures the volumes the paths must be on in container mode, replacing the default
+// data, log and download directories.
+func (b *Builder) SetContainerMountPoints(mountPoints ...string) *Builder {
+	b.containerMountPoints = mountPoints
+	return b
+}
+
+// SetUnixDomainSocket configures whether every process listens on a UNIX domain socket, created in the
+// directory pathPrefix, e.g. so the agent can connect through it from the same pod. The MongoDB default
+// of /tmp is used when pathPrefix is empty.
+func (b *Builder) SetUnixDomainSocket(enabled bool, pathPrefix string) *Builder {
+	b.unixDomainSocket = &unixDomainSocket{enabled: enabled, pathPrefix: pathPrefix}
+	return b
+}
+
+// SetConfigDB configures the connection string of the config server replica set, in the form
+// "csReplSet/host:port,...", which the mongos processes connect to. When it isn't configured, it is
+// derived from the config server replica set of the deployment.
+func (b *Builder) SetConfigDB(configDB string) *Builder {
+	b.configDB = configDB
+	return b
+}
+
+// SetLocalPingThresholdMs configures the latency window mongos processes use to choose between the members of
+// a shard for reads. It only applies to mongos processes, which are added by modifications, so there must be
+// at least one.
+func (b *Builder) SetLocalPingThresholdMs(thresholdMs int) *Builder {
+	b.localPingThresholdMs = &thresholdMs
+	return b
+}
+
+// SetMongosConnectionPool configures the connection pools mongos processes use to connect to the shards:
+// poolSize is the number of pools (taskExecutorPoolSize) and maxSize the maximum number of connections of each
+// pool (ShardingTaskExecutorPoolMaxSize). Like the local ping threshold, it only applies to mongos processes.
+func (b *Builder) SetMongosConnectionPool(poolSize, maxSize int) *Builder {
+	b.mongosConnectionPool = &mongosConnectionPool{poolSize: poolSize, maxSize: maxSize}
+	return b
+}
+
+// SetMaxArbiters configures the number of arbiters a replica set can have, which is 1 by default. More than
+// one arbiter is rarely useful, and makes elections more fragile than adding a data bearing member would.
+func (b *Builder) SetMaxArbiters(max int) *Builder {
+	b.maxArbiters = max
+	return b
+}
+
+// SetArchitectureFilter only keeps the builds of the MongoDB versions with one of the given architectures,
+// e.g. "amd64", to keep the config small. Every version must have a build for one of them.
+func (b *Builder) SetArchitectureFilter(architectures []string) *Builder {
+	b.architectures = architectures
+	return b
+}
+
+// SetUseBarInstaller makes the agent install MongoDB from a tarball instead of a package.
+func (b *Builder) SetUseBarInstaller(useBarInstaller bool) *Builder {
+	b.useBarInstaller = useBarInstaller
+	return b
+}
+
+// SetAgentProxy configures the proxies the agent downloads the MongoDB binaries through, and the comma
+// separated list of hosts it connects to directly.
+func (b *Builder) SetAgentProxy(httpProxy, httpsProxy, noProxy string) *Builder {
+	b.agentProxy = agentProxy{httpProxy: httpProxy, httpsProxy: httpsProxy, noProxy: noProxy}
+	return b
+}
+
+// SetAgentVersion pins the version of the automation agent, e.g. "10.2.15.5958-1", so that the
+// deployment is reproducible.
+func (b *Builder) SetAgentVersion(version string) *Builder {
+	b.agentVersion = version
+	return b
+}
+
+// SetForceReconfig makes the agent reconfigure the replica set even if a majority of the members are
+// unavailable. This is meant for disaster recovery only, as it can roll back writes which were acknowledged
+// by the majority. It is never carried forward from the previous AutomationConfig, so it has to be requested
+// on every build that needs it.
+func (b *Builder) SetForceReconfig(force bool) *Builder {
+	b.forceReconfig = force
+	return b
+}
+
+// SetConfigServerReplicaSet configures the replica set as the config server replica set (CSRS)
+// of a sharded cluster.
+func (b *Builder) SetConfigServerReplicaSet(configServer bool) *Builder {
+	if configServer {
+		b.clusterRole = ClusterRoleConfigServer
+	} else if b.clusterRole == ClusterRoleConfigServer {
+		b.clusterRole = ""
+	}
+	return b
+}
+
+// SetClusterRole configures the role of the replica set in a sharded cluster, either a config server
+// or a shard. An empty role means the replica set is not part of a sharded cluster.
+func (b *Builder) SetClusterRole(role ClusterRole) *Builder {
+	b.clusterRole = role
+	return b
+}
+
+// SetBindAllInterfaces configures every process to listen on all IPv4 and IPv6 interfaces. This uses
+// net.bindIpAll from MongoDB 3.6, and an explicit list of addresses for older versions.
+func (b *Builder) SetBindAllInterfaces(bindAll bool) *Builder {
+	b.bindAllInterfaces = bindAll
+	return b
+}
+
+// SetAuthSchemaVersion configures the auth schema version of every process, either 3 (MONGODB-CR)
+// or 5 (SCRAM). When it is not configured, the version of the previous AutomationConfig is kept,
+// so that an existing deployment is never downgraded by accident.
+func (b *Builder) SetAuthSchemaVersion(version int) *Builder {
+	b.authSchemaVersion = version
+	return b
+}
+
+// SetGoalStateAnnotations attaches metadata to the AutomationConfig, e.g. the generation of the resource it was
+// built from, to trace which revision produced it. Changing the annotations alone doesn't increase the version.
+func (b *Builder) SetGoalStateAnnotations(annotations map[string]string) *Builder {
+	b.goalStateAnnotations = make(map[string]string, len(annotations))
+	for name, value := range annotations {
+		b.goalStateAnnotations[name] = value
+	}
+	return b
+}
+
+func (b *Builder) SetPreviousAutomationConfig(previousAC AutomationConfig) *Builder {
+	b.previousAC = previousAC
+	return b
+}
+
+// agentManagedFields are the fields the agent can rewrite itself, e.g. while rotating the CA, which are ignored
+// when deciding if the version is increased unless configured otherwise with SetIgnoreAgentManagedFieldsInBump.
+var agentManagedFields = []string{"tls.CAFilePath"}
+
+// SetProcessCluster labels every process, including the ones added by modifications, with the logical cluster
+// it is part of, e.g. to group the processes of deployments sharing infrastructure in dashboards. Changing the
+// label alone doesn't increase the version.
+func (b *Builder) SetProcessCluster(cluster string) *Builder {
+	b.processCluster = &cluster
+	return b
+}
+
+// SetProcessCPUAffinity records a hint of the CPUs the process with the given index should run on, as a list
+// of CPUs and ranges such as "0-3,8". The agent ignores it, so changing the hint alone doesn't increase the version.
+func (b *Builder) SetProcessCPUAffinity(index int, cpus string) *Builder {
+	if b.processCPUAffinity == nil {
+		b.processCPUAffinity = map[int]string{}
+	}
+	b.processCPUAffinity[index] = cpus
+	return b
+}
+
+// SetClearNewlyAddedWhenCaughtUp clears the newlyAdded flag, which is otherwise kept from the previous
+// AutomationConfig, of the members reported as caught up with SetMemberCaughtUp. The members still catching up
+// keep it, so that they only gain a vote once they have caught up, even during a large scale-up.
+func (b *Builder) SetClearNewlyAddedWhenCaughtUp(clear bool) *Builder {
+	b.clearNewlyAddedWhenCaughtUp = clear
+	return b
+}
+
+// SetMemberCaughtUp reports whether the member with the given index has caught up with the primary, e.g. as
+// observed by the controller. It requires SetClearNewlyAddedWhenCaughtUp.
+func (b *Builder) SetMemberCaughtUp(index int, caughtUp bool) *Builder {
+	if b.memberCaughtUp == nil {
+		b.memberCaughtUp = map[int]bool{}
+	}
+	b.memberCaughtUp[index] = caughtUp
+	return b
+}
+
+// SetMultiClusterMode sets options.multiClusterMode, for deployments whose members span several Kubernetes
+// clusters. Every member must then be assigned to a cluster with SetMemberCluster.
+func (b *Builder) SetMultiClusterMode(multiCluster bool) *Builder {
+	b.multiClusterMode = multiCluster
+	return b
+}
+
+// SetMemberCluster records the Kubernetes cluster the member with the given index runs in. It can only be
+// configured in multi-cluster mode. The agent ignores it, so moving a member alone doesn't increase the version.
+func (b *Builder) SetMemberCluster(index int, clusterName string) *Builder {
+	if b.memberClusters == nil {
+		b.memberClusters = map[int]string{}
+	}
+	b.memberClusters[index] = clusterName
+	return b
+}
+
+// SetMaxVersion configures the highest version the AutomationConfig may be increased to. A build which would
+// increase the version beyond it fails with ErrVersionCeilingReached, so that a bug causing a version bump
+// on every reconciliation is stopped and can be investigated.
+func (b *Builder) SetMaxVersion(version int) *Builder {
+	b.maxVersion = version
+	return b
+}
+
+// ErrVersionCeilingReached is returned when the version would be increased beyond the one configured with
+// SetMaxVersion.
+var ErrVersionCeilingReached = errors.New("the automation config version ceiling was reached")
+
+// SetIgnoreAgentManagedFieldsInBump configures the fields, e.g. "tls.CAFilePath" or "processes[].args2_6.net.port",
+// which are ignored when deciding if the version is increased. The fields are still part of the config, but
+// changing only them doesn't increase the version, so that changes made by the agent don't cause a version
+// bump on every reconciliation. By default, the fields in agentManagedFields are ignored.
+func (b *Builder) SetIgnoreAgentManagedFieldsInBump(paths []string) *Builder {
+	b.bumpIgnoredFields = append([]string{}, paths...)
+	return b
+}
+
+// comparableValue returns the generic value of the config which is compared to decide if the version is
+// increased. The annotations, the cluster labels of the processes and the fields ignored in the bump are not
+// part of it.
+func (b *Builder) comparableValue(ac AutomationConfig) (interface{}, error) {
+	value, err := toJSONValue(ac.withoutAnnotations())
+	if err != nil {
+		return nil, err
+	}
+	removeField(value, []string{"processes[]", "cluster"})
+	removeField(value, []string{"processes[]", "cpuAffinity"})
+	removeField(value, []string{"replicaSets[]", "members[]", "clusterName"})
+	ignored := b.bumpIgnoredFields
+	if ignored == nil {
+		ignored = agentManagedFields
+	}
+	for _, path := range ignored {
+		removeField(value, strings.Split(path, "."))
+	}
+	return value, nil
+}
+
+// SetAgentCompatibilityLevel builds the config for the automation agents of the given major version, e.g. "10.x"
+// or "11.x", which differ in the optional fields they accept. Older agents reject the fields which newer
+// ones ignore, such as the cluster labels and the annotations, so these are left out, and options they don't
+// support can't be configured. By default the config is built for the latest agents.
+func (b *Builder) SetAgentCompatibilityLevel(level string) *Builder {
+	b.agentCompatibilityLevel = level
+	return b
+}
+
+// SetPreviousAutomationConfigBytes configures the previous AutomationConfig as it was stored, e.g. by the agent.
+// It is parsed when building, and replaces the one configured with SetPreviousAutomationConfig.
+func (b *Builder) SetPreviousAutomationConfigBytes(data []byte) *Builder {
+	b.previousACBytes = data
+	return b
+}
+
+// SetStrictPreviousConfig configures whether building fails when the previous AutomationConfig configured with
+// SetPreviousAutomationConfigBytes has fields which aren't part of the AutomationConfig, e.g. because it was
+// written by a newer version. Otherwise these fields are dropped, which could remove important settings.
+func (b *Builder) SetStrictPreviousConfig(strict bool) *Builder {
+	b.strictPreviousConfig = strict
+	return b
+}
+
+// parsePreviousAutomationConfig parses the previous AutomationConfig configured with
+// SetPreviousAutomationConfigBytes, if any.
+func (b *Builder) parsePreviousAutomationConfig() error {
+	if b.previousACBytes == nil {
+		return nil
+	}
+	previousAC, err := UnmarshalAutomationConfig(b.previousACBytes, b.strictPreviousConfig)
+	if err != nil {
+		return errors.Wrapf(err, "invalid previous automation config")
+	}
+	b.previousAC = previousAC
+	return nil
+}
+
+func (b *Builder) AddModifications(mod ...Modification) *Builder {
+	b.modifications = append(b.modifications, mod...)
+	return b
+}
+
+// BuildProcessesOnly returns the processes that Build would generate, without assembling
+// the rest of the AutomationConfig. Modifications are not applied as they operate on the
+// full AutomationConfig.
+func (b *Builder) BuildProcessesOnly() ([]Process, error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	processes := b.buildProcesses()
+	sortProcesses(processes)
+	return processes, nil
+}
+
+// Hostnames returns the hostnames of all of the processes Build would generate, without building
+// the AutomationConfig. This allows the Services backing the hostnames to be created beforehand.
+func (b *Builder) Hostnames() ([]string, error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	return b.buildHostnames(), nil
+}
+
+// AuthPreview returns the Auth the AuthEnabler produces, with the configured user credentials, without
+// building the rest of the AutomationConfig. Modifications are not applied as they operate on the full
+// AutomationConfig.
+func (b *Builder) AuthPreview() (Auth, error) {
+	auth, err := b.buildAuth()
+	if err != nil {
+		return Auth{}, err
+	}
+	for _, creds := range b.userCredentials {
+		creds.apply(&auth)
+	}
+	return auth, nil
+}
+
+// validate ensures the options configured on the Builder are compatible with each other.
+func (b *Builder) validate() error {
+	if err := b.validateSCRAM(); err != nil {
+		return err
+	}
+	if err := b.validateAgentX509Subject(); err != nil {
+		return err
+	}
+	if b.tls.clusterFile != "" {
+		if !b.tls.enabled() {
+			return errors.Errorf("a TLS cluster file can only be configured when TLS is enabled")
+		}
+		if b.clusterAuthMode != ClusterAuthModeX509 {
+			return errors.Errorf("a TLS cluster file requires cluster authentication mode %s, but got %q", ClusterAuthModeX509, b.clusterAuthMode)
+		}
+	}
+	if b.tls.clusterCAFile != "" {
+		if !b.tls.enabled() {
+			return errors.Errorf("a TLS cluster CA file can only be configured when TLS is enabled")
+		}
+		if b.clusterAuthMode != ClusterAuthModeX509 {
+			return errors.Errorf("a TLS cluster CA file requires cluster authentication mode %s, but got %q", ClusterAuthModeX509, b.clusterAuthMode)
+		}
+	}
+	for processType := range b.tls.allowConnectionsWithoutCertificates {
+		if processType != Mongod && processType != Mongos {
+			return errors.Errorf("invalid process type %q, must be one of %s or %s", processType, Mongod, Mongos)
+		}
+		if !b.tls.enabled() {
+			return errors.Errorf("connections without certificates can only be configured when TLS is enabled")
+		}
+	}
+	if b.tls.strict && (b.tls.allowInvalidCertificates || b.tls.allowInvalidHostnames) {
+		return errors.Errorf("invalid certificates and hostnames can't be allowed when strict TLS is enabled")
+	}
+	if b.tls.strict && b.tls.weakCertificateValidation {
+		return errors.Errorf("weak certificate validation can't be configured when strict TLS is enabled")
+	}
+	if b.tls.weakCertificateValidation {
+		for processType, allow := range b.tls.allowConnectionsWithoutCertificates {
+			if !allow {
+				return errors.Errorf("weak certificate validation allows connections without certificates, which are disallowed for %s processes", processType)
+			}
+		}
+	}
+	if b.tls.enabled() {
+		if b.tls.certAndKeyFile != "" && b.tls.certificateSelector != "" {
+			return errors.Errorf("only one of a TLS certificate and key file or a certificate selector can be configured")
+		}
+		if b.tls.certAndKeyFile == "" && b.tls.certificateSelector == "" && len(b.tls.memberCertificateKeyFiles) < b.memberCount() {
+			return errors.Errorf("TLS requires a certificate and key file or a certificate selector")
+		}
+	}
+	for index, path := range b.tls.memberCertificateKeyFiles {
+		if !b.tls.enabled() {
+			return errors.Errorf("the TLS certificates of the members can only be configured when TLS is enabled")
+		}
+		if b.tls.certificateSelector != "" {
+			return errors.Errorf("the TLS certificates of the members can't be configured with a certificate selector")
+		}
+		if index < 0 || index >= b.memberCount() {
+			return errors.Errorf("a TLS certificate is configured for member %d, but the replica set has %d members", index, b.memberCount())
+		}
+		if path == "" {
+			return errors.Errorf("the TLS certificate and key file of member %d must not be empty", index)
+		}
+	}
+	if b.tls.validateFiles && b.tls.enabled() {
+		if err := b.tls.validateFilesReadable(); err != nil {
+			return err
+		}
+	}
+	if b.tls.certificateKeyFilePassword != nil {
+		if *b.tls.certificateKeyFilePassword == "" {
+			return errors.Errorf("the TLS certificate key file password reference must not be empty")
+		}
+		if !b.tls.enabled() {
+			return errors.Errorf("a TLS certificate key file password can only be configured when TLS is enabled")
+		}
+	}
+	if b.tls.cipherConfig != nil {
+		if *b.tls.cipherConfig == "" {
+			return errors.Errorf("the TLS cipher config must not be empty")
+		}
+		if !b.tls.enabled() {
+			return errors.Errorf("a TLS cipher config can only be configured when TLS is enabled")
+		}
+	}
+	if b.tls.logVersions != "" {
+		if err := b.validateTLSLogVersions(); err != nil {
+			return err
+		}
+	}
+	if b.initialSyncSourceReadPreference != "" {
+		if !isValidReadPreference(b.initialSyncSourceReadPreference) {
+			return errors.Errorf("invalid initial sync source read preference: %q", b.initialSyncSourceReadPreference)
+		}
+		if !isVersionAtLeast(b.mongodbVersion, 4, 4) {
+			return errors.Errorf("initialSyncSourceReadPreference requires MongoDB 4.4 or later, but got %s", b.mongodbVersion)
+		}
+	}
+	if b.serviceExecutor != "" {
+		if b.serviceExecutor != "synchronous" && b.serviceExecutor != "adaptive" {
+			return errors.Errorf(`invalid service executor %q, must be one of "synchronous" or "adaptive"`, b.serviceExecutor)
+		}
+		if isVersionAtLeast(b.mongodbVersion, 5, 0) {
+			return errors.Errorf("net.serviceExecutor is not supported from MongoDB 5.0, but got %s", b.mongodbVersion)
+		}
+		if b.serviceExecutor == "adaptive" && !isVersionAtLeast(b.mongodbVersion, 3, 6) {
+			return errors.Errorf("the adaptive service executor requires MongoDB 3.6 or later, but got %s", b.mongodbVersion)
+		}
+	}
+	if b.defaultRWConcern != nil {
+		if !isVersionAtLeast(b.mongodbVersion, 4, 4) {
+			return errors.Errorf("a default read and write concern requires MongoDB 4.4 or later, but got %s", b.mongodbVersion)
+		}
+		if err := validateDefaultRWConcern(*b.defaultRWConcern); err != nil {
+			return err
+		}
+	}
+	if b.freeMonitoringState != "" {
+		if b.freeMonitoringState != "runtime" && b.freeMonitoringState != "on" && b.freeMonitoringState != "off" {
+			return errors.Errorf(`invalid free monitoring state %q, must be one of "runtime", "on" or "off"`, b.freeMonitoringState)
+		}
+		if !isVersionAtLeast(b.mongodbVersion, 4, 0) {
+			return errors.Errorf("free monitoring requires MongoDB 4.0 or later, but got %s", b.mongodbVersion)
+		}
+	}
+	if b.convertingStandalone() {
+		if err := b.validateStandalone(); err != nil {
+			return err
+		}
+	}
+	if b.diagnosticDataCollectionDirectorySizeMB < 0 {
+		return errors.Errorf("the diagnostic data directory size must be positive, but got %d MB", b.diagnosticDataCollectionDirectorySizeMB)
+	}
+	if b.diagnosticDataCollectionDirectorySizeMB > 0 && b.diagnosticDataCollectionEnabled != nil && !*b.diagnosticDataCollectionEnabled {
+		return errors.Errorf("the diagnostic data directory size can't be configured when diagnostic data collection is disabled")
+	}
+	for name := range b.goalStateAnnotations {
+		if name == "" {
+			return errors.Errorf("the names of the goal state annotations must not be empty")
+		}
+	}
+	if b.storageSyncPeriodSecs < 0 {
+		return errors.Errorf("the storage sync period must be positive, but got %d", b.storageSyncPeriodSecs)
+	}
+	if b.maxCacheOverflowFileSizeGB != nil {
+		if *b.maxCacheOverflowFileSizeGB < 0 {
+			return errors.Errorf("the maximum cache overflow file size must not be negative, but got %v GB", *b.maxCacheOverflowFileSizeGB)
+		}
+		if !isVersionAtLeast(b.mongodbVersion, 4, 0) || isVersionAtLeast(b.mongodbVersion, 4, 4) {
+			return errors.Wrapf(ErrOptionNotSupported, "storage.wiredTiger.engineConfig.maxCacheOverflowFileSizeGB only exists in MongoDB 4.0 and 4.2, but got %s", b.mongodbVersion)
+		}
+	}
+	if b.wiredTigerEviction != nil {
+		if err := b.wiredTigerEviction.validate(); err != nil {
+			return err
+		}
+	}
+	if b.oplogMinRetentionHours < 0 {
+		return errors.Errorf("the oplog minimum retention hours must not be negative, but got %v", b.oplogMinRetentionHours)
+	}
+	if b.oplogMinRetentionHours > 0 && !isVersionAtLeast(b.mongodbVersion, 4, 4) {
+		return errors.Errorf("storage.oplogMinRetentionHours requires MongoDB 4.4 or later, but got %s", b.mongodbVersion)
+	}
+	if b.secondaryIndexPrefetch != "" {
+		if err := validateSecondaryIndexPrefetch(b.secondaryIndexPrefetch, b.mongodbVersion); err != nil {
+			return err
+		}
+	}
+	if b.agentDialTimeoutSeconds != nil && *b.agentDialTimeoutSeconds <= 0 {
+		return errors.Errorf("the agent dial timeout must be positive, but got %d seconds", *b.agentDialTimeoutSeconds)
+	}
+	if b.agentServerTLSCAFile != "" && !path.IsAbs(b.agentServerTLSCAFile) {
+		return errors.Errorf("the CA file of the agent server TLS must be an absolute path, but got %q", b.agentServerTLSCAFile)
+	}
+	if b.agentSettings != nil {
+		if err := validateAgentSettings(*b.agentSettings); err != nil {
+			return err
+		}
+	}
+	if len(b.processArgsTemplate) > 0 {
+		var template map[string]interface{}
+		if err := json.Unmarshal(b.processArgsTemplate, &template); err != nil {
+			return errors.Wrapf(err, "the process args template must be a JSON object")
+		}
+	}
+	if b.blockCompressor != "" {
+		if err := validateBlockCompressor(b.blockCompressor, b.mongodbVersion); err != nil {
+			return err
+		}
+	}
+	if b.journalCompressor != "" {
+		if err := validateJournalCompressor(b.journalCompressor, b.mongodbVersion); err != nil {
+			return err
+		}
+	}
+	if b.enableMajorityReadConcern != nil && !*b.enableMajorityReadConcern && isVersionAtLeast(b.mongodbVersion, 5, 0) {
+		return errors.Wrapf(ErrOptionNotSupported, "the majority read concern can only be disabled before MongoDB 5.0, but got %s", b.mongodbVersion)
+	}
+	if err := validateComponentVerbosity(b.componentVerbosity); err != nil {
+		return err
+	}
+	if b.changeStreams {
+		if err := b.validateChangeStreams(); err != nil {
+			return err
+		}
+	}
+	if b.ttlMonitor != nil && b.ttlMonitor.sleepSecs <= 0 {
+		return errors.Errorf("the TTL monitor sleep must be a positive number of seconds, but got %d", b.ttlMonitor.sleepSecs)
+	}
+	if b.maxVersion < 0 {
+		return errors.Errorf("the maximum version must not be negative, but got %d", b.maxVersion)
+	}
+	if b.processCluster != nil && *b.processCluster == "" {
+		return errors.Errorf("the cluster label of the processes must not be empty")
+	}
+	if err := b.validateMemberClusters(); err != nil {
+		return err
+	}
+	if err := b.validateAgentCompatibility(); err != nil {
+		return err
+	}
+	if len(b.memberCaughtUp) > 0 && !b.clearNewlyAddedWhenCaughtUp {
+		return errors.Errorf("the catch-up status of the members requires clearing newlyAdded when they are caught up to be enabled")
+	}
+	for index := range b.memberCaughtUp {
+		if index < 0 || index >= b.memberCount() {
+			return errors.Errorf("a catch-up status is configured for member %d, but the replica set has %d members", index, b.memberCount())
+		}
+	}
+	for index, cpus := range b.processCPUAffinity {
+		if index < 0 || index >= b.memberCount() {
+			return errors.Errorf("a CPU affinity is configured for process %d, but the replica set has %d members", index, b.memberCount())
+		}
+		if err := validateCPUList(cpus); err != nil {
+			return errors.Wrapf(err, "invalid CPU affinity of process %d", index)
+		}
+	}
+	for _, path := range b.bumpIgnoredFields {
+		for _, segment := range strings.Split(path, ".") {
+			if strings.TrimSuffix(segment, "[]") == "" {
+				return errors.Errorf("invalid field %q ignored in the version bump", path)
+			}
+		}
+	}
+	if len(b.profilingFilter) > 0 {
+		var filter map[string]interface{}
+		if err := json.Unmarshal(b.profilingFilter, &filter); err != nil || filter == nil {
+			return errors.Errorf("the profiling filter must be a JSON object, but got %s", b.profilingFilter)
+		}
+		if !isPatchVersionAtLeast(b.mongodbVersion, 4, 4, 2) {
+			return errors.Wrapf(ErrOptionNotSupported, "operationProfiling.filter requires MongoDB 4.4.2 or later, but got %s", b.mongodbVersion)
+		}
+	}
+	if err := validateAgentStartupArgs(b.agentStartupArgs); err != nil {
+		return err
+	}
+	if b.memberSpecs != nil && len(b.memberSpecs) != b.members {
+		return errors.Errorf("%d members are specified, but the replica set has %d members", len(b.memberSpecs), b.members)
+	}
+	for index, opts := range b.memberOptions {
+		if opts.tags == nil {
+			continue
+		}
+		if index < 0 || index >= b.memberCount() {
+			return errors.Errorf("tags are configured for member %d, but the replica set has %d members", index, b.memberCount())
+		}
+		if region, ok := opts.tags["region"]; ok && region == "" {
+			return errors.Errorf("the region of member %d must not be empty", index)
+		}
+		if zone, ok := opts.tags[zoneTag]; ok && zone == "" {
+			return errors.Errorf("the zone of member %d must not be empty", index)
+		}
+	}
+	if uds := b.unixDomainSocket; uds != nil && uds.enabled && uds.pathPrefix != "" && !path.IsAbs(uds.pathPrefix) {
+		return errors.Errorf("the UNIX domain socket path prefix must be absolute, but got %q", uds.pathPrefix)
+	}
+	if b.configDB != "" && !configDBPattern.MatchString(b.configDB) {
+		return errors.Errorf("invalid config DB %q, must be in the form csReplSet/host:port,...", b.configDB)
+	}
+	if err := b.agentProxy.validate(); err != nil {
+		return err
+	}
+	if pool := b.mongosConnectionPool; pool != nil {
+		if pool.poolSize <= 0 || pool.maxSize <= 0 {
+			return errors.Errorf("the mongos connection pool sizes must be positive, but got %d and %d", pool.poolSize, pool.maxSize)
+		}
+		if pool.maxSize < pool.poolSize {
+			return errors.Errorf("the maximum size %d of the mongos connection pool must be at least the pool size %d", pool.maxSize, pool.poolSize)
+		}
+	}
+	if b.localPingThresholdMs != nil && *b.localPingThresholdMs < 0 {
+		return errors.Errorf("the local ping threshold must not be negative, but got %d", *b.localPingThresholdMs)
+	}
+	if b.maxArbiters < 0 {
+		return errors.Errorf("the maximum number of arbiters must not be negative, but got %d", b.maxArbiters)
+	}
+	if b.agentVersion != "" && !agentVersionPattern.MatchString(b.agentVersion) {
+		return errors.Errorf("invalid agent version %q, must look like 10.2.15.5958-1", b.agentVersion)
+	}
+	if b.processManagement != nil && b.processManagement.Fork && !b.notKubernetes {
+		return errors.Errorf("processes can't fork when running in Kubernetes, as the container would stop")
+	}
+	if b.replicaSetSettings != nil {
+		if err := validateReplicaSetSettings(*b.replicaSetSettings); err != nil {
+			return err
+		}
+	}
+	if b.containerMountPoints != nil && len(b.containerMountPoints) == 0 {
+		return errors.Errorf("at least one container mount point is required")
+	}
+	for _, mountPoint := range b.containerMountPoints {
+		if !path.IsAbs(mountPoint) {
+			return errors.Errorf("the container mount point %q must be an absolute path", mountPoint)
+		}
+	}
+	if b.authSchemaVersion != 0 {
+		if b.authSchemaVersion != 3 && b.authSchemaVersion != 5 {
+			return errors.Errorf("invalid auth schema version %d, must be one of 3 or 5", b.authSchemaVersion)
+		}
+		if previous := b.previousAuthSchemaVersion(); previous > b.authSchemaVersion {
+			return errors.Errorf("the auth schema version can't be downgraded from %d to %d", previous, b.authSchemaVersion)
+		}
+	}
+	if b.clusterRole != "" && b.clusterRole != ClusterRoleConfigServer && b.clusterRole != ClusterRoleShardServer {
+		return errors.Errorf("invalid cluster role %q, must be one of %s or %s", b.clusterRole, ClusterRoleConfigServer, ClusterRoleShardServer)
+	}
+	if b.clusterRole == ClusterRoleConfigServer && b.members < 1 {
+		return errors.Errorf("a config server replica set requires at least one member")
+	}
+	return nil
+}
+
+// logWarnings warns about configurations which are valid, but potentially unsafe.
+func (b *Builder) logWarnings(processes []Process) {
+	if b.writeConcernMajorityJournalDefault != nil && !*b.writeConcernMajorityJournalDefault && !hasNonJournaledProcess(processes) {
+		b.log.Warnf("writeConcernMajorityJournalDefault is disabled, but all members of replica set %s are journaled. "+
+			"Majority writes could be acknowledged before they are durable", b.name)
+	}
+	if b.forceReconfig {
+		b.log.Warnf("A forced reconfig of replica set %s was requested. This should only be used when a majority of the members "+
+			"is permanently lost, as writes acknowledged by the majority can be rolled back", b.name)
+	}
+	if b.tls.enabled() && b.tls.allowInvalidCertificates {
+		b.log.Warnf("TLS is configured to allow invalid certificates for replica set %s, this should only be used temporarily", b.name)
+	}
+	if b.tls.enabled() && b.tls.allowInvalidHostnames {
+		b.log.Warnf("TLS is configured to allow invalid hostnames for replica set %s, this should only be used temporarily", b.name)
+	}
+	if b.tls.enabled() && b.tls.weakCertificateValidation {
+		b.log.Warnf("TLS is configured with weak certificate validation for replica set %s, clients are accepted without "+
+			"a valid certificate. This should only be used while migrating legacy clients", b.name)
+	}
+	b.warnNewDataOnlyChange(processes, "storage.wiredTiger.collectionConfig.blockCompressor", "collections")
+	b.warnNewDataOnlyChange(processes, "storage.wiredTiger.indexConfig.prefixCompression", "indexes")
+	if b.wireObjectCheck != nil && !*b.wireObjectCheck {
+		b.log.Warnf("net.wireObjectCheck is disabled for replica set %s, invalid documents sent by clients can be stored", b.name)
+	}
+	if b.enableMajorityReadConcern != nil && !*b.enableMajorityReadConcern {
+		b.log.Warnf("The majority read concern is disabled for replica set %s, change streams and multi-document transactions "+
+			"will be unavailable", b.name)
+	}
+}
+
+// chainingDisabledWarningMembers is the number of members above which syncing them all from the primary, as
+// chaining is disabled, is a significant load.
+const chainingDisabledWarningMembers = 5
+
+// warnChainingDisabled logs a warning when chaining is disabled on a replica set with many members.
+func (b *Builder) warnChainingDisabled(ac AutomationConfig) {
+	for _, rs := range ac.ReplicaSets {
+		if rs.Settings == nil || rs.Settings.ChainingAllowed == nil || *rs.Settings.ChainingAllowed {
+			continue
+		}
+		if len(rs.Members) > chainingDisabledWarningMembers {
+			b.log.Warnf("Chaining is disabled for replica set %s, so all its %d members sync from the primary, which "+
+				"increases the load of the primary significantly", rs.Id, len(rs.Members))
+		}
+	}
+}
+
+// warnNewDataOnlyChange logs a warning when an option which only applies to new collections or indexes changed
+// compared to the previous AutomationConfig, as the existing data is not converted.
+func (b *Builder) warnNewDataOnlyChange(processes []Process, arg, applies string) {
+	previous := map[string]interface{}{}
+	for _, p := range b.previousAC.Processes {
+		previous[p.Name] = p.Args26.Get(arg).Data()
+	}
+	for _, p := range processes {
+		previousValue, existed := previous[p.Name]
+		value := p.Args26.Get(arg).Data()
+		if existed && fmt.Sprint(previousValue) != fmt.Sprint(value) {
+			b.log.Warnf("%s of replica set %s changed from %v to %v, it only applies to new %s, the existing ones are not converted",
+				arg, b.name, previousValue, value, applies)
+			return
+		}
+	}
+}
+
+// convertingStandalone returns true if the standalone of the previous AutomationConfig is converted by this build.
+func (b *Builder) convertingStandalone() bool {
+	return b.convertStandalone && len(b.previousAC.ReplicaSets) == 0 && len(b.previousAC.Processes) > 0
+}
+
+// validateStandalone ensures the previous AutomationConfig only has a single mongod, which isn't part of a
+// replica set and becomes the first member of the replica set.
+func (b *Builder) validateStandalone() error {
+	if len(b.previousAC.Processes) != 1 {
+		return errors.Errorf("only a standalone can be converted to a replica set, but the previous config has %d processes", len(b.previousAC.Processes))
+	}
+	standalone := b.previousAC.Processes[0]
+	if standalone.ProcessType != Mongod {
+		return errors.Errorf("only a standalone can be converted to a replica set, but %s is a %s", standalone.Name, standalone.ProcessType)
+	}
+	if replSetName := standalone.Args26.Get("replication.replSetName").Data(); replSetName != nil {
+		return errors.Errorf("only a standalone can be converted to a replica set, but %s is configured with replica set %v", standalone.Name, replSetName)
+	}
+	if name := toHostName(b.name, 0); standalone.Name != name {
+		return errors.Errorf("the standalone %s becomes the first member of the replica set, so it must be named %s", standalone.Name, name)
+	}
+	return nil
+}
+
+func (b *Builder) validateTLSLogVersions() error {
+	if !b.tls.enabled() {
+		return errors.Errorf("TLS log versions can only be configured when TLS is enabled")
+	}
+	if !isVersionAtLeast(b.mongodbVersion, 4, 4) {
+		return errors.Errorf("net.tls.logVersions requires MongoDB 4.4 or later, but got %s", b.mongodbVersion)
+	}
+	for _, version := range strings.Split(b.tls.logVersions, ",") {
+		switch strings.TrimSpace(version) {
+		case "TLS1_0", "TLS1_1", "TLS1_2", "TLS1_3":
+		default:
+			return errors.Errorf("invalid TLS log version %q, must be one of TLS1_0, TLS1_1, TLS1_2 or TLS1_3", version)
+		}
+	}
+	return nil
+}
+
+// ErrJournalCompressorChangeNotAllowed is returned when the journal compressor of a process of the previous
+// AutomationConfig changes, unless it was allowed with SetAllowJournalCompressorChange.
+var ErrJournalCompressorChangeNotAllowed = errors.New("the journal compressor can't be changed without explicitly allowing it")
+
+// ErrDowngradeFCVNotLowered is returned when the MongoDB version of a process of the previous AutomationConfig is
+// downgraded while its featureCompatibilityVersion is newer than the target version, unless it was allowed with
+// SetAllowUnsafeDowngrade.
+var ErrDowngradeFCVNotLowered = errors.New("the featureCompatibilityVersion must be lowered before downgrading the binaries")
+
+// ErrTLSDisableNotAllowed is returned when TLS is disabled on a process which had it enabled in the previous
+// AutomationConfig, unless it was allowed with SetAllowTLSDisable.
+var ErrTLSDisableNotAllowed = errors.New("TLS can't be disabled without explicitly allowing it")
+
+// ErrInvalidTLSModeTransition is returned when the TLS mode of a process skips an intermediate mode.
+var ErrInvalidTLSModeTransition = errors.New("invalid TLS mode transition")
+
+// tlsModeOrder is the order in which the TLS modes have to be enabled, or disabled.
+var tlsModeOrder = map[TLSMode]int{
+	TLSModeDisabled:  0,
+	TLSModeAllowed:   1,
+	TLSModePreferred: 2,
+	TLSModeRequired:  3,
+}
+
+// ErrEnterpriseFeatureOnCommunity is returned when a process uses a feature only available in MongoDB
+// Enterprise, but the builds of its version don't include the enterprise module.
+var ErrEnterpriseFeatureOnCommunity = errors.New("enterprise features require an enterprise build")
+
+// enterpriseOptions are the options of the features only available in MongoDB Enterprise.
+var enterpriseOptions = []string{"auditLog", "security.kmip", "security.ldap", "security.redactClientLogData"}
+
+// ErrBuildIndexesRequiresHidden is returned when a member which doesn't build indexes isn't hidden or has
+// a priority, which MongoDB rejects.
+var ErrBuildIndexesRequiresHidden = errors.New("members which don't build indexes must be hidden and have priority 0")
+
+// ErrOptionNotSupported is returned when an option is configured which doesn't exist in the MongoDB version
+// of the processes.
+var ErrOptionNotSupported = errors.New("option not supported by the MongoDB version")
+
+func validateBlockCompressor(compressor, version string) error {
+	switch compressor {
+	case "snappy", "zlib", "none":
+		return nil
+	case "zstd":
+		if !isVersionAtLeast(version, 4, 2) {
+			return errors.Wrapf(ErrOptionNotSupported, "the zstd block compressor requires MongoDB 4.2 or later, but got %s", version)
+		}
+		return nil
+	}
+	return errors.Errorf("invalid block compressor %q, must be one of snappy, zlib, zstd or none", compressor)
+}
+
+func validateJournalCompressor(compressor, version string) error {
+	switch compressor {
+	case "snappy", "zlib", "none":
+		return nil
+	case "zstd":
+		if !isVersionAtLeast(version, 4, 2) {
+			return errors.Wrapf(ErrOptionNotSupported, "the zstd journal compressor requires MongoDB 4.2 or later, but got %s", version)
+		}
+		return nil
+	}
+	return errors.Errorf("invalid journal compressor %q, must be one of snappy, zlib, zstd or none", compressor)
+}
+
+func validateSecondaryIndexPrefetch(mode, version string) error {
+	if isVersionAtLeast(version, 3, 2) {
+		return errors.Wrapf(ErrOptionNotSupported, "replication.secondaryIndexPrefetch was removed in MongoDB 3.2, but got %s", version)
+	}
+	switch mode {
+	case "none", "_id_only", "all":
+		return nil
+	}
+	return errors.Errorf("invalid secondary index prefetch %q, must be one of none, _id_only or all", mode)
+}
+
+// ErrArbiterWithStorageOptions is returned when the process of an arbiter is configured with storage options.
+// Arbiters don't hold any data, so the agent doesn't expect them to have storage options.
+var ErrArbiterWithStorageOptions = errors.New("arbiters can't have storage options")
+
+// validateMemberClusters ensures that, in multi-cluster mode, every member is assigned to a cluster, and that
+// the clusters are only assigned in multi-cluster mode.
+func (b *Builder) validateMemberClusters() error {
+	if !b.multiClusterMode {
+		if len(b.memberClusters) > 0 {
+			return errors.Errorf("the clusters of the members can only be configured in multi-cluster mode")
+		}
+		return nil
+	}
+	for index := range b.memberClusters {
+		if index < 0 || index >= b.memberCount() {
+			return errors.Errorf("a cluster is configured for member %d, but the replica set has %d members", index, b.memberCount())
+		}
+	}
+	for index := 0; index < b.memberCount(); index++ {
+		if b.memberClusters[index] == "" {
+			return errors.Errorf("member %d of replica set %s has no cluster, but every member needs one in multi-cluster mode", index, b.name)
+		}
+	}
+	return nil
+}
+
+// validateAutomationConfig ensures the assembled AutomationConfig is valid. Unlike validate, this
+// takes into account the changes made by modifications and mutators.
+func (b *Builder) validateAutomationConfig(ac AutomationConfig) error {
+	if err := validateAuthSchemaVersion(ac); err != nil {
+		return err
+	}
+	if err := validateAuthMechanisms(ac); err != nil {
+		return err
+	}
+	if err := validateClusterRoles(ac); err != nil {
+		return err
+	}
+	if err := validateMajorityReadConcern(ac); err != nil {
+		return err
+	}
+	if err := b.validateReadOnlyUsers(ac); err != nil {
+		return err
+	}
+	if b.changeStreams {
+		if err := validateChangeStreamProcesses(ac); err != nil {
+			return err
+		}
+	}
+	if b.containerMode {
+		if err := b.validateContainerPaths(ac); err != nil {
+			return err
+		}
+	}
+	if err := validateEnterpriseFeatures(ac); err != nil {
+		return err
+	}
+	if previousId := b.previousReplicaSetId(); previousId != "" {
+		for _, rs := range ac.ReplicaSets {
+			if rs.Id == b.name && (rs.Settings == nil || rs.Settings.ReplicaSetId != previousId) {
+				return errors.Errorf("the replicaSetId of replica set %s can't be changed from %s", rs.Id, previousId)
+			}
+		}
+	}
+	if !b.tls.allowDisable {
+		if err := validateTLSNotDisabled(b.previousAC, ac); err != nil {
+			return err
+		}
+	}
+	if !b.allowJournalCompressorChange {
+		if err := validateJournalCompressorUnchanged(b.previousAC, ac); err != nil {
+			return err
+		}
+	}
+	if !b.allowUnsafeDowngrade {
+		if err := validateDowngradeFCV(b.previousAC, ac); err != nil {
+			return err
+		}
+	}
+	if err := validateTLSConsistency(ac, len(b.tls.memberCertificateKeyFiles) > 0); err != nil {
+		return err
+	}
+	if b.tls.rollingValidation {
+		if err := validateTLSModeTransitions(b.previousAC, ac); err != nil {
+			return err
+		}
+	}
+	if err := b.validateRemovedMembers(ac); err != nil {
+		return err
+	}
+	if !b.allowMinorityScaleDown {
+		if err := b.validateScaleDown(ac); err != nil {
+			return err
+		}
+	}
+	if b.incrementalReconfigValidation {
+		if err := b.validateIncrementalReconfig(ac); err != nil {
+			return err
+		}
+	}
+	for _, rs := range ac.ReplicaSets {
+		if err := validateMembers(rs); err != nil {
+			return err
+		}
+		if err := validateArbiterProcesses(rs, ac.Processes); err != nil {
+			return err
+		}
+		if err := validateWriteConcernModes(rs); err != nil {
+			return err
+		}
+		if arbiters := arbiterCount(rs); arbiters > b.maxArbiters {
+			return errors.Errorf("replica set %s has %d arbiters, but at most %d are allowed. Consider adding data bearing members instead", rs.Id, arbiters, b.maxArbiters)
+		}
+		if !rs.ConfigServer {
+			continue
+		}
+		for _, m := range rs.Members {
+			if m.ArbiterOnly {
+				return errors.Errorf("config server replica set %s can't have arbiters, but %s is an arbiter", rs.Id, m.Host)
+			}
+		}
+	}
+	return nil
+}
+
+// serverAuthMechanisms maps the deploymentAuthMechanisms whose name differs from the one of their
+// setParameter.authenticationMechanisms.
+var serverAuthMechanisms = map[string]string{
+	"MONGODB-CR": "SCRAM-SHA-1",
+}
+
+// serverAuthMechanismsOf returns the setParameter.authenticationMechanisms matching the deploymentAuthMechanisms.
+func serverAuthMechanismsOf(deploymentMechanisms []string) string {
+	mechanisms := make([]string, len(deploymentMechanisms))
+	for i, mechanism := range deploymentMechanisms {
+		if serverMechanism, ok := serverAuthMechanisms[mechanism]; ok {
+			mechanism = serverMechanism
+		}
+		mechanisms[i] = mechanism
+	}
+	sort.Strings(mechanisms)
+	return strings.Join(mechanisms, ",")
+}
+
+// configureAuthMechanisms sets the mechanisms configured with SetAuthMechanisms, and the matching
+// setParameter.authenticationMechanisms of the processes.
+func (b *Builder) configureAuthMechanisms(ac *AutomationConfig) error {
+	if b.authMechanisms == nil {
+		return nil
+	}
+	if len(b.authMechanisms) == 0 {
+		return errors.Errorf("at least one auth mechanism is required")
+	}
+	if ac.Auth.Disabled {
+		return errors.Errorf("the auth mechanisms can only be configured when authentication is enabled")
+	}
+	ac.Auth.DeploymentAuthMechanisms = b.authMechanisms
+	for i := range ac.Processes {
+		ac.Processes[i].Args26.Set("setParameter.authenticationMechanisms", serverAuthMechanismsOf(b.authMechanisms))
+	}
+	return nil
+}
+
+// validateAuthMechanisms ensures the setParameter.authenticationMechanisms of the processes which configure it
+// match the deploymentAuthMechanisms, otherwise clients fail to authenticate with some of the mechanisms.
+func validateAuthMechanisms(ac AutomationConfig) error {
+	expected := serverAuthMechanismsOf(ac.Auth.DeploymentAuthMechanisms)
+	for _, p := range ac.Processes {
+		value := p.Args26.Get("setParameter.authenticationMechanisms").Data()
+		if value == nil {
+			continue
+		}
+		actual := serverAuthMechanismsOf(strings.Split(fmt.Sprint(value), ","))
+		if ac.Auth.Disabled || actual != expected {
+			return errors.Errorf("the authenticationMechanisms %s of process %s don't match the deployment auth mechanisms %s",
+				value, p.Name, strings.Join(ac.Auth.DeploymentAuthMechanisms, ","))
+		}
+	}
+	return nil
+}
+
+// validateAuthSchemaVersion ensures every process uses the same auth schema version, and that
+// the SCRAM mechanisms are only used with a schema version which supports them.
+func validateAuthSchemaVersion(ac AutomationConfig) error {
+	for _, p := range ac.Processes {
+		if p.AuthSchemaVersion != ac.Processes[0].AuthSchemaVersion {
+			return errors.Errorf("all processes must have the same auth schema version, but %s has %d and %s has %d",
+				ac.Processes[0].Name, ac.Processes[0].AuthSchemaVersion, p.Name, p.AuthSchemaVersion)
+		}
+	}
+	if len(ac.Processes) == 0 || ac.Processes[0].AuthSchemaVersion != 3 || ac.Auth.Disabled {
+		return nil
+	}
+	for _, mechanism := range ac.Auth.DeploymentAuthMechanisms {
+		if strings.HasPrefix(mechanism, "SCRAM-") {
+			return errors.Errorf("%s requires auth schema version 5, but it is 3", mechanism)
+		}
+	}
+	return nil
+}
+
+// validateRemovedMembers ensures the removed members are members of the previous AutomationConfig, and
+// that a data bearing member of it is kept.
+func (b *Builder) validateRemovedMembers(ac AutomationConfig) error {
+	if len(b.removedHosts) == 0 {
+		return nil
+	}
+	previousMembers := b.previousMembers()
+	for _, host := range b.removedHosts {
+		found := false
+		for _, m := range previousMembers {
+			if m.Host == host {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("%s can't be removed, as it isn't a member of replica set %s in the previous config", host, b.name)
+		}
+	}
+	for _, rs := range ac.ReplicaSets {
+		if rs.Id != b.name {
+			continue
+		}
+		kept := map[string]bool{}
+		for _, m := range rs.Members {
+			kept[m.Host] = true
+		}
+		for _, m := range previousMembers {
+			if !m.ArbiterOnly && kept[m.Host] {
+				return nil
+			}
+		}
+		return errors.Errorf("removing %s from replica set %s doesn't keep any of its data bearing members", strings.Join(b.removedHosts, ", "), rs.Id)
+	}
+	return nil
+}
+
+// validateScaleDown ensures that, when several voting members are removed, the voting members of the previous
+// config which are kept are a majority of its voting members. Removing one voting member per reconfig is always
+// safe, so the replica set can be scaled down one member at a time, e.g. from 2 to 1 member.
+func (b *Builder) validateScaleDown(ac AutomationConfig) error {
+	previousMembers := b.previousMembers()
+	for _, rs := range ac.ReplicaSets {
+		if rs.Id != b.name || (len(rs.Members) >= len(previousMembers) && len(b.removedHosts) == 0) {
+			continue
+		}
+		previousVoters := map[string]bool{}
+		for _, m := range previousMembers {
+			if m.Votes > 0 {
+				previousVoters[m.Host] = true
+			}
+		}
+		remainingVoters := 0
+		for _, m := range rs.Members {
+			if m.Votes > 0 && previousVoters[m.Host] {
+				remainingVoters++
+			}
+		}
+		majority := len(previousVoters)/2 + 1
+		// the number of voting members which can be removed at once while keeping a majority, at least one
+		removableVoters := len(previousVoters) - majority
+		if removableVoters < 1 {
+			removableVoters = 1
+		}
+		removedVoters := len(previousVoters) - remainingVoters
+		if removedVoters <= removableVoters {
+			continue
+		}
+		if len(b.removedHosts) > 0 {
+			return errors.Errorf("removing %s from replica set %s keeps %d of its %d voting members, which isn't a majority. Remove at most %d voting members at once instead",
+				strings.Join(b.removedHosts, ", "), rs.Id, remainingVoters, len(previousVoters), removableVoters)
+		}
+		// the members which keep a majority, less than the previous ones as at least one member can be removed
+		minMembers := len(rs.Members) + removedVoters - removableVoters
+		if minMembers >= len(previousMembers) {
+			minMembers = len(previousMembers) - 1
+		}
+		return errors.Errorf("scaling down replica set %s from %d to %d members keeps %d of its %d voting members, which isn't a majority. Scale down to at least %d members instead",
+			rs.Id, len(previousMembers), len(rs.Members), remainingVoters, len(previousVoters), minMembers)
+	}
+	return nil
+}
+
+// ErrUnsafeSimultaneousReconfig is returned when the members change in ways MongoDB doesn't allow in a single
+// reconfig. The changes have to be applied in several steps.
+var ErrUnsafeSimultaneousReconfig = errors.New("the replica set changes can't be applied in a single reconfig")
+
+// validateIncrementalReconfig ensures the members of the replica set change in ways a single reconfig allows:
+// arbiterOnly and buildIndexes can't be changed on existing members and, from MongoDB 4.4, the votes of at most
+// one member can change, including the members which are added or removed. Force reconfigs skip the votes check.
+func (b *Builder) validateIncrementalReconfig(ac AutomationConfig) error {
+	previousMembers := map[string]ReplicaSetMember{}
+	for _, m := range b.previousMembers() {
+		previousMembers[m.Host] = m
+	}
+	if len(previousMembers) == 0 {
+		return nil
+	}
+	for _, rs := range ac.ReplicaSets {
+		if rs.Id != b.name {
+			continue
+		}
+		var votesChanged []string
+		current := map[string]bool{}
+		for _, m := range rs.Members {
+			current[m.Host] = true
+			previous, ok := previousMembers[m.Host]
+			if !ok {
+				if m.Votes > 0 {
+					votesChanged = append(votesChanged, m.Host)
+				}
+				continue
+			}
+			if previous.ArbiterOnly != m.ArbiterOnly {
+				return errors.Wrapf(ErrUnsafeSimultaneousReconfig, "member %s of replica set %s changes arbiterOnly, which MongoDB doesn't allow. Remove the member, then add it again in a second step", m.Host, rs.Id)
+			}
+			if buildsIndexes(previous) != buildsIndexes(m) {
+				return errors.Wrapf(ErrUnsafeSimultaneousReconfig, "member %s of replica set %s changes buildIndexes, which MongoDB doesn't allow. Remove the member, then add it again in a second step", m.Host, rs.Id)
+			}
+			if (previous.Votes > 0) != (m.Votes > 0) {
+				votesChanged = append(votesChanged, m.Host)
+			}
+		}
+		for _, m := range b.previousMembers() {
+			if !current[m.Host] && m.Votes > 0 {
+				votesChanged = append(votesChanged, m.Host)
+			}
+		}
+		if len(votesChanged) > 1 && rs.Force == nil && isVersionAtLeast(b.mongodbVersion, 4, 4) {
+			return errors.Wrapf(ErrUnsafeSimultaneousReconfig, "the votes of %d members of replica set %s change (%s), but MongoDB allows changing the votes of one member per reconfig. Apply the change in %d steps, one member at a time",
+				len(votesChanged), rs.Id, strings.Join(votesChanged, ", "), len(votesChanged))
+		}
+	}
+	return nil
+}
+
+// buildsIndexes returns true if the member builds indexes, which is the default.
+func buildsIndexes(m ReplicaSetMember) bool {
+	return m.BuildIndexes == nil || *m.BuildIndexes
+}
+
+// ErrInconsistentTLSAcrossProcesses is returned when the processes don't all have the same TLS mode, CA file and
+// certificate. The members of a replica set with different TLS settings can't connect to each other.
+var ErrInconsistentTLSAcrossProcesses = errors.New("the TLS settings of the processes are inconsistent")
+
+// processTLSSettings are the TLS settings every process needs to have in common.
+type processTLSSettings struct {
+	mode        TLSMode
+	caFile      string
+	certificate string
+}
+
+func tlsSettingsOf(p Process) processTLSSettings {
+	settings := processTLSSettings{mode: tlsModeOrDisabled(p)}
+	if caFile := tlsArgOf(p, "CAFile"); caFile != nil {
+		settings.caFile = fmt.Sprint(caFile)
+	}
+	if certificate := tlsArgOf(p, "certificateKeyFile"); certificate != nil {
+		settings.certificate = fmt.Sprint(certificate)
+	} else if selector := tlsArgOf(p, "certificateSelector"); selector != nil {
+		settings.certificate = fmt.Sprint(selector)
+	}
+	return settings
+}
+
+// validateTLSConsistency ensures every process has the TLS settings most of the processes have, and returns
+// the processes which don't otherwise. The certificates are not compared when the members have their own.
+func validateTLSConsistency(ac AutomationConfig, memberCertificates bool) error {
+	if len(ac.Processes) == 0 {
+		return nil
+	}
+	settingsOf := func(p Process) processTLSSettings {
+		settings := tlsSettingsOf(p)
+		if memberCertificates {
+			settings.certificate = ""
+		}
+		return settings
+	}
+	counts := map[processTLSSettings]int{}
+	common := settingsOf(ac.Processes[0])
+	for _, p := range ac.Processes {
+		settings := settingsOf(p)
+		counts[settings]++
+		if counts[settings] > counts[common] {
+			common = settings
+		}
+	}
+	divergent := []string{}
+	for _, p := range ac.Processes {
+		if settingsOf(p) != common {
+			divergent = append(divergent, p.Name)
+		}
+	}
+	if len(divergent) > 0 {
+		return errors.Wrapf(ErrInconsistentTLSAcrossProcesses, "processes %s don't have TLS mode %s, CA file %q and certificate %q like the others",
+			strings.Join(divergent, ", "), common.mode, common.caFile, common.certificate)
+	}
+	return nil
+}
+
+// validateTLSNotDisabled ensures TLS stays enabled on every process which had it enabled in the previous config.
+func validateTLSNotDisabled(previous, current AutomationConfig) error {
+	enabled := map[string]bool{}
+	for _, p := range previous.Processes {
+		enabled[p.Name] = tlsModeOrDisabled(p) != TLSModeDisabled
+	}
+	for _, p := range current.Processes {
+		if enabled[p.Name] && tlsModeOrDisabled(p) == TLSModeDisabled {
+			return errors.Wrapf(ErrTLSDisableNotAllowed, "TLS can't be disabled on %s", p.Name)
+		}
+	}
+	return nil
+}
+
+// journalCompressorOf returns the journal compressor of the process, which is snappy if it isn't configured.
+func journalCompressorOf(p Process) string {
+	if compressor := p.Args26.Get("storage.wiredTiger.engineConfig.journalCompressor").Data(); compressor != nil {
+		return fmt.Sprint(compressor)
+	}
+	return "snappy"
+}
+
+// validateJournalCompressorUnchanged ensures the processes which are in both configs keep their journal compressor.
+func validateJournalCompressorUnchanged(previous, current AutomationConfig) error {
+	compressors := map[string]string{}
+	for _, p := range previous.Processes {
+		compressors[p.Name] = journalCompressorOf(p)
+	}
+	for _, p := range current.Processes {
+		if from, ok := compressors[p.Name]; ok && from != journalCompressorOf(p) {
+			return errors.Wrapf(ErrJournalCompressorChangeNotAllowed, "the journal compressor of %s can't be changed from %s to %s", p.Name, from, journalCompressorOf(p))
+		}
+	}
+	return nil
+}
+
+// validateDowngradeFCV ensures that the processes whose version is downgraded to an older major.minor already had
+// their featureCompatibilityVersion lowered to at most that major.minor in the previous AutomationConfig. Patch
+// downgrades don't depend on the featureCompatibilityVersion.
+func validateDowngradeFCV(previous, current AutomationConfig) error {
+	previousProcesses := map[string]Process{}
+	for _, p := range previous.Processes {
+		previousProcesses[p.Name] = p
+	}
+	for _, p := range current.Processes {
+		from, ok := previousProcesses[p.Name]
+		if !ok {
+			continue
+		}
+		fromMajor, fromMinor, ok := parseMajorMinor(from.Version)
+		if !ok || isVersionAtLeast(p.Version, fromMajor, fromMinor) {
+			continue
+		}
+		fcvMajor, fcvMinor, ok := parseMajorMinor(from.FeatureCompatibilityVersion)
+		if !ok || isVersionAtLeast(p.Version, fcvMajor, fcvMinor) {
+			continue
+		}
+		target, _ := majorMinorOf(p.Version)
+		return errors.Wrapf(ErrDowngradeFCVNotLowered, "%s can't be downgraded from %s to %s while its featureCompatibilityVersion is %s, lower it to %s first",
+			p.Name, from.Version, p.Version, from.FeatureCompatibilityVersion, target)
+	}
+	return nil
+}
+
+// validateTLSModeTransitions ensures the TLS mode of every process which is in both configs changes by
+// at most one step. Processes without a TLS mode are considered disabled.
+func validateTLSModeTransitions(previous, current AutomationConfig) error {
+	previousModes := map[string]TLSMode{}
+	for _, p := range previous.Processes {
+		previousModes[p.Name] = tlsModeOrDisabled(p)
+	}
+	for _, p := range current.Processes {
+		from, ok := previousModes[p.Name]
+		if !ok {
+			continue
+		}
+		to := tlsModeOrDisabled(p)
+		step := tlsModeOrder[to] - tlsModeOrder[from]
+		if step > 1 || step < -1 {
+			return errors.Wrapf(ErrInvalidTLSModeTransition, "the TLS mode of %s can't change from %s to %s in one step", p.Name, from, to)
+		}
+	}
+	return nil
+}
+
+func tlsModeOrDisabled(p Process) TLSMode {
+	if mode := tlsModeOf(p); mode != "" {
+		return mode
+	}
+	return TLSModeDisabled
+}
+
+// validateEnterpriseFeatures ensures the builds of every version agree on whether they are enterprise builds,
+// and that enterprise features are only used by processes whose version has enterprise builds. Processes with
+// a version which isn't part of the config are not validated.
+func validateEnterpriseFeatures(ac AutomationConfig) error {
+	enterprise := map[string]bool{}
+	for _, version := range ac.Versions {
+		for i, build := range version.Builds {
+			isEnterprise := isEnterpriseBuild(build)
+			if i > 0 && isEnterprise != enterprise[version.Name] {
+				return errors.Errorf("the builds of version %s must either all or none include the enterprise module", version.Name)
+			}
+			enterprise[version.Name] = isEnterprise
+		}
+	}
+	for _, p := range ac.Processes {
+		isEnterprise, ok := enterprise[p.Version]
+		if !ok || isEnterprise {
+			continue
+		}
+		for _, option := range enterpriseOptions {
+			if p.Args26.Get(option).Data() != nil {
+				return errors.Wrapf(ErrEnterpriseFeatureOnCommunity, "process %s configures %s, but version %s is not an enterprise build", p.Name, option, p.Version)
+			}
+		}
+	}
+	return nil
+}
+
+func isEnterpriseBuild(build BuildConfig) bool {
+	for _, module := range build.Modules {
+		if module == "enterprise" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateClusterRoles ensures a sharded deployment, i.e. one with shard server processes, has exactly one
+// config server replica set.
+func validateClusterRoles(ac AutomationConfig) error {
+	configServers := 0
+	for _, rs := range ac.ReplicaSets {
+		if rs.ConfigServer {
+			configServers++
+		}
+	}
+	if configServers > 1 {
+		return errors.Errorf("a deployment can only have one config server replica set, but it has %d", configServers)
+	}
+	for _, p := range ac.Processes {
+		if fmt.Sprint(p.Args26.Get("sharding.clusterRole").Data()) == string(ClusterRoleShardServer) && configServers != 1 {
+			return errors.Errorf("a sharded deployment requires a config server replica set, but %s is a shard server without one", p.Name)
+		}
+	}
+	return nil
+}
+
+func arbiterCount(rs ReplicaSet) int {
+	count := 0
+	for _, m := range rs.Members {
+		if m.ArbiterOnly {
+			count++
+		}
+	}
+	return count
+}
+
+// validateWriteConcernModes ensures every tag referenced by a write concern mode has enough distinct
+// values on the members to ever be satisfied.
+func validateWriteConcernModes(rs ReplicaSet) error {
+	if rs.Settings == nil {
+		return nil
+	}
+	for mode, tags := range rs.Settings.GetLastErrorModes {
+		for tag, count := range tags {
+			values := map[string]bool{}
+			for _, m := range rs.Members {
+				if value, ok := m.Tags[tag]; ok {
+					values[value] = true
+				}
+			}
+			if len(values) == 0 {
+				return errors.Errorf("write concern mode %s references tag %s, but no member of replica set %s has it", mode, tag, rs.Id)
+			}
+			if count < 1 || count > len(values) {
+				return errors.Errorf("write concern mode %s requires %d distinct values of tag %s, but replica set %s has %d", mode, count, tag, rs.Id, len(values))
+			}
+		}
+	}
+	return nil
+}
+
+// validateArbiterProcesses ensures the processes of the arbiters of the replica set have no storage options.
+func validateArbiterProcesses(rs ReplicaSet, processes []Process) error {
+	for _, m := range rs.Members {
+		if !m.ArbiterOnly {
+			continue
+		}
+		for _, p := range processes {
+			if p.Name != m.Host {
+				continue
+			}
+			if option := storageOptionOf(p); option != "" {
+				return errors.Wrapf(ErrArbiterWithStorageOptions, "arbiter %s of replica set %s has %s", m.Host, rs.Id, option)
+			}
+		}
+	}
+	return nil
+}
+
+// storageOptionOf returns the name of a storage option configured for the process, or "" if it has none.
+// The dbPath isn't considered, as arbiters still need it.
+func storageOptionOf(p Process) string {
+	if p.WiredTiger.EngineConfig.CacheSizeGB != 0 {
+		return "wiredTiger.engineConfig.cacheSizeGB"
+	}
+	for _, option := range []string{"storage.engine", "storage.wiredTiger", "storage.inMemory", "replication.oplogSizeMB"} {
+		if p.Args26.Get(option).Data() != nil {
+			return option
+		}
+	}
+	return ""
+}
+
+// maxReplicaSetMembers and maxVotingMembers are the limits MongoDB puts on the members of a replica set.
+const (
+	maxReplicaSetMembers = 50
+	maxVotingMembers     = 7
+)
+
+// validateMembers ensures the votes and priorities of the members allow the replica set to elect a primary,
+// and that there aren't more members, or voting members, than MongoDB allows.
+func validateMembers(rs ReplicaSet) error {
+	if len(rs.Members) == 0 {
+		return nil
+	}
+	if len(rs.Members) > maxReplicaSetMembers {
+		return errors.Errorf("replica set %s has %d members, including arbiters and non-voting members, but MongoDB allows at most %d", rs.Id, len(rs.Members), maxReplicaSetMembers)
+	}
+	voting := 0
+	for _, m := range rs.Members {
+		if m.Votes > 0 {
+			voting++
+		}
+	}
+	if voting > maxVotingMembers {
+		return errors.Errorf("replica set %s has %d voting members, but MongoDB allows at most %d. Make the other members non-voting", rs.Id, voting, maxVotingMembers)
+	}
+	electable := false
+	for _, m := range rs.Members {
+		if m.Votes == 0 && m.Priority > 0 {
+			return errors.Errorf("member %s of replica set %s has priority %d, but members without votes must have priority 0", m.Host, rs.Id, m.Priority)
+		}
+		if isDelayed(m) && (m.Priority > 0 || m.Votes > 0) {
+			return errors.Errorf("member %s of replica set %s is delayed, so it must have priority 0 and votes 0, but has priority %d and votes %d", m.Host, rs.Id, m.Priority, m.Votes)
+		}
+		if m.Hidden && m.Priority > 0 {
+			return errors.Errorf("member %s of replica set %s has priority %d, but hidden members must have priority 0", m.Host, rs.Id, m.Priority)
+		}
+		if m.BuildIndexes != nil && !*m.BuildIndexes && (!m.Hidden || m.Priority > 0) {
+			return errors.Wrapf(ErrBuildIndexesRequiresHidden, "member %s of replica set %s doesn't build indexes", m.Host, rs.Id)
+		}
+		if m.Votes > 0 && m.Priority > 0 && !m.ArbiterOnly {
+			electable = true
+		}
+	}
+	if !electable {
+		return errors.Errorf("replica set %s has no member which can become primary", rs.Id)
+	}
+	return nil
+}
+
+// logComponents are the components whose log verbosity can be configured.
+var logComponents = map[string]bool{
+	"accessControl":           true,
+	"command":                 true,
+	"control":                 true,
+	"ftdc":                    true,
+	"geo":                     true,
+	"index":                   true,
+	"network":                 true,
+	"query":                   true,
+	"recovery":                true,
+	"replication":             true,
+	"replication.election":    true,
+	"replication.heartbeats":  true,
+	"replication.initialSync": true,
+	"replication.rollback":    true,
+	"sharding":                true,
+	"storage":                 true,
+	"storage.journal":         true,
+	"storage.recovery":        true,
+	"transaction":             true,
+	"write":                   true,
+}
+
+func validateComponentVerbosity(verbosity map[string]int) error {
+	components := make([]string, 0, len(verbosity))
+	for component := range verbosity {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	for _, component := range components {
+		if !logComponents[component] {
+			return errors.Errorf("unknown log component %q", component)
+		}
+		if level := verbosity[component]; level < 0 || level > 5 {
+			return errors.Errorf("the log verbosity of component %s must be between 0 and 5, but got %d", component, level)
+		}
+	}
+	return nil
+}
+
+func validateAgentSettings(settings AgentSettings) error {
+	switch settings.LogLevel {
+	case "", "DEBUG", "INFO", "WARN", "ERROR", "FATAL":
+	default:
+		return errors.Errorf("invalid agent log level %q, must be one of DEBUG, INFO, WARN, ERROR or FATAL", settings.LogLevel)
+	}
+	if settings.MaxRetries < 0 || settings.MaxRetries > 100 {
+		return errors.Errorf("the agent max retries must be between 0 and 100, but got %d", settings.MaxRetries)
+	}
+	if settings.HealthCheckIntervalSeconds < 0 || settings.HealthCheckIntervalSeconds > 3600 {
+		return errors.Errorf("the agent health check interval must be between 0 and 3600 seconds, but got %d", settings.HealthCheckIntervalSeconds)
+	}
+	if settings.DialTimeoutSeconds < 0 {
+		return errors.Errorf("the agent dial timeout must be positive, but got %d seconds", settings.DialTimeoutSeconds)
+	}
+	return nil
+}
+
+// validateContainerPaths checks that the paths the agent and the processes write to are on a mount point,
+// and that the processes don't fork, as the container would stop.
+func (b *Builder) validateContainerPaths(ac AutomationConfig) error {
+	mountPoints := b.containerMountPoints
+	if mountPoints == nil {
+		mountPoints = defaultContainerMountPoints
+	}
+	onMountPoint := func(p string) bool {
+		p = path.Clean(p)
+		for _, mountPoint := range mountPoints {
+			mountPoint = path.Clean(mountPoint)
+			if p == mountPoint || mountPoint == "/" || strings.HasPrefix(p, mountPoint+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !onMountPoint(ac.Options.DownloadBase) {
+		return errors.Errorf("the download base %s is not on any of the mount points %s", ac.Options.DownloadBase, strings.Join(mountPoints, ", "))
+	}
+	for _, p := range ac.Processes {
+		if dbPath, ok := p.Args26.Get("storage.dbPath").Data().(string); ok && !onMountPoint(dbPath) {
+			return errors.Errorf("the dbPath %s of process %s is not on any of the mount points %s", dbPath, p.Name, strings.Join(mountPoints, ", "))
+		}
+		if p.SystemLog.Destination == "file" && !onMountPoint(p.SystemLog.Path) {
+			return errors.Errorf("the log path %s of process %s is not on any of the mount points %s", p.SystemLog.Path, p.Name, strings.Join(mountPoints, ", "))
+		}
+		if p.Args26.Get("processManagement.fork").Data() == true {
+			return errors.Errorf("process %s can't fork when running in a container, as the container would stop", p.Name)
+		}
+	}
+	return nil
+}
+
+// validateChangeStreams ensures the options of the Builder don't conflict with the prerequisites of change streams.
+func (b *Builder) validateChangeStreams() error {
+	if !isVersionAtLeast(b.mongodbVersion, 3, 6) {
+		return errors.Wrapf(ErrOptionNotSupported, "change streams require MongoDB 3.6 or later, but got %s", b.mongodbVersion)
+	}
+	if fcv := b.effectiveFCV(); fcv != "" && !isVersionAtLeast(fcv, 3, 6) {
+		return errors.Errorf("change streams require a featureCompatibilityVersion of at least 3.6, but got %s", fcv)
+	}
+	if b.enableMajorityReadConcern != nil && !*b.enableMajorityReadConcern {
+		return errors.Errorf("change streams require the majority read concern, but it is disabled")
+	}
+	return nil
+}
+
+// validateChangeStreamProcesses rejects processes which can't serve change streams, because the majority read
+// concern was disabled, e.g. by a modification, or they use the MMAPv1 storage engine.
+func validateChangeStreamProcesses(ac AutomationConfig) error {
+	for _, p := range ac.Processes {
+		if p.ProcessType != Mongod {
+			continue
+		}
+		if p.Args26.Get("replication.enableMajorityReadConcern").Data() == false {
+			return errors.Errorf("change streams require the majority read concern, but it is disabled for process %s", p.Name)
+		}
+		if p.Args26.Get("storage.engine").Data() == "mmapv1" {
+			return errors.Errorf("change streams don't support the MMAPv1 storage engine, which process %s uses", p.Name)
+		}
+	}
+	return nil
+}
+
+// majorityReadConcernLevels are the read concern levels which require the majority read concern to be enabled.
+var majorityReadConcernLevels = map[string]bool{"majority": true, "linearizable": true}
+
+// validateMajorityReadConcern rejects processes which have the majority read concern disabled while the
+// config requires it, i.e. a default read concern needs majority reads.
+func validateMajorityReadConcern(ac AutomationConfig) error {
+	for _, p := range ac.Processes {
+		if p.Args26.Get("replication.enableMajorityReadConcern").Data() != false {
+			continue
+		}
+		for _, q := range ac.Processes {
+			if q.DefaultRWConcern == nil || q.DefaultRWConcern.DefaultReadConcern == nil {
+				continue
+			}
+			if level := q.DefaultRWConcern.DefaultReadConcern.Level; majorityReadConcernLevels[level] {
+				return errors.Errorf("process %s has the majority read concern disabled, but the default read concern %s requires it", p.Name, level)
+			}
+		}
+	}
+	return nil
+}
+
+// minHeartbeatIntervalMillis is the shortest heartbeat interval supported, more frequent heartbeats would
+// only add load without detecting failures sooner.
+const minHeartbeatIntervalMillis = 500
+
+func validateReplicaSetSettings(settings ReplicaSetSettings) error {
+	if t := settings.ElectionTimeoutMillis; t != nil && *t <= 0 {
+		return errors.Errorf("the election timeout must be positive, but got %d", *t)
+	}
+	if t := settings.HeartbeatTimeoutSecs; t != nil && *t <= 0 {
+		return errors.Errorf("the heartbeat timeout must be positive, but got %d", *t)
+	}
+	if t := settings.HeartbeatIntervalMillis; t != nil && *t < minHeartbeatIntervalMillis {
+		return errors.Errorf("the heartbeat interval must be at least %d milliseconds, but got %d", minHeartbeatIntervalMillis, *t)
+	}
+	if t := settings.CatchUpTimeoutMillis; t != nil && *t < -1 {
+		return errors.Errorf("the catch up timeout must be -1 or more, but got %d", *t)
+	}
+	if t := settings.CatchUpTakeoverDelayMillis; t != nil && *t < -1 {
+		return errors.Errorf("the catch up takeover delay must be -1 or more, but got %d", *t)
+	}
+	return nil
+}
+
+var cpuListPattern = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
+// validateCPUList checks that the CPU list is a comma-separated list of CPUs and ascending ranges, e.g. "0-3,8".
+func validateCPUList(cpus string) error {
+	if !cpuListPattern.MatchString(cpus) {
+		return errors.Errorf("%q is not a list of CPUs such as \"0-3,8\"", cpus)
+	}
+	for _, item := range strings.Split(cpus, ",") {
+		bounds := strings.SplitN(item, "-", 2)
+		if len(bounds) < 2 {
+			continue
+		}
+		first, _ := strconv.Atoi(bounds[0])
+		last, _ := strconv.Atoi(bounds[1])
+		if first > last {
+			return errors.Errorf("the CPU range %q is descending", item)
+		}
+	}
+	return nil
+}
+
+var configDBPattern = regexp.MustCompile(`^[^/,]+/[^/,:]+:\d+(,[^/,:]+:\d+)*$`)
+
+var agentVersionPattern = regexp.MustCompile(`^\d+(\.\d+){1,3}(-\d+)?$`)
+
+// agentStartupArgNames are the automation agent flags which can be configured with SetAgentStartupArgs.
+var agentStartupArgNames = []string{
+	"dialTimeoutSeconds",
+	"healthCheckFilePath",
+	"httpProxy",
+	"logFile",
+	"logLevel",
+	"maxLogFileDurationHrs",
+	"maxLogFiles",
+	"serveStatusPort",
+	"sslRequireValidMMSServerCertificates",
+	"sslTrustedMMSServerCertificate",
+}
+
+func isAgentStartupArgName(name string) bool {
+	for _, n := range agentStartupArgNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func validateAgentStartupArgs(args map[string]interface{}) error {
+	for name := range args {
+		if !isAgentStartupArgName(name) {
+			return errors.Errorf("unsupported agent startup arg %q, must be one of %s", name, strings.Join(agentStartupArgNames, ", "))
+		}
+	}
+	return nil
+}
+
+func validateDefaultRWConcern(concern DefaultRWConcern) error {
+	if concern.DefaultReadConcern == nil && concern.DefaultWriteConcern == nil {
+		return errors.Errorf("a default read and write concern must configure at least one of the read or write concern")
+	}
+	if rc := concern.DefaultReadConcern; rc != nil {
+		if rc.Level != "local" && rc.Level != "available" && rc.Level != "majority" {
+			return errors.Errorf(`invalid default read concern level %q, must be one of "local", "available" or "majority"`, rc.Level)
+		}
+	}
+	if wc := concern.DefaultWriteConcern; wc != nil {
+		switch w := wc.W.(type) {
+		case nil:
+		case int:
+			if w < 0 {
+				return errors.Errorf("the default write concern w must not be negative, but got %d", w)
+			}
+		case string:
+			if w == "" {
+				return errors.Errorf("the default write concern w must not be empty")
+			}
+		default:
+			return errors.Errorf("the default write concern w must be a number or a string, but got %T", wc.W)
+		}
+		if wc.WTimeout < 0 {
+			return errors.Errorf("the default write concern wtimeout must not be negative, but got %d", wc.WTimeout)
+		}
+	}
+	return nil
+}
+
+// effectiveAuthSchemaVersion returns the configured auth schema version, falling back to the one of
+// the previous AutomationConfig. 0 means the default version of the process is used.
+func (b *Builder) effectiveAuthSchemaVersion() int {
+	if b.authSchemaVersion != 0 {
+		return b.authSchemaVersion
+	}
+	return b.previousAuthSchemaVersion()
+}
+
+// effectiveFCV returns the configured FCV or, on a fresh install with the auto bump enabled, the major and
+// minor version of MongoDB.
+func (b *Builder) effectiveFCV() string {
+	if b.fcv != "" || !b.fcvAutoBumpOnFreshInstall || len(b.previousAC.Processes) > 0 {
+		return b.fcv
+	}
+	fcv, _ := majorMinorOf(b.mongodbVersion)
+	return fcv
+}
+
+// forceReconfigConfig returns the force config of the replica set, or nil if a forced reconfig wasn't requested.
+func (b *Builder) forceReconfigConfig() *ReplicaSetForceConfig {
+	if !b.forceReconfig {
+		return nil
+	}
+	return &ReplicaSetForceConfig{CurrentVersion: -1}
+}
+
+// buildAuth applies the enablers in order. Enablers nested in a CompositeAuthEnabler are applied one by one,
+// so that they are validated as well.
+func (b *Builder) buildAuth() (Auth, error) {
+	auth := disabledAuth()
+	defaultMechanism := auth.AutoAuthMechanism
+	configuredMechanism := ""
+	for _, enabler := range flattenAuthEnablers(b.enablers) {
+		auth = enabler.EnableAuth(auth)
+		if auth.AutoAuthMechanism == defaultMechanism || auth.AutoAuthMechanism == configuredMechanism {
+			continue
+		}
+		if configuredMechanism != "" {
+			return Auth{}, errors.Errorf("the auth enablers configure conflicting agent authentication mechanisms %s and %s", configuredMechanism, auth.AutoAuthMechanism)
+		}
+		configuredMechanism = auth.AutoAuthMechanism
+	}
+	if b.authoritativeEmptyAuth && auth.Disabled {
+		auth.AuthoritativeSet = true
+	}
+	return auth, nil
+}
+
+func flattenAuthEnablers(enablers []AuthEnabler) []AuthEnabler {
+	flattened := []AuthEnabler{}
+	for _, enabler := range enablers {
+		if enabler == nil {
+			continue
+		}
+		if composite, ok := enabler.(CompositeAuthEnabler); ok {
+			flattened = append(flattened, flattenAuthEnablers(composite)...)
+			continue
+		}
+		flattened = append(flattened, enabler)
+	}
+	return flattened
+}
+
+// buildVersions returns the versions, with the ones added more than once merged, with only the builds
+// matching the architecture filter.
+func (b *Builder) buildVersions() ([]MongoDbVersionConfig, error) {
+	merged := b.mergeVersions()
+	for i := range merged {
+		merged[i].Builds = normalizeBuilds(merged[i].Builds)
+	}
+	if len(b.architectures) == 0 {
+		return merged, nil
+	}
+	versions := make([]MongoDbVersionConfig, len(merged))
+	for i, version := range merged {
+		builds := []BuildConfig{}
+		for _, build := range version.Builds {
+			for _, architecture := range b.architectures {
+				if build.Architecture == architecture {
+					builds = append(builds, build)
+					break
+				}
+			}
+		}
+		if len(builds) == 0 {
+			return nil, errors.Errorf("version %s has no build for the architectures %s", version.Name, strings.Join(b.architectures, ", "))
+		}
+		version.Builds = builds
+		versions[i] = version
+	}
+	return versions, nil
+}
+
+// configureLocalPingThreshold sets replication.localPingThresholdMs on the mongos processes, when it is configured.
+func (b *Builder) configureLocalPingThreshold(ac *AutomationConfig) error {
+	if b.localPingThresholdMs == nil {
+		return nil
+	}
+	mongos := 0
+	for i := range ac.Processes {
+		if ac.Processes[i].ProcessType == Mongos {
+			ac.Processes[i].Args26.Set("replication.localPingThresholdMs", *b.localPingThresholdMs)
+			mongos++
+		}
+	}
+	if mongos == 0 {
+		return errors.Errorf("the local ping threshold only applies to mongos processes, but there are none")
+	}
+	return nil
+}
+
+// configureMongosConnectionPool sets the connection pool parameters on the mongos processes, when they are configured.
+func (b *Builder) configureMongosConnectionPool(ac *AutomationConfig) error {
+	if b.mongosConnectionPool == nil {
+		return nil
+	}
+	mongos := 0
+	for i := range ac.Processes {
+		if ac.Processes[i].ProcessType == Mongos {
+			ac.Processes[i].Args26.Set("setParameter.taskExecutorPoolSize", b.mongosConnectionPool.poolSize)
+			ac.Processes[i].Args26.Set("setParameter.ShardingTaskExecutorPoolMaxSize", b.mongosConnectionPool.maxSize)
+			mongos++
+		}
+	}
+	if mongos == 0 {
+		return errors.Errorf("the mongos connection pool only applies to mongos processes, but there are none")
+	}
+	return nil
+}
+
+// configureConnectionsWithoutCertificates applies the setting of their process type to the processes with TLS
+// enabled, including the ones added by modifications and the ones whose type was changed by mutators.
+func (b *Builder) configureConnectionsWithoutCertificates(ac *AutomationConfig) {
+	for i := range ac.Processes {
+		p := &ac.Processes[i]
+		if len(b.tls.allowConnectionsWithoutCertificates) == 0 || tlsModeOrDisabled(*p) == TLSModeDisabled {
+			continue
+		}
+		b.tls.setConnectionsWithoutCertificatesArg(p)
+	}
+}
+
+// mergeVersions merges the builds of the versions which were added more than once into the first one. The
+// builds which it already has are not added again.
+func (b *Builder) mergeVersions() []MongoDbVersionConfig {
+	versions := []MongoDbVersionConfig{}
+	positions := map[string]int{}
+	for _, version := range b.versions {
+		i, ok := positions[version.Name]
+		if !ok {
+			positions[version.Name] = len(versions)
+			versions = append(versions, MongoDbVersionConfig{Name: version.Name, Builds: append([]BuildConfig{}, version.Builds...)})
+			continue
+		}
+		b.log.Infof("Version %s was added more than once, merging its builds", version.Name)
+		versions[i].Builds = appendNewBuilds(versions[i].Builds, version.Builds)
+	}
+	return versions
+}
+
+// normalizeBuilds sorts the builds by platform, architecture and git version, and their modules by name, and
+// removes the duplicate builds. This keeps the marshaled config stable regardless of the order the builds
+// were added in, so that reordering them doesn't increase the version.
+func normalizeBuilds(builds []BuildConfig) []BuildConfig {
+	sorted := make([]BuildConfig, len(builds))
+	for i, build := range builds {
+		build.Modules = append([]string{}, build.Modules...)
+		sort.Strings(build.Modules)
+		sorted[i] = build
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return buildSortKey(sorted[i]) < buildSortKey(sorted[j])
+	})
+	normalized := []BuildConfig{}
+	for _, build := range sorted {
+		if len(normalized) > 0 && reflect.DeepEqual(normalized[len(normalized)-1], build) {
+			continue
+		}
+		normalized = append(normalized, build)
+	}
+	return normalized
+}
+
+// buildSortKey orders builds by platform, architecture and git version. The other fields only break ties,
+// so that the order doesn't depend on the order the builds were added in.
+func buildSortKey(build BuildConfig) string {
+	return strings.Join([]string{
+		build.Platform,
+		build.Architecture,
+		build.GitVersion,
+		build.Flavor,
+		build.MinOsVersion,
+		build.MaxOsVersion,
+		build.Url,
+		strings.Join(build.Modules, ","),
+	}, "\x00")
+}
+
+// appendNewBuilds appends the builds which aren't already part of the given builds.
+func appendNewBuilds(builds, newBuilds []BuildConfig) []BuildConfig {
+	for _, newBuild := range newBuilds {
+		duplicate := false
+		for _, build := range builds {
+			if reflect.DeepEqual(build, newBuild) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			builds = append(builds, newBuild)
+		}
+	}
+	return builds
+}
+
+// configureMongos sets sharding.configDB on the mongos processes which don't have it, when it is configured
+// or the deployment has a config server replica set, and ensures it references that replica set.
+func (b *Builder) configureMongos(ac *AutomationConfig) error {
+	for i := range ac.Processes {
+		p := &ac.Processes[i]
+		if p.ProcessType != Mongos {
+			continue
+		}
+		if p.Args26.Get("sharding.configDB").Data() == nil {
+			configDB := b.configDB
+			if configDB == "" {
+				configDB = configDBOf(*ac)
+			}
+			if configDB == "" {
+				continue
+			}
+			p.Args26.Set("sharding.configDB", configDB)
+		}
+		if err := validateConfigDB(*ac, fmt.Sprint(p.Args26.Get("sharding.configDB").Data())); err != nil {
+			return errors.Errorf("invalid config DB for mongos %s: %s", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// configDBOf returns the connection string of the config server replica set of the deployment, or "" if it has none.
+func configDBOf(ac AutomationConfig) string {
+	for _, rs := range ac.ReplicaSets {
+		if !rs.ConfigServer {
+			continue
+		}
+		hosts := memberHostsOf(rs, ac.Processes)
+		if len(hosts) == 0 {
+			return ""
+		}
+		return rs.Id + "/" + strings.Join(hosts, ",")
+	}
+	return ""
+}
+
+// memberHostsOf returns the host:port of the processes of the members of the replica set.
+func memberHostsOf(rs ReplicaSet, processes []Process) []string {
+	hosts := []string{}
+	for _, m := range rs.Members {
+		for _, p := range processes {
+			if p.Name == m.Host {
+				hosts = append(hosts, fmt.Sprintf("%s:%d", p.HostName, portOf(p)))
+			}
+		}
+	}
+	return hosts
+}
+
+// defaultPort is the port MongoDB listens on when net.port isn't configured
+const defaultPort = 27017
+
+// portOf returns the port the process listens on.
+func portOf(p Process) int {
+	switch port := p.Args26.Get("net.port").Data().(type) {
+	case int:
+		return port
+	case float64:
+		return int(port)
+	}
+	return defaultPort
+}
+
+func validateConfigDB(ac AutomationConfig, configDB string) error {
+	if !configDBPattern.MatchString(configDB) {
+		return errors.Errorf("%q must be in the form csReplSet/host:port,...", configDB)
+	}
+	parts := strings.SplitN(configDB, "/", 2)
+	for _, rs := range ac.ReplicaSets {
+		if rs.Id != parts[0] || !rs.ConfigServer {
+			continue
+		}
+		members := memberHostsOf(rs, ac.Processes)
+		for _, host := range strings.Split(parts[1], ",") {
+			if !isMemberHost(members, host) {
+				return errors.Errorf("%s is not a member of config server replica set %s", host, rs.Id)
+			}
+		}
+		return nil
+	}
+	return errors.Errorf("%s is not a config server replica set of the deployment", parts[0])
+}
+
+func isMemberHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// buildReplicaSetSettings returns the configured settings with the replicaSetId of the previous
+// AutomationConfig, as the agent would otherwise consider it a different replica set.
+func (b *Builder) buildReplicaSetSettings() *ReplicaSetSettings {
+	previousId := b.previousReplicaSetId()
+	if previousId == "" {
+		return b.replicaSetSettings
+	}
+	settings := ReplicaSetSettings{}
+	if b.replicaSetSettings != nil {
+		settings = *b.replicaSetSettings
+	}
+	if settings.ReplicaSetId == "" {
+		settings.ReplicaSetId = previousId
+	}
+	return &settings
+}
+
+// previousReplicaSetId returns the replicaSetId of the replica set in the previous AutomationConfig.
+func (b *Builder) previousReplicaSetId() string {
+	for _, rs := range b.previousAC.ReplicaSets {
+		if rs.Id == b.name && rs.Settings != nil {
+			return rs.Settings.ReplicaSetId
+		}
+	}
+	return ""
+}
+
+func (b *Builder) buildOptions() Options {
+	return Options{
+		DownloadBase:     defaultDownloadBase,
+		UseBarInstaller:  b.useBarInstaller,
+		HTTPProxy:        b.agentProxy.httpProxy,
+		HTTPSProxy:       b.agentProxy.httpsProxy,
+		NoProxy:          b.agentProxy.noProxy,
+		MultiClusterMode: b.multiClusterMode,
+	}
+}
+
+// buildAgentSettings returns the configured agent settings, with the dial timeout when it is configured.
+func (b *Builder) buildAgentSettings() *AgentSettings {
+	if b.agentDialTimeoutSeconds == nil && b.agentServerTLSCAFile == "" {
+		return b.agentSettings
+	}
+	settings := AgentSettings{}
+	if b.agentSettings != nil {
+		settings = *b.agentSettings
+	}
+	if b.agentDialTimeoutSeconds != nil {
+		settings.DialTimeoutSeconds = *b.agentDialTimeoutSeconds
+	}
+	if b.agentServerTLSCAFile != "" {
+		settings.ServerTLSCAFilePath = b.agentServerTLSCAFile
+	}
+	return &settings
+}
+
+func (b *Builder) buildAgentVersion() *AgentVersion {
+	if b.agentVersion == "" {
+		return nil
+	}
+	return &AgentVersion{Name: b.agentVersion}
+}
+
+// memberCount returns the total number of members, including the backup members.
+func (b *Builder) memberCount() int {
+	return b.members + len(b.delayedBackupMembers)
+}
+
+func (b *Builder) buildHostnames() []string {
+	ordinals := b.memberOrdinals()
+	hostnames := make([]string, len(ordinals))
+	for i, ordinal := range ordinals {
+		hostnames[i] = fmt.Sprintf("%s-%d.%s", b.name, ordinal, b.domain)
+		if hostName := b.memberOptions[i].hostName; hostName != "" {
+			hostnames[i] = hostName
+		}
+	}
+	return hostnames
+}
+
+// memberOrdinals returns the ordinal of the host of each member, skipping the ones of the removed members.
+func (b *Builder) memberOrdinals() []int {
+	removed := map[string]bool{}
+	for _, host := range b.removedHosts {
+		removed[host] = true
+	}
+	ordinals := make([]int, 0, b.memberCount())
+	for ordinal := 0; len(ordinals) < b.memberCount(); ordinal++ {
+		if !removed[toHostName(b.name, ordinal)] {
+			ordinals = append(ordinals, ordinal)
+		}
+	}
+	return ordinals
+}
+
+func (b *Builder) buildProcesses() []Process {
+	hostnames := b.buildHostnames()
+	ordinals := b.memberOrdinals()
+	processes := make([]Process, len(hostnames))
+	for i, h := range hostnames {
+		opts := []func(*Process){}
+		if len(b.processArgsTemplate) > 0 {
+			opts = append(opts, withArgsTemplate(b.processArgsTemplate))
+		}
+		opts = append(opts, withFCV(b.effectiveFCV()))
+		if b.tls.enabled() {
+			opts = append(opts, withTLS(b.tls))
+			if path, ok := b.tls.memberCertificateKeyFiles[i]; ok {
+				opts = append(opts, withTLSCertificateKeyFile(path))
+			}
+		}
+		if cpus, ok := b.processCPUAffinity[i]; ok {
+			opts = append(opts, withCPUAffinity(cpus))
+		}
+		if b.clusterAuthMode != "" {
+			opts = append(opts, withClusterAuthMode(b.clusterAuthMode))
+		}
+		if b.initialSyncSourceReadPreference != "" {
+			opts = append(opts, withSetParameter("initialSyncSourceReadPreference", b.initialSyncSourceReadPreference))
+		}
+		if b.serviceExecutor != "" {
+			opts = append(opts, withArg("net.serviceExecutor", b.serviceExecutor))
+		}
+		if b.defaultRWConcern != nil {
+			opts = append(opts, withDefaultRWConcern(*b.defaultRWConcern))
+		}
+		if b.freeMonitoringState != "" {
+			opts = append(opts, withArg("cloud.monitoring.free.state", b.freeMonitoringState))
+		}
+		if b.diagnosticDataCollectionEnabled != nil {
+			opts = append(opts, withSetParameter("diagnosticDataCollectionEnabled", *b.diagnosticDataCollectionEnabled))
+		}
+		if b.diagnosticDataCollectionDirectorySizeMB > 0 {
+			opts = append(opts, withSetParameter("diagnosticDataCollectionDirectorySizeMB", b.diagnosticDataCollectionDirectorySizeMB))
+		}
+		if b.redactClientLogData {
+			opts = append(opts, withArg("security.redactClientLogData", true))
+		}
+		if b.javascriptEnabled != nil {
+			opts = append(opts, withArg("security.javascriptEnabled", *b.javascriptEnabled))
+		}
+		if len(b.profilingFilter) > 0 {
+			opts = append(opts, withProfilingFilter(b.profilingFilter))
+		}
+		if b.blockCompressor != "" {
+			opts = append(opts, withArg("storage.wiredTiger.collectionConfig.blockCompressor", b.blockCompressor))
+		}
+		if b.journalCompressor != "" {
+			opts = append(opts, withArg("storage.wiredTiger.engineConfig.journalCompressor", b.journalCompressor))
+		}
+		if b.indexPrefixCompression != nil {
+			opts = append(opts, withArg("storage.wiredTiger.indexConfig.prefixCompression", *b.indexPrefixCompression))
+		}
+		if b.wireObjectCheck != nil {
+			opts = append(opts, withArg("net.wireObjectCheck", *b.wireObjectCheck))
+		}
+		if b.ttlMonitor != nil {
+			opts = append(opts, withSetParameter("ttlMonitorEnabled", b.ttlMonitor.enabled))
+			opts = append(opts, withSetParameter("ttlMonitorSleepSecs", b.ttlMonitor.sleepSecs))
+		}
+		if b.enableMajorityReadConcern != nil {
+			opts = append(opts, withArg("replication.enableMajorityReadConcern", *b.enableMajorityReadConcern))
+		} else if b.changeStreams {
+			opts = append(opts, withArg("replication.enableMajorityReadConcern", true))
+		}
+		for component, verbosity := range b.componentVerbosity {
+			opts = append(opts, withArg("systemLog.component."+component+".verbosity", verbosity))
+		}
+		if b.storageSyncPeriodSecs > 0 {
+			opts = append(opts, withArg("storage.syncPeriodSecs", b.storageSyncPeriodSecs))
+		}
+		if b.maxCacheOverflowFileSizeGB != nil {
+			opts = append(opts, withArg("storage.wiredTiger.engineConfig.maxCacheOverflowFileSizeGB", *b.maxCacheOverflowFileSizeGB))
+		}
+		if b.wiredTigerEviction != nil {
+			opts = append(opts, withSetParameter("wiredTigerEngineRuntimeConfig", b.wiredTigerEviction.configString()))
+		}
+		if b.oplogMinRetentionHours > 0 {
+			opts = append(opts, withArg("storage.oplogMinRetentionHours", b.oplogMinRetentionHours))
+		}
+		if b.secondaryIndexPrefetch != "" {
+			opts = append(opts, withArg("replication.secondaryIndexPrefetch", b.secondaryIndexPrefetch))
+		}
+		if b.clusterRole != "" {
+			opts = append(opts, withArg("sharding.clusterRole", b.clusterRole))
+		}
+		if b.bindAllInterfaces {
+			opts = append(opts, withBindAllInterfaces())
+		}
+		if b.processManagement != nil {
+			opts = append(opts, withProcessManagement(*b.processManagement))
+		}
+		if b.unixDomainSocket != nil {
+			opts = append(opts, withUnixDomainSocket(*b.unixDomainSocket))
+		}
+		if len(b.agentStartupArgs) > 0 {
+			opts = append(opts, withAgentStartupArgs(b.agentStartupArgs))
+		}
+		if authSchemaVersion := b.effectiveAuthSchemaVersion(); authSchemaVersion != 0 {
+			opts = append(opts, withAuthSchemaVersion(authSchemaVersion))
+		}
+		processes[i] = newProcess(toHostName(b.name, ordinals[i]), h, b.mongodbVersion, b.name, opts...)
+		for _, mutator := range b.processMutators {
+			mutator(i, &processes[i])
+		}
+	}
+	return processes
+}
+
+func (b *Builder) buildMembers(processes []Process) ([]ReplicaSetMember, error) {
+	members := make([]ReplicaSetMember, len(processes))
+	for i, process := range processes {
+		if i < len(b.replicaSetHorizons) {
+			members[i] = newReplicaSetMember(process, i, b.replicaSetHorizons[i])
+		} else {
+			members[i] = newReplicaSetMember(process, i, nil)
+		}
+		if i >= b.members {
+			delayedBackupMemberOptions(b.delayedBackupMembers[i-b.members]).apply(&members[i], b.mongodbVersion)
+		}
+		if opts, ok := b.memberOptions[i]; ok {
+			opts.apply(&members[i], b.mongodbVersion)
+		}
+		members[i].ClusterName = b.memberClusters[i]
+	}
+	if b.balancePrioritiesByZone {
+		if err := b.balanceZonePriorities(members); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.assignMemberIds(members); err != nil {
+		return nil, err
+	}
+	caughtUp := b.caughtUpHosts(members)
+	b.keepMemberOrder(members)
+	b.keepNewlyAdded(members, caughtUp)
+	if b.autoCorrectDelayedMembers {
+		b.correctDelayedMembers(members)
+	}
+	return members, nil
+}
+
+// correctDelayedMembers sets the priority and votes of the delayed members to 0.
+func (b *Builder) correctDelayedMembers(members []ReplicaSetMember) {
+	for i := range members {
+		m := &members[i]
+		if !isDelayed(*m) || (m.Priority == 0 && m.Votes == 0) {
+			continue
+		}
+		b.log.Warnf("Member %s of replica set %s is delayed, its priority %d and votes %d are set to 0", m.Host, b.name, m.Priority, m.Votes)
+		m.Priority = 0
+		m.Votes = 0
+	}
+}
+
+func isDelayed(m ReplicaSetMember) bool {
+	return m.SlaveDelay > 0 || m.SecondaryDelaySecs > 0
+}
+
+// keepNewlyAdded keeps the newlyAdded flag of the members which still have it in the previous
+// AutomationConfig, except for the hosts known to have caught up. Clearing it otherwise would give them a vote
+// before they have caught up.
+func (b *Builder) keepNewlyAdded(members []ReplicaSetMember, caughtUp map[string]bool) {
+	for _, previous := range b.previousMembers() {
+		if !previous.NewlyAdded {
+			continue
+		}
+		if caughtUp[previous.Host] {
+			b.log.Infof("Member %s of replica set %s has caught up, its newlyAdded flag is cleared", previous.Host, b.name)
+			continue
+		}
+		for i := range members {
+			if members[i].Host == previous.Host && members[i].Id == previous.Id {
+				members[i].NewlyAdded = true
+			}
+		}
+	}
+}
+
+// caughtUpHosts returns the hosts of the members reported as caught up, when their newlyAdded flag is cleared.
+// The members must still be in the order of the processes.
+func (b *Builder) caughtUpHosts(members []ReplicaSetMember) map[string]bool {
+	hosts := map[string]bool{}
+	if !b.clearNewlyAddedWhenCaughtUp {
+		return hosts
+	}
+	for i, m := range members {
+		if b.memberCaughtUp[i] {
+			hosts[m.Host] = true
+		}
+	}
+	return hosts
+}
+
+// keepMemberOrder moves the members which are part of the previous AutomationConfig to the positions they had
+// in it, relative to each other, and the new members after them. Reordering the members is an unnecessary change
+// for the agent to apply.
+func (b *Builder) keepMemberOrder(members []ReplicaSetMember) {
+	previousPositions := map[string]int{}
+	for i, m := range b.previousMembers() {
+		previousPositions[m.Host] = i
+	}
+	position := func(m ReplicaSetMember) int {
+		if i, ok := previousPositions[m.Host]; ok {
+			return i
+		}
+		return len(previousPositions)
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return position(members[i]) < position(members[j])
+	})
+}
+
+// assignMemberIds ensures every member keeps the id it had in the previous AutomationConfig.
+// Ids configured explicitly take precedence, but can't change the id of an existing member.
+// New members get the id matching their index when it's available, or the next unused id.
+func (b *Builder) assignMemberIds(members []ReplicaSetMember) error {
+	previousIds := map[string]int{}
+	for _, m := range b.previousMembers() {
+		previousIds[m.Host] = m.Id
+	}
+
+	used := map[int]string{}
+	isUsed := func(id int) bool {
+		_, ok := used[id]
+		return ok
+	}
+	assigned := make([]bool, len(members))
+	assign := func(i, id int) error {
+		if id < 0 || id > 255 {
+			return errors.Errorf("member %s has id %d, but ids must be between 0 and 255", members[i].Host, id)
+		}
+		if isUsed(id) {
+			return errors.Errorf("members %s and %s have the same id %d", used[id], members[i].Host, id)
+		}
+		used[id] = members[i].Host
+		members[i].Id = id
+		assigned[i] = true
+		return nil
+	}
+
+	for i := range members {
+		opts := b.memberOptions[i]
+		previousId, existed := previousIds[members[i].Host]
+		if opts.id != nil && existed && *opts.id != previousId {
+			return errors.Errorf("the id of member %s can't be changed from %d to %d", members[i].Host, previousId, *opts.id)
+		}
+		if opts.id != nil {
+			if err := assign(i, *opts.id); err != nil {
+				return err
+			}
+		} else if existed {
+			if err := assign(i, previousId); err != nil {
+				return err
+			}
+		}
+	}
+
+	nextId := 0
+	for i := range members {
+		if assigned[i] {
+			continue
+		}
+		id := i
+		if isUsed(id) {
+			for isUsed(nextId) {
+				nextId++
+			}
+			id = nextId
+		}
+		if err := assign(i, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// previousAuthSchemaVersion returns the auth schema version of the processes in the previous
+// AutomationConfig, or 0 if there are none.
+func (b *Builder) previousAuthSchemaVersion() int {
+	for _, p := range b.previousAC.Processes {
+		if p.AuthSchemaVersion != 0 {
+			return p.AuthSchemaVersion
+		}
+	}
+	return 0
+}
+
+// previousMembers returns the members of the replica set in the previous AutomationConfig.
+func (b *Builder) previousMembers() []ReplicaSetMember {
+	for _, rs := range b.previousAC.ReplicaSets {
+		if rs.Id == b.name {
+			return rs.Members
+		}
+	}
+	return nil
+}
+
+// AddProcessMutator registers a mutator which is applied to each process after the standard options.
+// Changes made by mutators are taken into account when deciding if the version should be increased.
+func (b *Builder) AddProcessMutator(mutator ProcessMutator) *Builder {
+	b.processMutators = append(b.processMutators, mutator)
+	return b
+}
+
+// AddReplicaSetMutator registers a mutator which is applied to each replica set after everything else.
+// Changes made by mutators are taken into account when deciding if the version should be increased.
+func (b *Builder) AddReplicaSetMutator(mutator ReplicaSetMutator) *Builder {
+	b.replicaSetMutators = append(b.replicaSetMutators, mutator)
+	return b
+}
+
+// Build builds the AutomationConfig. No step of the build is randomized: the maps configured on the Builder are
+// applied by key or sorted, so identical Builders marshal to identical bytes. Values which have to be random,
+// like the agent password and the SCRAM salts, are generated by the caller and passed in.
+func (b *Builder) Build() (AutomationConfig, error) {
+	result, err := b.BuildWithResult()
+	if err != nil {
+		return AutomationConfig{}, err
+	}
+	return result.Config, nil
+}
+
+// BuildDelta builds the AutomationConfig and returns the JSON Merge Patch (RFC 7386) which turns the previous
+// AutomationConfig into it, e.g. to log a compact representation of the change.
+func (b *Builder) BuildDelta() ([]byte, error) {
+	ac, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return MergePatch(b.previousAC, ac)
+}
+
+// BuildNoVersionChange builds the AutomationConfig, but always keeps the version of the previous one, even if
+// the config changed. This allows the caller to decide separately whether the version should be increased.
+// As the version isn't increased, the ceiling configured with SetMaxVersion doesn't apply.
+func (b *Builder) BuildNoVersionChange() (AutomationConfig, error) {
+	unbounded := *b
+	unbounded.maxVersion = 0
+	result, err := unbounded.BuildWithResult()
+	if err != nil {
+		return AutomationConfig{}, err
+	}
+	result.Config.Version = b.previousAC.Version
+	return result.Config, nil
+}
+
+// BuildScaledToZero builds the AutomationConfig with all of its processes disabled, so the agents shut them down
+// while keeping their data, e.g. to pause a deployment which isn't used. The topology is kept as it is, so a
+// regular Build resumes the processes with the same members and settings.
+func (b *Builder) BuildScaledToZero() (AutomationConfig, error) {
+	scaled := *b
+	scaled.scaledToZero = true
+	return scaled.Build()
+}
+
+// BuildResult describes the outcome of a build.
+type BuildResult struct {
+	Config AutomationConfig
+	// Changed is true if the config is different from the previous one, in which case its version was increased
+	Changed         bool
+	PreviousVersion int
+	NewVersion      int
+	// Changes are the fields which are different from the previous config
+	Changes []FieldChange
+	// RequiresRollingRestart is true if some of the changes are only applied when the processes are restarted,
+	// e.g. the TLS mode or the storage options, so the agents restart the members one at a time
+	RequiresRollingRestart bool
+}
+
+// BuildWithResult builds the AutomationConfig and reports whether it changed compared to the previous one.
+func (b *Builder) BuildWithResult() (BuildResult, error) {
+	if err := b.parsePreviousAutomationConfig(); err != nil {
+		return BuildResult{}, err
+	}
+	if err := b.validate(); err != nil {
+		return BuildResult{}, err
+	}
+	processes := b.buildProcesses()
+	if b.convertingStandalone() && len(processes) > 1 {
+		b.log.Infof("Converting standalone %s to replica set %s, the other %d members are added once it has been initiated", processes[0].Name, b.name, len(processes)-1)
+		processes = processes[:1]
+	}
+	// members are matched to the options configured for their index, so they
+	// need to be built before the processes are sorted.
+	members, err := b.buildMembers(processes)
+	if err != nil {
+		return BuildResult{}, err
+	}
+	sortProcesses(processes)
+	b.logWarnings(processes)
+
+	auth, err := b.buildAuth()
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	versions, err := b.buildVersions()
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	tls := TLS{
+		ClientCertificateMode: ClientCertificateModeOptional,
+	}
+	if b.tls.enabled() {
+		tls.CAFilePath = b.tls.caFile
+	}
+
+	currentAc := AutomationConfig{
+		Version:   b.previousAC.Version,
+		Processes: processes,
+		ReplicaSets: []ReplicaSet{
+			{
+				Id:                                 b.name,
+				Members:                            members,
+				ProtocolVersion:                    "1",
+				WriteConcernMajorityJournalDefault: b.writeConcernMajorityJournalDefault,
+				ConfigServer:                       b.clusterRole == ClusterRoleConfigServer,
+				Settings:                           b.buildReplicaSetSettings(),
+				Force:                              b.forceReconfigConfig(),
+			},
+		},
+		Versions:      versions,
+		Options:       b.buildOptions(),
+		Auth:          auth,
+		TLS:           tls,
+		AgentSettings: b.buildAgentSettings(),
+		AgentVersion:  b.buildAgentVersion(),
+	}
+	if len(b.goalStateAnnotations) > 0 {
+		currentAc.Annotations = b.goalStateAnnotations
+	}
+
+	// Apply all modifications
+	for _, modification := range b.modifications {
+		modification(&currentAc)
+	}
+	b.configureMongosTLS(&currentAc)
+
+	// mongos processes can only be added by modifications
+	if err := b.configureMongos(&currentAc); err != nil {
+		return BuildResult{}, err
+	}
+	b.configureConnectionsWithoutCertificates(&currentAc)
+	if b.processCluster != nil {
+		for i := range currentAc.Processes {
+			currentAc.Processes[i].Cluster = *b.processCluster
+		}
+	}
+	if err := b.configureLocalPingThreshold(&currentAc); err != nil {
+		return BuildResult{}, err
+	}
+	if err := b.configureMongosConnectionPool(&currentAc); err != nil {
+		return BuildResult{}, err
+	}
+
+	// credentials are applied after the modifications, which can replace all of the users
+	for _, creds := range b.userCredentials {
+		creds.apply(&currentAc.Auth)
+	}
+	if err := b.configureAuthMechanisms(&currentAc); err != nil {
+		return BuildResult{}, err
+	}
+	if err := b.configureAgentX509(&currentAc); err != nil {
+		return BuildResult{}, err
+	}
+
+	for i := range currentAc.ReplicaSets {
+		for _, mutator := range b.replicaSetMutators {
+			mutator(&currentAc.ReplicaSets[i])
+		}
+	}
+	b.applyAgentCompatibility(&currentAc)
+	if b.scaledToZero {
+		for i := range currentAc.Processes {
+			currentAc.Processes[i].Disabled = true
+		}
+	}
+	// modifications can add processes, e.g. the mongos, or change their type
+	sortProcesses(currentAc.Processes)
+
+	if err := b.validateAutomationConfig(currentAc); err != nil {
+		return BuildResult{}, err
+	}
+	b.warnSingleZone(currentAc)
+	b.warnChainingDisabled(currentAc)
+
+	// Here we compare the bytes of the two automationconfigs,
+	// we can't use reflect.DeepEqual() as it treats nil entries as different from empty ones,
+	// and in the AutomationConfig Struct we use omitempty to set empty field to nil
+	// The agent requires the nil value we provide, otherwise the agent attempts to configure authentication,
+	// unless the auth block is authoritative, see SetAuthoritativeEmptyAuth and Auth.MarshalJSON.
+	// The annotations, the cluster labels and the fields ignored in the bump, e.g. the agent managed ones,
+	// are not compared.
+
+	previousValue, err := b.comparableValue(b.previousAC)
+	if err != nil {
+		return BuildResult{}, err
+	}
+	newAcBytes, err := json.Marshal(previousValue)
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	currentValue, err := b.comparableValue(currentAc)
+	if err != nil {
+		return BuildResult{}, err
+	}
+	currentAcBytes, err := json.Marshal(currentValue)
+	if err != nil {
+		return BuildResult{}, err
+	}
+
+	changed := !bytes.Equal(newAcBytes, currentAcBytes)
+	var changes []FieldChange
+	if changed {
+		changes = []FieldChange{}
+		diffValues("", previousValue, currentValue, &changes)
+		if b.maxVersion > 0 && currentAc.Version >= b.maxVersion {
+			return BuildResult{}, errors.Wrapf(ErrVersionCeilingReached, "the version can't be increased beyond %d, %d fields changed", b.maxVersion, len(changes))
+		}
+		currentAc.Version++
+	}
+	return BuildResult{
+		Config:                 currentAc,
+		Changed:                changed,
+		PreviousVersion:        b.previousAC.Version,
+		NewVersion:             currentAc.Version,
+		Changes:                changes,
+		RequiresRollingRestart: requiresRollingRestart(changes),
+	}, nil
+}
+
+// BuildAndValidate builds the AutomationConfig and ensures that it survives a JSON round trip
+// unchanged. A config which doesn't would be seen as different from the previous one on every
+// reconciliation, causing a spurious version bump.
+func (b *Builder) BuildAndValidate() (AutomationConfig, error) {
+	ac, err := b.Build()
+	if err != nil {
+		return AutomationConfig{}, err
+	}
+
+	acBytes, err := json.Marshal(ac)
+	if err != nil {
+		return AutomationConfig{}, err
+	}
+
+	roundTripped := AutomationConfig{}
+	if err := json.Unmarshal(acBytes, &roundTripped); err != nil {
+		return AutomationConfig{}, errors.Errorf("could not unmarshal automation config: %s", err)
+	}
+
+	roundTrippedBytes, err := json.Marshal(roundTripped)
+	if err != nil {
+		return AutomationConfig{}, err
+	}
+
+	if !bytes.Equal(acBytes, roundTrippedBytes) {
+		return AutomationConfig{}, errors.Errorf("automation config is not stable across a JSON round trip: %s != %s", acBytes, roundTrippedBytes)
+	}
+	return ac, nil
+}
+
+// processTypeOrder is the canonical order of the process types in the AutomationConfig.
+var processTypeOrder = map[ProcessType]int{
+	Mongod: 0,
+	Mongos: 1,
+}
+
+// sortProcesses sorts the processes by type, and then by name, so that the order of the processes
+// doesn't depend on the order they were configured in. Names are compared so that "my-rs-10" comes
+// after "my-rs-9".
+func sortProcesses(processes []Process) {
+	sort.SliceStable(processes, func(i, j int) bool {
+		if processes[i].ProcessType != processes[j].ProcessType {
+			iOrder, iKnown := processTypeOrder[processes[i].ProcessType]
+			jOrder, jKnown := processTypeOrder[processes[j].ProcessType]
+			if iKnown != jKnown {
+				return iKnown
+			}
+			if iOrder != jOrder {
+				return iOrder < jOrder
+			}
+			return processes[i].ProcessType < processes[j].ProcessType
+		}
+		return naturalLess(processes[i].Name, processes[j].Name)
+	})
+}
+
+// naturalLess compares two strings, treating runs of digits as numbers.
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		aPrefix, aRest := splitLeadingDigits(a)
+		bPrefix, bRest := splitLeadingDigits(b)
+		if aPrefix != "" && bPrefix != "" {
+			aNum, _ := strconv.Atoi(aPrefix)
+			bNum, _ := strconv.Atoi(bPrefix)
+			if aNum != bNum {
+				return aNum < bNum
+			}
+			a, b = aRest, bRest
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func splitLeadingDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// hasNonJournaledProcess returns true if any of the processes doesn't write a journal.
+func hasNonJournaledProcess(processes []Process) bool {
+	for _, p := range processes {
+		if p.Args26.Get("storage.engine").Data() == "inMemory" || p.Args26.Get("storage.journal.enabled").Data() == false {
+			return true
+		}
+	}
+	return false
+}
+
+func toHostName(name string, index int) string {
+	return fmt.Sprintf("%s-%d", name, index)
 }
 
 // Process functional options
@@ -191,3 +3866,426 @@ func withFCV(fcv string) func(*Process) {
 		process.FeatureCompatibilityVersion = fcv
 	}
 }
+
+// memberOptions holds the settings configured for an individual replica set member.
+type memberOptions struct {
+	id                 *int
+	secondaryDelaySecs int
+	priority           *int
+	votes              *int
+	hidden             bool
+	tags               map[string]string
+	buildIndexes       *bool
+	arbiterOnly        bool
+	// hostName replaces the host name of the process
+	hostName string
+}
+
+// delayedBackupMemberOptions are the options of a hidden, non-voting member which replicates with a delay.
+func delayedBackupMemberOptions(delaySecs int) memberOptions {
+	zero := 0
+	return memberOptions{
+		secondaryDelaySecs: delaySecs,
+		priority:           &zero,
+		votes:              &zero,
+		hidden:             true,
+		tags:               map[string]string{"backup": "true"},
+	}
+}
+
+func (o memberOptions) apply(member *ReplicaSetMember, version string) {
+	if o.arbiterOnly {
+		// arbiters can't become primary
+		member.ArbiterOnly = true
+		member.Priority = 0
+	}
+	if o.priority != nil {
+		member.Priority = *o.priority
+	}
+	if o.votes != nil {
+		member.Votes = *o.votes
+	}
+	if o.hidden {
+		member.Hidden = true
+	}
+	if o.buildIndexes != nil {
+		buildIndexes := *o.buildIndexes
+		member.BuildIndexes = &buildIndexes
+	}
+	for name, value := range o.tags {
+		if member.Tags == nil {
+			member.Tags = map[string]string{}
+		}
+		member.Tags[name] = value
+	}
+	if o.secondaryDelaySecs > 0 {
+		if usesSecondaryDelaySecs(version) {
+			member.SecondaryDelaySecs = o.secondaryDelaySecs
+		} else {
+			member.SlaveDelay = o.secondaryDelaySecs
+		}
+	}
+}
+
+type agentProxy struct {
+	httpProxy  string
+	httpsProxy string
+	noProxy    string
+}
+
+func (p agentProxy) validate() error {
+	for _, proxy := range []string{p.httpProxy, p.httpsProxy} {
+		if proxy == "" {
+			continue
+		}
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return errors.Errorf("invalid agent proxy %q: %s", proxy, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("invalid agent proxy %q, must be an http or https URL", proxy)
+		}
+	}
+	return nil
+}
+
+type unixDomainSocket struct {
+	enabled    bool
+	pathPrefix string
+}
+
+// userCredentials are the SCRAM credentials configured for a user.
+type userCredentials struct {
+	username string
+	db       string
+	sha1     scramcredentials.ScramCreds
+	sha256   scramcredentials.ScramCreds
+}
+
+func (c userCredentials) apply(auth *Auth) {
+	for i := range auth.Users {
+		if auth.Users[i].Username == c.username && auth.Users[i].Database == c.db {
+			auth.Users[i].ScramSha1Creds = &c.sha1
+			auth.Users[i].ScramSha256Creds = &c.sha256
+			return
+		}
+	}
+	auth.Users = append(auth.Users, MongoDBUser{
+		Username:                   c.username,
+		Database:                   c.db,
+		Roles:                      []Role{},
+		Mechanisms:                 []string{},
+		AuthenticationRestrictions: []string{},
+		ScramSha1Creds:             &c.sha1,
+		ScramSha256Creds:           &c.sha256,
+	})
+}
+
+// mongosConnectionPool are the connection pool sizes configured with SetMongosConnectionPool.
+type mongosConnectionPool struct {
+	poolSize int
+	maxSize  int
+}
+
+// ttlMonitor are the TTL monitor settings configured with SetTTLMonitor.
+type ttlMonitor struct {
+	enabled   bool
+	sleepSecs int
+}
+
+// tlsOptions holds the TLS settings which are applied to every process.
+type tlsOptions struct {
+	mode           TLSMode
+	caFile         string
+	certAndKeyFile string
+	clusterFile    string
+	clusterCAFile  string
+
+	allowInvalidCertificates bool
+	allowInvalidHostnames    bool
+	logVersions              string
+	// weakCertificateValidation accepts clients presenting no certificate, see SetTLSWeakCertificateValidation
+	weakCertificateValidation bool
+	// certificateSelector selects the certificate from the certificate store of the OS, instead of certAndKeyFile
+	certificateSelector string
+	// rollingValidation rejects mode changes which skip an intermediate mode
+	rollingValidation bool
+	// validateFiles checks that the files exist and are readable when building
+	validateFiles bool
+	// strict rejects any option which weakens the validation of certificates
+	strict bool
+	// cipherConfig is the OpenSSL cipher string, nil if it wasn't configured
+	cipherConfig *string
+	// allowDisable allows disabling TLS on processes which had it enabled in the previous AutomationConfig
+	allowDisable bool
+	// allowConnectionsWithoutCertificates is configured per process type, it is allowed for the other types
+	allowConnectionsWithoutCertificates map[ProcessType]bool
+	// memberCertificateKeyFiles replace certAndKeyFile for the members with the given index
+	memberCertificateKeyFiles map[int]string
+	// certificateKeyFilePassword is a reference to the password of the certificate and key file, nil if not configured
+	certificateKeyFilePassword *string
+}
+
+// allowsConnectionsWithoutCertificates returns whether processes of the given type accept clients which don't
+// present a certificate.
+func (o tlsOptions) allowsConnectionsWithoutCertificates(processType ProcessType) bool {
+	if allow, ok := o.allowConnectionsWithoutCertificates[processType]; ok {
+		return allow
+	}
+	return true
+}
+
+// setConnectionsWithoutCertificatesArg configures whether the process accepts clients which don't present a
+// certificate. Weak certificate validation is written with its net.ssl name, which doesn't exist in net.tls.
+func (o tlsOptions) setConnectionsWithoutCertificatesArg(process *Process) {
+	if o.weakCertificateValidation && !usesTLSNamespace(process.Version) {
+		setTLSArg(process, "weakCertificateValidation", true)
+		return
+	}
+	setTLSArg(process, "allowConnectionsWithoutCertificates", o.weakCertificateValidation || o.allowsConnectionsWithoutCertificates(process.ProcessType))
+}
+
+func (o tlsOptions) enabled() bool {
+	return o.mode != "" && o.mode != TLSModeDisabled
+}
+
+// validateFilesReadable ensures every configured TLS file exists and can be read.
+func (o tlsOptions) validateFilesReadable() error {
+	files := []struct{ description, path string }{
+		{"CA file", o.caFile},
+		{"certificate and key file", o.certAndKeyFile},
+		{"cluster file", o.clusterFile},
+	}
+	indexes := []int{}
+	for index := range o.memberCertificateKeyFiles {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		files = append(files, struct{ description, path string }{fmt.Sprintf("certificate and key file of member %d", index), o.memberCertificateKeyFiles[index]})
+	}
+	for _, file := range files {
+		if file.path == "" {
+			continue
+		}
+		f, err := os.Open(file.path)
+		if err != nil {
+			return errors.Errorf("TLS %s %s is not readable: %s", file.description, file.path, err)
+		}
+		_ = f.Close()
+	}
+	return nil
+}
+
+// configureMongosTLS applies the TLS options to the mongos processes, which are added by modifications, unless
+// they configure TLS themselves, so that they can connect to the members.
+func (b *Builder) configureMongosTLS(ac *AutomationConfig) {
+	if !b.tls.enabled() {
+		return
+	}
+	for i := range ac.Processes {
+		p := &ac.Processes[i]
+		if p.ProcessType == Mongos && p.Args26.Get("net.tls.mode").Data() == nil && p.Args26.Get("net.ssl.mode").Data() == nil {
+			withTLS(b.tls)(p)
+		}
+	}
+}
+
+// sslArgNames maps the net.tls options to their net.ssl names, which are used
+// by MongoDB versions older than 4.2.
+var sslArgNames = map[string]string{
+	"certificateKeyFile":         "PEMKeyFile",
+	"certificateKeyFilePassword": "PEMKeyPassword",
+}
+
+// tlsArgOf returns a TLS option of the process, regardless of whether it is configured through net.tls or net.ssl.
+func tlsArgOf(process Process, name string) interface{} {
+	if value := process.Args26.Get("net.tls." + name).Data(); value != nil {
+		return value
+	}
+	if sslName, ok := sslArgNames[name]; ok {
+		name = sslName
+	}
+	return process.Args26.Get("net.ssl." + name).Data()
+}
+
+// setTLSArg sets a TLS option in the namespace supported by the version of the process.
+func setTLSArg(process *Process, name string, value interface{}) {
+	if usesTLSNamespace(process.Version) {
+		process.Args26.Set("net.tls."+name, value)
+		return
+	}
+	if sslName, ok := sslArgNames[name]; ok {
+		name = sslName
+	}
+	process.Args26.Set("net.ssl."+name, value)
+}
+
+// withTLS only configures the net.tls (or net.ssl) block, which is shared by every
+// process type, so it is safe to apply to processes without storage.
+func withTLS(opts tlsOptions) func(*Process) {
+	return func(process *Process) {
+		if usesTLSNamespace(process.Version) {
+			setTLSArg(process, "mode", opts.mode)
+		} else {
+			setTLSArg(process, "mode", opts.mode.SSLMode())
+		}
+		setTLSArg(process, "CAFile", opts.caFile)
+		if opts.certificateSelector != "" {
+			setTLSArg(process, "certificateSelector", opts.certificateSelector)
+		} else {
+			setTLSArg(process, "certificateKeyFile", opts.certAndKeyFile)
+		}
+		opts.setConnectionsWithoutCertificatesArg(process)
+		if opts.clusterFile != "" {
+			setTLSArg(process, "clusterFile", opts.clusterFile)
+		}
+		if opts.clusterCAFile != "" {
+			setTLSArg(process, "clusterCAFile", opts.clusterCAFile)
+		}
+		if opts.allowInvalidCertificates {
+			setTLSArg(process, "allowInvalidCertificates", true)
+		}
+		if opts.allowInvalidHostnames {
+			setTLSArg(process, "allowInvalidHostnames", true)
+		}
+		if opts.logVersions != "" {
+			setTLSArg(process, "logVersions", opts.logVersions)
+		}
+		if opts.cipherConfig != nil {
+			withSetParameter("opensslCipherConfig", *opts.cipherConfig)(process)
+		}
+		if opts.certificateKeyFilePassword != nil {
+			setTLSArg(process, "certificateKeyFilePassword", *opts.certificateKeyFilePassword)
+		}
+	}
+}
+
+func withTLSCertificateKeyFile(path string) func(*Process) {
+	return func(process *Process) {
+		setTLSArg(process, "certificateKeyFile", path)
+	}
+}
+
+func withCPUAffinity(cpus string) func(*Process) {
+	return func(process *Process) {
+		process.CPUAffinity = cpus
+	}
+}
+
+func withProfilingFilter(filter json.RawMessage) func(*Process) {
+	return func(process *Process) {
+		value := map[string]interface{}{}
+		// the filter has already been validated
+		_ = json.Unmarshal(filter, &value)
+		process.Args26.Set("operationProfiling.filter", value)
+	}
+}
+
+// withArgsTemplate merges the args of the process onto the template. The template is unmarshaled for
+// every process, so that they don't share any of its values.
+func withArgsTemplate(template json.RawMessage) func(*Process) {
+	return func(process *Process) {
+		args := map[string]interface{}{}
+		// the template has already been validated
+		_ = json.Unmarshal(template, &args)
+		mergeArgs(args, process.Args26)
+		process.Args26 = objx.New(args)
+	}
+}
+
+// mergeArgs merges src into dst. Nested objects are merged, any other value in src replaces the one in dst.
+func mergeArgs(dst, src map[string]interface{}) {
+	for name, value := range src {
+		srcObject, srcIsObject := toArgsObject(value)
+		dstObject, dstIsObject := toArgsObject(dst[name])
+		if srcIsObject && dstIsObject {
+			mergeArgs(dstObject, srcObject)
+			dst[name] = dstObject
+			continue
+		}
+		dst[name] = value
+	}
+}
+
+func toArgsObject(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case objx.Map:
+		return v, true
+	}
+	return nil, false
+}
+
+func withArg(name string, value interface{}) func(*Process) {
+	return func(process *Process) {
+		process.Args26.Set(name, value)
+	}
+}
+
+func withSetParameter(name string, value interface{}) func(*Process) {
+	return withArg("setParameter."+name, value)
+}
+
+func withDefaultRWConcern(concern DefaultRWConcern) func(*Process) {
+	return func(process *Process) {
+		process.DefaultRWConcern = &concern
+	}
+}
+
+func withUnixDomainSocket(uds unixDomainSocket) func(*Process) {
+	return func(process *Process) {
+		process.Args26.Set("net.unixDomainSocket.enabled", uds.enabled)
+		if uds.enabled && uds.pathPrefix != "" {
+			process.Args26.Set("net.unixDomainSocket.pathPrefix", uds.pathPrefix)
+		}
+	}
+}
+
+// withProcessManagement only sets the options which differ from the MongoDB defaults.
+func withProcessManagement(config ProcessManagementConfig) func(*Process) {
+	return func(process *Process) {
+		if config.Fork {
+			process.Args26.Set("processManagement.fork", true)
+		}
+		if config.PIDFilePath != "" {
+			process.Args26.Set("processManagement.pidFilePath", config.PIDFilePath)
+		}
+	}
+}
+
+// withAgentStartupArgs gives every process its own copy of the args, so mutators can change them per process.
+func withAgentStartupArgs(args map[string]interface{}) func(*Process) {
+	return func(process *Process) {
+		process.AgentStartupArgs = make(map[string]interface{}, len(args))
+		for name, value := range args {
+			process.AgentStartupArgs[name] = value
+		}
+	}
+}
+
+// withBindAllInterfaces uses net.bindIpAll when it is supported by the version of the process.
+// Older versions need IPv6 to be enabled explicitly to bind to "::".
+func withBindAllInterfaces() func(*Process) {
+	return func(process *Process) {
+		if isVersionAtLeast(process.Version, 3, 6) {
+			process.Args26.Set("net.bindIpAll", true)
+			return
+		}
+		process.Args26.Set("net.bindIp", "0.0.0.0,::")
+		process.Args26.Set("net.ipv6", true)
+	}
+}
+
+func withAuthSchemaVersion(version int) func(*Process) {
+	return func(process *Process) {
+		process.AuthSchemaVersion = version
+	}
+}
+
+func withClusterAuthMode(mode ClusterAuthMode) func(*Process) {
+	return func(process *Process) {
+		process.Args26.Set("security.clusterAuthMode", mode)
+	}
+}
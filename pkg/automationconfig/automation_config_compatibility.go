@@ -0,0 +1,162 @@
+package automationconfig
+
+import "github.com/pkg/errors"
+
+// CompatibilityReport describes how the options configured on a Builder are affected by
+// an upgrade to a target MongoDB version.
+type CompatibilityReport struct {
+	// TargetVersion is the MongoDB version the report was computed for
+	TargetVersion string
+	// Invalid are the configured options which the target version doesn't support
+	Invalid []string
+	// Converted are the configured options which are written differently for the target version.
+	// The Builder converts them on its own.
+	Converted []string
+	// RequiresFCVBump is true if the featureCompatibilityVersion has to be raised to TargetFCV
+	// after the upgrade, before the features of the target version can be used
+	RequiresFCVBump bool
+	// TargetFCV is the featureCompatibilityVersion of the target version
+	TargetFCV string
+	// NewlyAvailable are the options which the target version supports and the current version doesn't
+	NewlyAvailable []string
+}
+
+// versionGatedOption is an option which is only supported by a range of MongoDB versions.
+type versionGatedOption struct {
+	name string
+	// since is the first version supporting the option, nil if all versions support it
+	since *mongoDBVersion
+	// removedIn is the first version not supporting the option anymore, nil if it wasn't removed
+	removedIn  *mongoDBVersion
+	configured func(b *Builder) bool
+}
+
+// mongoDBVersion is a major.minor.patch MongoDB version.
+type mongoDBVersion struct {
+	major, minor, patch int
+}
+
+// supportedBy returns true if the given MongoDB version supports the option.
+func (o versionGatedOption) supportedBy(version string) bool {
+	if o.since != nil && !isPatchVersionAtLeast(version, o.since.major, o.since.minor, o.since.patch) {
+		return false
+	}
+	if o.removedIn != nil && isPatchVersionAtLeast(version, o.removedIn.major, o.removedIn.minor, o.removedIn.patch) {
+		return false
+	}
+	return true
+}
+
+// versionGatedOptions are the options of the Builder whose support depends on the MongoDB version.
+// They match the version checks done when the AutomationConfig is built.
+var versionGatedOptions = []versionGatedOption{
+	{
+		name:       "replication.secondaryIndexPrefetch",
+		removedIn:  &mongoDBVersion{3, 2, 0},
+		configured: func(b *Builder) bool { return b.secondaryIndexPrefetch != "" },
+	},
+	{
+		name:       "replication.enableMajorityReadConcern=false",
+		removedIn:  &mongoDBVersion{5, 0, 0},
+		configured: func(b *Builder) bool { return b.enableMajorityReadConcern != nil && !*b.enableMajorityReadConcern },
+	},
+	{
+		name:       "net.serviceExecutor",
+		since:      &mongoDBVersion{3, 6, 0},
+		removedIn:  &mongoDBVersion{5, 0, 0},
+		configured: func(b *Builder) bool { return b.serviceExecutor != "" },
+	},
+	{
+		name:       "cloud.monitoring.free.state",
+		since:      &mongoDBVersion{4, 0, 0},
+		configured: func(b *Builder) bool { return b.freeMonitoringState != "" },
+	},
+	{
+		name:       "storage.wiredTiger.engineConfig.maxCacheOverflowFileSizeGB",
+		since:      &mongoDBVersion{4, 0, 0},
+		removedIn:  &mongoDBVersion{4, 4, 0},
+		configured: func(b *Builder) bool { return b.maxCacheOverflowFileSizeGB != nil },
+	},
+	{
+		name:       "storage.wiredTiger.collectionConfig.blockCompressor=zstd",
+		since:      &mongoDBVersion{4, 2, 0},
+		configured: func(b *Builder) bool { return b.blockCompressor == "zstd" },
+	},
+	{
+		name:       "storage.wiredTiger.engineConfig.journalCompressor=zstd",
+		since:      &mongoDBVersion{4, 2, 0},
+		configured: func(b *Builder) bool { return b.journalCompressor == "zstd" },
+	},
+	{
+		name:       "setParameter.initialSyncSourceReadPreference",
+		since:      &mongoDBVersion{4, 4, 0},
+		configured: func(b *Builder) bool { return b.initialSyncSourceReadPreference != "" },
+	},
+	{
+		name:       "defaultRWConcern",
+		since:      &mongoDBVersion{4, 4, 0},
+		configured: func(b *Builder) bool { return b.defaultRWConcern != nil },
+	},
+	{
+		name:       "storage.oplogMinRetentionHours",
+		since:      &mongoDBVersion{4, 4, 0},
+		configured: func(b *Builder) bool { return b.oplogMinRetentionHours > 0 },
+	},
+	{
+		name:       "net.tls.logVersions",
+		since:      &mongoDBVersion{4, 4, 0},
+		configured: func(b *Builder) bool { return b.tls.logVersions != "" },
+	},
+	{
+		name:       "operationProfiling.filter",
+		since:      &mongoDBVersion{4, 4, 2},
+		configured: func(b *Builder) bool { return len(b.profilingFilter) > 0 },
+	},
+}
+
+// UpgradeCompatibilityReport checks the options configured on the Builder against the target
+// MongoDB version. An error is returned if the target version can't be parsed or is older than
+// the configured version.
+func (b *Builder) UpgradeCompatibilityReport(targetVersion string) (CompatibilityReport, error) {
+	targetFCV, ok := majorMinorOf(targetVersion)
+	if !ok {
+		return CompatibilityReport{}, errors.Errorf("invalid target version %q", targetVersion)
+	}
+	if major, minor, ok := parseMajorMinor(b.mongodbVersion); ok && !isVersionAtLeast(targetVersion, major, minor) {
+		return CompatibilityReport{}, errors.Errorf("target version %s is older than the current version %s", targetVersion, b.mongodbVersion)
+	}
+
+	report := CompatibilityReport{TargetVersion: targetVersion, TargetFCV: targetFCV}
+	for _, option := range versionGatedOptions {
+		if option.configured(b) && !option.supportedBy(targetVersion) {
+			report.Invalid = append(report.Invalid, option.name)
+		}
+		if option.supportedBy(targetVersion) && !option.supportedBy(b.mongodbVersion) {
+			report.NewlyAvailable = append(report.NewlyAvailable, option.name)
+		}
+	}
+
+	if b.tls.mode != "" && b.tls.mode != TLSModeDisabled && !usesTLSNamespace(b.mongodbVersion) && usesTLSNamespace(targetVersion) {
+		report.Converted = append(report.Converted, "net.ssl is written as net.tls")
+	}
+	if b.hasDelayedMembers() && !usesSecondaryDelaySecs(b.mongodbVersion) && usesSecondaryDelaySecs(targetVersion) {
+		report.Converted = append(report.Converted, "slaveDelay is written as secondaryDelaySecs")
+	}
+
+	currentFCV := b.effectiveFCV()
+	if currentFCV == "" {
+		currentFCV, _ = majorMinorOf(b.mongodbVersion)
+	}
+	report.RequiresFCVBump = currentFCV != targetFCV
+	return report, nil
+}
+
+// hasDelayedMembers returns true if any member of the replica set is delayed.
+func (b *Builder) hasDelayedMembers() bool {
+	for _, opts := range b.memberOptions {
+		if opts.secondaryDelaySecs > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package automationconfig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpgradeCompatibilityReport(t *testing.T) {
+	t.Run("Removed options are invalid", func(t *testing.T) {
+		report, err := newTestBuilder("4.4.0").SetServiceExecutor("adaptive").UpgradeCompatibilityReport("5.0.0")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"net.serviceExecutor"}, report.Invalid)
+		assert.True(t, report.RequiresFCVBump)
+		assert.Equal(t, "5.0", report.TargetFCV)
+	})
+
+	t.Run("Newly available options are listed", func(t *testing.T) {
+		report, err := newTestBuilder("4.2.0").UpgradeCompatibilityReport("4.4.2")
+		assert.NoError(t, err)
+		assert.Empty(t, report.Invalid)
+		assert.Equal(t, []string{
+			"setParameter.initialSyncSourceReadPreference",
+			"defaultRWConcern",
+			"storage.oplogMinRetentionHours",
+			"net.tls.logVersions",
+			"operationProfiling.filter",
+		}, report.NewlyAvailable)
+
+		report, err = newTestBuilder("4.4.0").UpgradeCompatibilityReport("4.4.2")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"operationProfiling.filter"}, report.NewlyAvailable)
+		assert.False(t, report.RequiresFCVBump, "patch upgrades keep the featureCompatibilityVersion")
+	})
+
+	t.Run("Configured options which stay supported are valid", func(t *testing.T) {
+		report, err := newTestBuilder("4.4.2").
+			SetProfilingFilter(json.RawMessage(`{"op": "query"}`)).
+			UpgradeCompatibilityReport("5.0.0")
+		assert.NoError(t, err)
+		assert.Empty(t, report.Invalid)
+	})
+
+	t.Run("Renamed options are converted", func(t *testing.T) {
+		report, err := newTestBuilder("4.0.0").
+			SetTLS(TLSModeRequired, "/ca.pem", "/server.pem").
+			SetMemberSecondaryDelay(2, 3600).
+			UpgradeCompatibilityReport("5.0.0")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"net.ssl is written as net.tls", "slaveDelay is written as secondaryDelaySecs"}, report.Converted)
+	})
+
+	t.Run("The featureCompatibilityVersion is compared with the target version", func(t *testing.T) {
+		report, err := newTestBuilder("4.4.0").SetFCV("4.2").UpgradeCompatibilityReport("4.4.6")
+		assert.NoError(t, err)
+		assert.True(t, report.RequiresFCVBump)
+	})
+
+	t.Run("Invalid target versions are rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").UpgradeCompatibilityReport("latest")
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").UpgradeCompatibilityReport("4.2.0")
+		assert.Error(t, err, "downgrades are rejected")
+	})
+}
@@ -0,0 +1,114 @@
+package automationconfig
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ConnectionStringOptions are the options added to the connection string of a replica set.
+type ConnectionStringOptions struct {
+	// ReadPreference is the default read preference mode, e.g. "secondaryPreferred"
+	ReadPreference string
+	// ReadPreferenceTags are the tag sets which select the members to read from, in order of preference.
+	// An empty tag set matches any member.
+	ReadPreferenceTags []map[string]string
+}
+
+// ConnectionString returns the connection string of the replica set with the given name, e.g.
+// "mongodb://my-rs-0.my-ns.svc.cluster.local:27017/?replicaSet=my-rs&readPreference=secondaryPreferred".
+// Hidden members and arbiters are not part of it, as clients can't read from them. Every tag set must
+// match at least one of the other members.
+func (ac AutomationConfig) ConnectionString(replicaSetName string, opts ConnectionStringOptions) (string, error) {
+	var rs *ReplicaSet
+	for i := range ac.ReplicaSets {
+		if ac.ReplicaSets[i].Id == replicaSetName {
+			rs = &ac.ReplicaSets[i]
+			break
+		}
+	}
+	if rs == nil {
+		return "", errors.Errorf("replica set %s is not part of the automation config", replicaSetName)
+	}
+	if err := validateReadPreference(opts); err != nil {
+		return "", err
+	}
+
+	processes := map[string]Process{}
+	for _, p := range ac.Processes {
+		processes[p.Name] = p
+	}
+	hosts := []string{}
+	members := []ReplicaSetMember{}
+	for _, m := range rs.Members {
+		if m.Hidden || m.ArbiterOnly {
+			continue
+		}
+		p, ok := processes[m.Host]
+		if !ok {
+			return "", errors.Errorf("member %s of replica set %s has no process", m.Host, rs.Id)
+		}
+		hosts = append(hosts, fmt.Sprintf("%s:%d", p.HostName, portOf(p)))
+		members = append(members, m)
+	}
+	for _, tags := range opts.ReadPreferenceTags {
+		if !anyMemberHasTags(members, tags) {
+			return "", errors.Errorf("no member of replica set %s has the read preference tags %s", rs.Id, formatTagSet(tags))
+		}
+	}
+
+	params := []string{"replicaSet=" + url.QueryEscape(rs.Id)}
+	if opts.ReadPreference != "" {
+		params = append(params, "readPreference="+opts.ReadPreference)
+	}
+	for _, tags := range opts.ReadPreferenceTags {
+		params = append(params, "readPreferenceTags="+formatTagSet(tags))
+	}
+	return fmt.Sprintf("mongodb://%s/?%s", strings.Join(hosts, ","), strings.Join(params, "&")), nil
+}
+
+func validateReadPreference(opts ConnectionStringOptions) error {
+	if opts.ReadPreference == "" {
+		if len(opts.ReadPreferenceTags) > 0 {
+			return errors.Errorf("read preference tags require a read preference")
+		}
+		return nil
+	}
+	if !isValidReadPreference(opts.ReadPreference) {
+		return errors.Errorf("invalid read preference %q, must be one of %s", opts.ReadPreference, strings.Join(readPreferences, ", "))
+	}
+	if opts.ReadPreference == "primary" && len(opts.ReadPreferenceTags) > 0 {
+		return errors.Errorf("read preference tags can't be used with read preference primary")
+	}
+	return nil
+}
+
+func anyMemberHasTags(members []ReplicaSetMember, tags map[string]string) bool {
+	for _, m := range members {
+		matches := true
+		for name, value := range tags {
+			if m.Tags[name] != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// formatTagSet formats the tag set as expected by readPreferenceTags, e.g. "dc:east,usage:reporting".
+// The tags are sorted so that the connection string is stable.
+func formatTagSet(tags map[string]string) string {
+	formatted := make([]string, 0, len(tags))
+	for name, value := range tags {
+		formatted = append(formatted, url.QueryEscape(name)+":"+url.QueryEscape(value))
+	}
+	sort.Strings(formatted)
+	return strings.Join(formatted, ",")
+}
@@ -0,0 +1,79 @@
+package automationconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionString(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").
+		ConfigureRegionTags(map[int]string{0: "us-east", 1: "us-east", 2: "us-west"}).
+		AddDelayedBackupMember(3600).
+		Build()
+	assert.NoError(t, err)
+	hosts := "my-rs-0.my-ns.svc.cluster.local:27017,my-rs-1.my-ns.svc.cluster.local:27017,my-rs-2.my-ns.svc.cluster.local:27017"
+
+	t.Run("Hidden members are not part of the connection string", func(t *testing.T) {
+		connectionString, err := ac.ConnectionString("my-rs", ConnectionStringOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "mongodb://"+hosts+"/?replicaSet=my-rs", connectionString)
+	})
+
+	t.Run("Processes without a port use the default one", func(t *testing.T) {
+		withoutPort := ac
+		withoutPort.Processes = make([]Process, len(ac.Processes))
+		for i, p := range ac.Processes {
+			p.Args26 = p.Args26.Copy()
+			p.Args26.Set("net", map[string]interface{}{})
+			withoutPort.Processes[i] = p
+		}
+		connectionString, err := withoutPort.ConnectionString("my-rs", ConnectionStringOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "mongodb://"+hosts+"/?replicaSet=my-rs", connectionString)
+	})
+
+	t.Run("Read preference and tags are added", func(t *testing.T) {
+		connectionString, err := ac.ConnectionString("my-rs", ConnectionStringOptions{
+			ReadPreference:     "secondaryPreferred",
+			ReadPreferenceTags: []map[string]string{{"region": "us-east"}, {}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "mongodb://"+hosts+"/?replicaSet=my-rs&readPreference=secondaryPreferred&readPreferenceTags=region:us-east&readPreferenceTags=", connectionString)
+	})
+
+	t.Run("Tags must exist on a member", func(t *testing.T) {
+		_, err := ac.ConnectionString("my-rs", ConnectionStringOptions{
+			ReadPreference:     "nearest",
+			ReadPreferenceTags: []map[string]string{{"region": "eu-west"}},
+		})
+		assert.Error(t, err)
+
+		_, err = ac.ConnectionString("my-rs", ConnectionStringOptions{
+			ReadPreference:     "nearest",
+			ReadPreferenceTags: []map[string]string{{"backup": "true"}},
+		})
+		assert.Error(t, err, "hidden members can't be read from")
+	})
+
+	t.Run("Invalid read preferences are rejected", func(t *testing.T) {
+		_, err := ac.ConnectionString("my-rs", ConnectionStringOptions{ReadPreference: "secondaries"})
+		assert.Error(t, err)
+
+		_, err = ac.ConnectionString("my-rs", ConnectionStringOptions{
+			ReadPreference:     "primary",
+			ReadPreferenceTags: []map[string]string{{"region": "us-east"}},
+		})
+		assert.Error(t, err)
+
+		_, err = ac.ConnectionString("my-rs", ConnectionStringOptions{
+			ReadPreferenceTags: []map[string]string{{"region": "us-east"}},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown replica sets are rejected", func(t *testing.T) {
+		_, err := ac.ConnectionString("other-rs", ConnectionStringOptions{})
+		assert.Error(t, err)
+	})
+}
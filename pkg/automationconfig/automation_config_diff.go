@@ -0,0 +1,399 @@
+package automationconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FieldChange is a single difference between two AutomationConfigs. Path uses the JSON field
+// names, e.g. "processes[2].args2_6.net.ssl.mode". Old is nil for added fields and New is nil
+// for removed ones.
+type FieldChange struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Path, c.Old, c.New)
+}
+
+// Diff returns the changes between two AutomationConfigs, ordered by path. The configs are compared
+// in their marshaled form, which is how the Builder decides if the version needs to be increased.
+func Diff(old, new AutomationConfig) ([]FieldChange, error) {
+	oldValue, err := toJSONValue(old)
+	if err != nil {
+		return nil, err
+	}
+	newValue, err := toJSONValue(new)
+	if err != nil {
+		return nil, err
+	}
+	changes := []FieldChange{}
+	diffValues("", oldValue, newValue, &changes)
+	return changes, nil
+}
+
+// toJSONValue converts the config to the generic value it is marshaled as. Numbers are kept
+// as json.Number so that they are compared exactly.
+func toJSONValue(ac AutomationConfig) (interface{}, error) {
+	acBytes, err := json.Marshal(ac)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(acBytes))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func diffValues(path string, old, new interface{}, changes *[]FieldChange) {
+	switch oldValue := old.(type) {
+	case map[string]interface{}:
+		if newValue, ok := new.(map[string]interface{}); ok {
+			diffMaps(path, oldValue, newValue, changes)
+			return
+		}
+	case []interface{}:
+		if newValue, ok := new.([]interface{}); ok {
+			diffSlices(path, oldValue, newValue, changes)
+			return
+		}
+	}
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, FieldChange{Path: path, Old: old, New: new})
+	}
+}
+
+func diffMaps(path string, old, new map[string]interface{}, changes *[]FieldChange) {
+	keys := []string{}
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		childPath := k
+		if path != "" {
+			childPath = path + "." + k
+		}
+		diffValues(childPath, old[k], new[k], changes)
+	}
+}
+
+func diffSlices(path string, old, new []interface{}, changes *[]FieldChange) {
+	length := len(old)
+	if len(new) > length {
+		length = len(new)
+	}
+	for i := 0; i < length; i++ {
+		var oldElem, newElem interface{}
+		if i < len(old) {
+			oldElem = old[i]
+		}
+		if i < len(new) {
+			newElem = new[i]
+		}
+		diffValues(fmt.Sprintf("%s[%d]", path, i), oldElem, newElem, changes)
+	}
+}
+
+// removeField removes the field at the given path, split at the dots, from the generic value of a config.
+// A segment ending in "[]" is an array, whose elements all have the rest of the path removed, e.g.
+// "processes[].args2_6". Paths which don't exist are ignored.
+func removeField(value interface{}, segments []string) {
+	forEachField(value, segments, func(object map[string]interface{}, name string) {
+		delete(object, name)
+	})
+}
+
+// forEachField calls f with the object containing each field at the given path, see removeField.
+// f is only called for fields which exist.
+func forEachField(value interface{}, segments []string, f func(object map[string]interface{}, name string)) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	name := strings.TrimSuffix(segments[0], "[]")
+	if len(segments) == 1 {
+		if _, ok := object[name]; ok {
+			f(object, name)
+		}
+		return
+	}
+	if name == segments[0] {
+		forEachField(object[name], segments[1:], f)
+		return
+	}
+	elems, _ := object[name].([]interface{})
+	for _, elem := range elems {
+		forEachField(elem, segments[1:], f)
+	}
+}
+
+// MergePatch returns the JSON Merge Patch (RFC 7386) which turns the old AutomationConfig into the new one.
+// As required by the RFC, arrays which changed are replaced entirely and removed fields are set to null.
+func MergePatch(old, new AutomationConfig) ([]byte, error) {
+	oldValue, err := toJSONValue(old)
+	if err != nil {
+		return nil, err
+	}
+	newValue, err := toJSONValue(new)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergePatchOf(oldValue.(map[string]interface{}), newValue.(map[string]interface{})))
+}
+
+func mergePatchOf(old, new map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for k, oldValue := range old {
+		if _, ok := new[k]; !ok {
+			patch[k] = nil
+			continue
+		}
+		newValue := new[k]
+		oldMap, oldIsMap := oldValue.(map[string]interface{})
+		newMap, newIsMap := newValue.(map[string]interface{})
+		if oldIsMap && newIsMap {
+			if child := mergePatchOf(oldMap, newMap); len(child) > 0 {
+				patch[k] = child
+			}
+			continue
+		}
+		if !reflect.DeepEqual(oldValue, newValue) {
+			patch[k] = newValue
+		}
+	}
+	for k, newValue := range new {
+		if _, ok := old[k]; !ok {
+			patch[k] = newValue
+		}
+	}
+	return patch
+}
+
+// restartRequiringArgs are the process options, relative to args2_6, which are only read when the process
+// starts. Changing any of them, or an option nested in them, requires the process to be restarted.
+var restartRequiringArgs = []string{
+	"auditLog",
+	"net.bindIp",
+	"net.port",
+	"net.ssl",
+	"net.tls",
+	"net.unixDomainSocket",
+	"processManagement",
+	"replication.oplogSizeMB",
+	"replication.replSetName",
+	"security.clusterAuthMode",
+	"security.enableEncryption",
+	"security.keyFile",
+	"setParameter.authenticationMechanisms",
+	"setParameter.enableLocalhostAuthBypass",
+	"sharding.clusterRole",
+	"storage",
+	"systemLog.path",
+}
+
+// processFieldPattern matches the path of a field of an existing process, e.g. "processes[2].args2_6.net.port".
+var processFieldPattern = regexp.MustCompile(`^processes\[\d+\]\.(.+)$`)
+
+// requiresRollingRestart returns true if any of the changes can only be applied by restarting the processes,
+// i.e. the version or an option in restartRequiringArgs of an existing process changed. Adding or removing
+// processes doesn't restart the other ones.
+func requiresRollingRestart(changes []FieldChange) bool {
+	for _, change := range changes {
+		match := processFieldPattern.FindStringSubmatch(change.Path)
+		if match == nil {
+			continue
+		}
+		field := match[1]
+		if field == "version" {
+			return true
+		}
+		if !strings.HasPrefix(field, "args2_6.") {
+			continue
+		}
+		arg := strings.TrimPrefix(field, "args2_6.")
+		for _, name := range restartRequiringArgs {
+			if arg == name || strings.HasPrefix(arg, name+".") || strings.HasPrefix(name, arg+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// VersionDiff is the difference between two lists of MongoDB versions, e.g. the catalog of versions the
+// operator offers before and after an update. Versions are ordered by version number and builds like in
+// the built AutomationConfig, so the output is stable.
+type VersionDiff struct {
+	// Added are the versions only offered by the new list
+	Added []MongoDbVersionConfig
+	// Removed are the versions only offered by the old list
+	Removed []MongoDbVersionConfig
+	// Modified are the versions offered by both lists whose builds differ
+	Modified []VersionChange
+}
+
+// VersionChange is the difference between the builds of a version offered by both lists.
+type VersionChange struct {
+	Name          string
+	AddedBuilds   []BuildConfig
+	RemovedBuilds []BuildConfig
+	// ModifiedBuilds are the builds for the same platform whose URL or git version changed
+	ModifiedBuilds []BuildChange
+}
+
+// BuildChange is a build for the same platform, architecture, flavor, OS versions and modules, whose
+// URL or git version changed.
+type BuildChange struct {
+	Old BuildConfig
+	New BuildConfig
+}
+
+// IsEmpty returns true if the lists offer the same versions with the same builds.
+func (d VersionDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// Summary describes each change in a line which can be surfaced in an event,
+// e.g. "now offering MongoDB 4.4.6 for linux/amd64".
+func (d VersionDiff) Summary() []string {
+	lines := []string{}
+	for _, version := range d.Added {
+		for _, build := range version.Builds {
+			lines = append(lines, fmt.Sprintf("now offering MongoDB %s for %s", version.Name, buildPlatform(build)))
+		}
+	}
+	for _, version := range d.Removed {
+		for _, build := range version.Builds {
+			lines = append(lines, fmt.Sprintf("no longer offering MongoDB %s for %s", version.Name, buildPlatform(build)))
+		}
+	}
+	for _, change := range d.Modified {
+		for _, build := range change.AddedBuilds {
+			lines = append(lines, fmt.Sprintf("now offering MongoDB %s for %s", change.Name, buildPlatform(build)))
+		}
+		for _, build := range change.RemovedBuilds {
+			lines = append(lines, fmt.Sprintf("no longer offering MongoDB %s for %s", change.Name, buildPlatform(build)))
+		}
+		for _, build := range change.ModifiedBuilds {
+			lines = append(lines, fmt.Sprintf("updated the build of MongoDB %s for %s", change.Name, buildPlatform(build.New)))
+		}
+	}
+	return lines
+}
+
+// buildPlatform describes the platform of a build, e.g. "linux/amd64 (ubuntu1804)".
+func buildPlatform(build BuildConfig) string {
+	platform := build.Platform + "/" + build.Architecture
+	if build.Flavor != "" {
+		platform += " (" + build.Flavor + ")"
+	}
+	return platform
+}
+
+// DiffVersions returns the versions and builds which were added, removed or modified in next compared to prev.
+// Versions listed more than once are merged, and identical builds are only reported once.
+func DiffVersions(prev, next []MongoDbVersionConfig) VersionDiff {
+	prevVersions, nextVersions := versionsByName(prev), versionsByName(next)
+	names := []string{}
+	for name := range prevVersions {
+		names = append(names, name)
+	}
+	for name := range nextVersions {
+		if _, ok := prevVersions[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return versionLess(names[i], names[j])
+	})
+
+	diff := VersionDiff{}
+	for _, name := range names {
+		prevBuilds, inPrev := prevVersions[name]
+		nextBuilds, inNext := nextVersions[name]
+		switch {
+		case !inPrev:
+			diff.Added = append(diff.Added, MongoDbVersionConfig{Name: name, Builds: nextBuilds})
+		case !inNext:
+			diff.Removed = append(diff.Removed, MongoDbVersionConfig{Name: name, Builds: prevBuilds})
+		default:
+			if change := diffBuilds(name, prevBuilds, nextBuilds); change != nil {
+				diff.Modified = append(diff.Modified, *change)
+			}
+		}
+	}
+	return diff
+}
+
+// versionsByName returns the normalized builds of each version.
+func versionsByName(versions []MongoDbVersionConfig) map[string][]BuildConfig {
+	builds := map[string][]BuildConfig{}
+	for _, version := range versions {
+		builds[version.Name] = append(builds[version.Name], version.Builds...)
+	}
+	for name := range builds {
+		builds[name] = normalizeBuilds(builds[name])
+	}
+	return builds
+}
+
+// diffBuilds returns the changes between the normalized builds of a version, nil if there are none.
+func diffBuilds(name string, prev, next []BuildConfig) *VersionChange {
+	prevByPlatform := map[string]BuildConfig{}
+	for _, build := range prev {
+		prevByPlatform[buildIdentity(build)] = build
+	}
+	nextByPlatform := map[string]BuildConfig{}
+	for _, build := range next {
+		nextByPlatform[buildIdentity(build)] = build
+	}
+
+	change := VersionChange{Name: name}
+	for _, build := range next {
+		previous, ok := prevByPlatform[buildIdentity(build)]
+		switch {
+		case !ok:
+			change.AddedBuilds = append(change.AddedBuilds, build)
+		case !reflect.DeepEqual(previous, build):
+			change.ModifiedBuilds = append(change.ModifiedBuilds, BuildChange{Old: previous, New: build})
+		}
+	}
+	for _, build := range prev {
+		if _, ok := nextByPlatform[buildIdentity(build)]; !ok {
+			change.RemovedBuilds = append(change.RemovedBuilds, build)
+		}
+	}
+	if len(change.AddedBuilds) == 0 && len(change.RemovedBuilds) == 0 && len(change.ModifiedBuilds) == 0 {
+		return nil
+	}
+	return &change
+}
+
+// buildIdentity identifies the platform a build is for, regardless of its URL and git version. The modules
+// of normalized builds are sorted.
+func buildIdentity(build BuildConfig) string {
+	return strings.Join([]string{
+		build.Platform,
+		build.Architecture,
+		build.Flavor,
+		build.MinOsVersion,
+		build.MaxOsVersion,
+		strings.Join(build.Modules, ","),
+	}, "\x00")
+}
@@ -0,0 +1,249 @@
+package automationconfig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	t.Run("Identical configs have no changes", func(t *testing.T) {
+		ac, err := newTestBuilder("4.0.0").Build()
+		assert.NoError(t, err)
+
+		changes, err := Diff(ac, ac)
+		assert.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+
+	t.Run("Changed fields are reported", func(t *testing.T) {
+		old, err := newTestBuilder("4.0.0").SetTLS(TLSModePreferred, "/tls/ca.crt", "/tls/server.pem").Build()
+		assert.NoError(t, err)
+		new, err := newTestBuilder("4.0.0").SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").Build()
+		assert.NoError(t, err)
+
+		changes, err := Diff(old, new)
+		assert.NoError(t, err)
+		assert.Equal(t, []FieldChange{
+			{Path: "processes[0].args2_6.net.ssl.mode", Old: "preferSSL", New: "requireSSL"},
+			{Path: "processes[1].args2_6.net.ssl.mode", Old: "preferSSL", New: "requireSSL"},
+			{Path: "processes[2].args2_6.net.ssl.mode", Old: "preferSSL", New: "requireSSL"},
+		}, changes)
+		assert.Equal(t, "processes[0].args2_6.net.ssl.mode: preferSSL -> requireSSL", changes[0].String())
+	})
+
+	t.Run("Added and removed fields are reported", func(t *testing.T) {
+		old, err := newTestBuilder("4.4.0").SetMembers(2).Build()
+		assert.NoError(t, err)
+		new, err := newTestBuilder("4.4.0").SetFreeMonitoring("off").Build()
+		assert.NoError(t, err)
+
+		changes, err := Diff(old, new)
+		assert.NoError(t, err)
+
+		paths := map[string]FieldChange{}
+		for _, c := range changes {
+			paths[c.Path] = c
+		}
+		assert.Contains(t, paths, "processes[0].args2_6.cloud")
+		assert.Nil(t, paths["processes[0].args2_6.cloud"].Old)
+		assert.Contains(t, paths, "processes[2]")
+		assert.Nil(t, paths["processes[2]"].Old)
+		assert.NotContains(t, paths, "version", "the version is the same until it is increased")
+
+		reverse, err := Diff(new, old)
+		assert.NoError(t, err)
+		for _, c := range reverse {
+			if c.Path == "processes[2]" {
+				assert.Nil(t, c.New)
+			}
+		}
+	})
+
+	t.Run("Numbers are compared exactly", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		changed, err := newTestBuilder("4.4.0").
+			AddProcessMutator(func(idx int, p *Process) {
+				p.Args26.Set("net.port", 27018)
+			}).
+			Build()
+		assert.NoError(t, err)
+
+		changes, err := Diff(ac, changed)
+		assert.NoError(t, err)
+		assert.Len(t, changes, 3)
+		assert.Equal(t, json.Number("27017"), changes[0].Old)
+		assert.Equal(t, json.Number("27018"), changes[0].New)
+	})
+}
+
+func TestMergePatch(t *testing.T) {
+	t.Run("Identical configs have an empty patch", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+
+		patch, err := MergePatch(ac, ac)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{}`, string(patch))
+	})
+
+	t.Run("Patch contains only the changes", func(t *testing.T) {
+		previous, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+
+		patch, err := newTestBuilder("4.4.0").
+			SetReplicaSetSettings(ReplicaSetSettings{ReplicaSetId: "5f7a2b7c9d3e4f1a2b3c4d5e"}).
+			SetPreviousAutomationConfig(previous).
+			BuildDelta()
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"version": 2, "replicaSets": [{"_id": "my-rs", "members": [
+			{"_id": 0, "host": "my-rs-0", "priority": 1, "arbiterOnly": false, "votes": 1},
+			{"_id": 1, "host": "my-rs-1", "priority": 1, "arbiterOnly": false, "votes": 1},
+			{"_id": 2, "host": "my-rs-2", "priority": 1, "arbiterOnly": false, "votes": 1}
+		], "protocolVersion": "1", "settings": {"replicaSetId": "5f7a2b7c9d3e4f1a2b3c4d5e"}}]}`, string(patch))
+	})
+
+	t.Run("Removed fields are set to null", func(t *testing.T) {
+		previous, err := newTestBuilder("4.4.0").SetAgentSettings(AgentSettings{LogLevel: "DEBUG"}).Build()
+		assert.NoError(t, err)
+
+		patch, err := newTestBuilder("4.4.0").SetPreviousAutomationConfig(previous).BuildDelta()
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"version": 2, "agentSettings": null}`, string(patch))
+	})
+
+	t.Run("Nested changes are merged", func(t *testing.T) {
+		old := AutomationConfig{Options: Options{DownloadBase: "/a"}, Auth: Auth{Disabled: true}}
+		new := AutomationConfig{Options: Options{DownloadBase: "/b"}, Auth: Auth{Disabled: true}}
+		patch, err := MergePatch(old, new)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"options": {"downloadBase": "/b"}}`, string(patch))
+	})
+}
+
+func TestRequiresRollingRestart(t *testing.T) {
+	newBuilder := func(members int) *Builder {
+		return newTestBuilder("4.4.0").
+			SetMembers(members)
+	}
+	previous, err := newBuilder(3).Build()
+	assert.NoError(t, err)
+
+	t.Run("Scaling doesn't require a restart", func(t *testing.T) {
+		result, err := newBuilder(5).SetPreviousAutomationConfig(previous).BuildWithResult()
+		assert.NoError(t, err)
+		assert.True(t, result.Changed)
+		assert.False(t, result.RequiresRollingRestart)
+	})
+
+	t.Run("Replica set settings don't require a restart", func(t *testing.T) {
+		result, err := newBuilder(3).ApplyWANPreset().SetPreviousAutomationConfig(previous).BuildWithResult()
+		assert.NoError(t, err)
+		assert.True(t, result.Changed)
+		assert.False(t, result.RequiresRollingRestart)
+	})
+
+	t.Run("TLS requires a restart", func(t *testing.T) {
+		result, err := newBuilder(3).
+			SetTLS(TLSModeAllowed, "/tls/ca.crt", "/tls/server.pem").
+			SetPreviousAutomationConfig(previous).
+			BuildWithResult()
+		assert.NoError(t, err)
+		assert.True(t, result.RequiresRollingRestart)
+	})
+
+	t.Run("Storage options require a restart", func(t *testing.T) {
+		result, err := newBuilder(3).SetStorageSyncPeriodSecs(30).SetPreviousAutomationConfig(previous).BuildWithResult()
+		assert.NoError(t, err)
+		assert.True(t, result.RequiresRollingRestart)
+	})
+
+	t.Run("Upgrades require a restart", func(t *testing.T) {
+		result, err := newBuilder(3).SetMongoDBVersion("4.4.1").SetPreviousAutomationConfig(previous).BuildWithResult()
+		assert.NoError(t, err)
+		assert.True(t, result.RequiresRollingRestart)
+	})
+
+	t.Run("Options added with their parent require a restart", func(t *testing.T) {
+		assert.True(t, requiresRollingRestart([]FieldChange{{Path: "processes[0].args2_6.net", New: map[string]interface{}{"port": 27017}}}))
+		assert.False(t, requiresRollingRestart([]FieldChange{{Path: "processes[0].args2_6.setParameter.diagnosticDataCollectionEnabled", New: false}}))
+		assert.False(t, requiresRollingRestart([]FieldChange{{Path: "processes[3]", New: map[string]interface{}{}}}))
+	})
+}
+
+func TestDiffVersions(t *testing.T) {
+	build := func(platform, architecture, gitVersion string) BuildConfig {
+		return BuildConfig{
+			Platform:     platform,
+			Architecture: architecture,
+			GitVersion:   gitVersion,
+			Flavor:       "ubuntu",
+			Url:          "https://fastdl.mongodb.org/" + platform + "/mongodb-" + gitVersion + ".tgz",
+			Modules:      []string{},
+		}
+	}
+	linux := build("linux", "amd64", "abc")
+	arm := build("linux", "aarch64", "abc")
+
+	t.Run("Identical lists have no changes", func(t *testing.T) {
+		versions := []MongoDbVersionConfig{{Name: "4.4.0", Builds: []BuildConfig{linux, arm}}}
+		reordered := []MongoDbVersionConfig{{Name: "4.4.0", Builds: []BuildConfig{arm, linux}}}
+		diff := DiffVersions(versions, reordered)
+		assert.True(t, diff.IsEmpty())
+		assert.Empty(t, diff.Summary())
+	})
+
+	t.Run("Added and removed versions are reported", func(t *testing.T) {
+		diff := DiffVersions(
+			[]MongoDbVersionConfig{{Name: "4.2.0", Builds: []BuildConfig{linux}}, {Name: "4.4.0", Builds: []BuildConfig{linux}}},
+			[]MongoDbVersionConfig{{Name: "4.4.0", Builds: []BuildConfig{linux}}, {Name: "4.4.6", Builds: []BuildConfig{linux}}},
+		)
+		assert.Equal(t, []MongoDbVersionConfig{{Name: "4.4.6", Builds: []BuildConfig{linux}}}, diff.Added)
+		assert.Equal(t, []MongoDbVersionConfig{{Name: "4.2.0", Builds: []BuildConfig{linux}}}, diff.Removed)
+		assert.Empty(t, diff.Modified)
+		assert.Equal(t, []string{
+			"now offering MongoDB 4.4.6 for linux/amd64 (ubuntu)",
+			"no longer offering MongoDB 4.2.0 for linux/amd64 (ubuntu)",
+		}, diff.Summary())
+	})
+
+	t.Run("Added, removed and modified builds are reported", func(t *testing.T) {
+		windows := build("windows", "amd64", "abc")
+		rebuilt := build("linux", "amd64", "def")
+		diff := DiffVersions(
+			[]MongoDbVersionConfig{{Name: "4.4.0", Builds: []BuildConfig{linux, windows}}},
+			[]MongoDbVersionConfig{{Name: "4.4.0", Builds: []BuildConfig{rebuilt, arm}}},
+		)
+		assert.Empty(t, diff.Added)
+		assert.Empty(t, diff.Removed)
+		assert.Equal(t, []VersionChange{{
+			Name:           "4.4.0",
+			AddedBuilds:    []BuildConfig{arm},
+			RemovedBuilds:  []BuildConfig{windows},
+			ModifiedBuilds: []BuildChange{{Old: linux, New: rebuilt}},
+		}}, diff.Modified)
+		assert.Equal(t, []string{
+			"now offering MongoDB 4.4.0 for linux/aarch64 (ubuntu)",
+			"no longer offering MongoDB 4.4.0 for windows/amd64 (ubuntu)",
+			"updated the build of MongoDB 4.4.0 for linux/amd64 (ubuntu)",
+		}, diff.Summary())
+	})
+
+	t.Run("Output is ordered by version regardless of the input order", func(t *testing.T) {
+		next := []MongoDbVersionConfig{
+			{Name: "4.4.10", Builds: []BuildConfig{linux}},
+			{Name: "4.2.0", Builds: []BuildConfig{linux}},
+			{Name: "4.4.9", Builds: []BuildConfig{linux}},
+		}
+		for i := 0; i < 10; i++ {
+			diff := DiffVersions(nil, next)
+			var names []string
+			for _, version := range diff.Added {
+				names = append(names, version.Name)
+			}
+			assert.Equal(t, []string{"4.2.0", "4.4.9", "4.4.10"}, names)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package automationconfig
+
+// FeatureSet summarizes the features the Builder enables, e.g. to report them in the status of a resource
+// without decoding the full AutomationConfig. When the Builder gains a new feature, it should be added here too.
+type FeatureSet struct {
+	TLS             bool            `json:"tls"`
+	TLSMode         TLSMode         `json:"tlsMode,omitempty"`
+	ClusterAuthMode ClusterAuthMode `json:"clusterAuthMode,omitempty"`
+	Auth            bool            `json:"auth"`
+	// AuthMechanism is the mechanism the agent authenticates with
+	AuthMechanism string      `json:"authMechanism,omitempty"`
+	Sharding      bool        `json:"sharding"`
+	ClusterRole   ClusterRole `json:"clusterRole,omitempty"`
+	Arbiters      int         `json:"arbiters"`
+	// DelayedMembers is the number of members with a secondary delay, including the delayed backup members
+	DelayedMembers   int  `json:"delayedMembers"`
+	EncryptionAtRest bool `json:"encryptionAtRest"`
+	Audit            bool `json:"audit"`
+}
+
+// EnabledFeatures returns the features the AutomationConfig will have, without building it. Process and
+// replica set mutators are taken into account, modifications are not as they operate on the full AutomationConfig.
+func (b *Builder) EnabledFeatures() FeatureSet {
+	features := FeatureSet{
+		TLS:             b.tls.enabled(),
+		ClusterAuthMode: b.clusterAuthMode,
+		ClusterRole:     b.clusterRole,
+		Sharding:        b.clusterRole != "" || b.configDB != "",
+	}
+	if features.TLS {
+		features.TLSMode = b.tls.mode
+	}
+
+	// the mechanism is left empty if the enablers conflict, Build reports the error
+	if auth, err := b.buildAuth(); err == nil && !auth.Disabled {
+		features.Auth = true
+		features.AuthMechanism = auth.AutoAuthMechanism
+	}
+
+	processes := b.buildProcesses()
+	for _, p := range processes {
+		if p.Args26.Get("security.enableEncryption").Data() == true {
+			features.EncryptionAtRest = true
+		}
+		if p.Args26.Get("auditLog").Data() != nil {
+			features.Audit = true
+		}
+	}
+
+	members, err := b.buildMembers(processes)
+	if err != nil {
+		return features
+	}
+	rs := ReplicaSet{Id: b.name, Members: members}
+	for _, mutator := range b.replicaSetMutators {
+		mutator(&rs)
+	}
+	features.Arbiters = arbiterCount(rs)
+	for _, m := range rs.Members {
+		if isDelayed(m) {
+			features.DelayedMembers++
+		}
+	}
+	return features
+}
@@ -0,0 +1,48 @@
+package automationconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnabledFeatures(t *testing.T) {
+	t.Run("No features are enabled by default", func(t *testing.T) {
+		assert.Equal(t, FeatureSet{}, newTestBuilder("4.4.0").EnabledFeatures())
+	})
+
+	t.Run("Features configured on the Builder are reported", func(t *testing.T) {
+		features := newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			SetClusterAuthMode(ClusterAuthModeX509).
+			SetAuthEnabler(mechanismEnabler{mechanism: "SCRAM-SHA-256"}).
+			SetClusterRole(ClusterRoleShardServer).
+			AddDelayedBackupMember(3600).
+			EnabledFeatures()
+
+		assert.True(t, features.TLS)
+		assert.Equal(t, TLSModeRequired, features.TLSMode)
+		assert.Equal(t, ClusterAuthModeX509, features.ClusterAuthMode)
+		assert.True(t, features.Auth)
+		assert.Equal(t, "SCRAM-SHA-256", features.AuthMechanism)
+		assert.True(t, features.Sharding)
+		assert.Equal(t, ClusterRoleShardServer, features.ClusterRole)
+		assert.Equal(t, 1, features.DelayedMembers)
+	})
+
+	t.Run("Features configured by mutators are reported", func(t *testing.T) {
+		features := newTestBuilder("4.4.0").
+			AddProcessMutator(func(_ int, p *Process) {
+				p.Args26.Set("security.enableEncryption", true)
+				p.Args26.Set("auditLog.destination", "file")
+			}).
+			AddReplicaSetMutator(func(rs *ReplicaSet) {
+				rs.Members[2].ArbiterOnly = true
+			}).
+			EnabledFeatures()
+
+		assert.True(t, features.EncryptionAtRest)
+		assert.True(t, features.Audit)
+		assert.Equal(t, 1, features.Arbiters)
+	})
+}
@@ -0,0 +1,100 @@
+package automationconfig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// UnmarshalAutomationConfig parses an AutomationConfig, e.g. the one last stored by the agent, so that it can be
+// used with SetPreviousAutomationConfig. In strict mode, fields which aren't part of the AutomationConfig are
+// rejected, which catches schema drift. Otherwise they are ignored.
+func UnmarshalAutomationConfig(data []byte, strict bool) (AutomationConfig, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	ac := AutomationConfig{}
+	if err := decoder.Decode(&ac); err != nil {
+		return AutomationConfig{}, errors.Errorf("could not unmarshal automation config: %s", err)
+	}
+	if decoder.More() {
+		return AutomationConfig{}, errors.Errorf("could not unmarshal automation config: unexpected data after the config")
+	}
+	return ac, nil
+}
+
+// MarshalJSON marshals the Auth, omitting the empty lists, except for a disabled authoritative Auth: it states
+// that there must be no users, so its lists are always emitted, as empty arrays if they are empty.
+func (a Auth) MarshalJSON() ([]byte, error) {
+	// auth has the fields of Auth without its methods, so that marshaling it doesn't recurse
+	type auth Auth
+	if !a.Disabled || !a.AuthoritativeSet {
+		return json.Marshal(auth(a))
+	}
+	populated := struct {
+		auth
+		Users                    []MongoDBUser `json:"usersWanted"`
+		AutoAuthMechanisms       []string      `json:"autoAuthMechanisms"`
+		DeploymentAuthMechanisms []string      `json:"deploymentAuthMechanisms"`
+	}{
+		auth:                     auth(a),
+		Users:                    append([]MongoDBUser{}, a.Users...),
+		AutoAuthMechanisms:       append([]string{}, a.AutoAuthMechanisms...),
+		DeploymentAuthMechanisms: append([]string{}, a.DeploymentAuthMechanisms...),
+	}
+	return json.Marshal(populated)
+}
+
+// redactedValue replaces the values of the sensitive fields in MarshalRedacted.
+const redactedValue = "<redacted>"
+
+// sensitiveFields are the paths, as used by SetIgnoreAgentManagedFieldsInBump, of the fields containing
+// credentials or secrets.
+var sensitiveFields = []string{
+	"auth.autoPwd",
+	"auth.key",
+	"auth.usersWanted[].scramSha1Creds",
+	"auth.usersWanted[].scramSha256Creds",
+	"processes[].args2_6.net.ssl.PEMKeyPassword",
+	"processes[].args2_6.net.ssl.clusterPassword",
+	"processes[].args2_6.net.tls.certificateKeyFilePassword",
+	"processes[].args2_6.net.tls.clusterPassword",
+	"processes[].args2_6.security.kmip.clientCertificatePassword",
+	"processes[].args2_6.security.ldap.bind.queryPassword",
+}
+
+// MarshalRedacted marshals the AutomationConfig like json.Marshal, with the values of the passwords, the keyfile
+// contents, the SCRAM credentials and the KMIP and LDAP secrets replaced by "<redacted>", so that it can be logged.
+// Fields which aren't set are left out as usual.
+func (ac AutomationConfig) MarshalRedacted() ([]byte, error) {
+	value, err := toJSONValue(ac)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not marshal automation config")
+	}
+	for _, path := range sensitiveFields {
+		forEachField(value, strings.Split(path, "."), func(object map[string]interface{}, name string) {
+			if object[name] != nil {
+				object[name] = redactedValue
+			}
+		})
+	}
+	return json.Marshal(value)
+}
+
+// Hash returns the SHA-256 of the marshaled AutomationConfig, which changes whenever its content does.
+// The version and the annotations are ignored, so configs only differing in them have the same hash.
+// Maps are marshaled with sorted keys, so the hash is stable.
+func (ac AutomationConfig) Hash() (string, error) {
+	ac.Version = 0
+	acBytes, err := json.Marshal(ac.withoutAnnotations())
+	if err != nil {
+		return "", errors.Wrapf(err, "could not marshal automation config")
+	}
+	sum := sha256.Sum256(acBytes)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,206 @@
+package automationconfig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scramcredentials"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalAutomationConfig(t *testing.T) {
+	ac, err := newTestBuilder("4.2.0").
+		AddVersion(defaultMongoDbVersion("4.2.0")).
+		Build()
+	assert.NoError(t, err)
+
+	acBytes, err := json.Marshal(ac)
+	assert.NoError(t, err)
+
+	// fields the agent or Ops Manager store, which the operator doesn't use
+	withExtraFields := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(acBytes, &withExtraFields))
+	withExtraFields["monitoringVersions"] = []interface{}{}
+	withExtraFields["backupVersions"] = []interface{}{}
+	withExtraFields["indexConfigs"] = []interface{}{}
+	withExtraFields["roles"] = []interface{}{}
+	extraBytes, err := json.Marshal(withExtraFields)
+	assert.NoError(t, err)
+
+	t.Run("Known fields are accepted in both modes", func(t *testing.T) {
+		for _, strict := range []bool{true, false} {
+			parsed, err := UnmarshalAutomationConfig(acBytes, strict)
+			assert.NoError(t, err)
+			assert.Equal(t, ac.Version, parsed.Version)
+			assert.Len(t, parsed.Processes, 3)
+			assert.Equal(t, "my-rs", parsed.ReplicaSets[0].Id)
+		}
+	})
+
+	t.Run("Unknown fields are rejected in strict mode", func(t *testing.T) {
+		_, err := UnmarshalAutomationConfig(extraBytes, true)
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown fields are ignored in lenient mode", func(t *testing.T) {
+		parsed, err := UnmarshalAutomationConfig(extraBytes, false)
+		assert.NoError(t, err)
+		assert.Len(t, parsed.Processes, 3)
+	})
+
+	t.Run("Parsed config can be used as the previous config", func(t *testing.T) {
+		parsed, err := UnmarshalAutomationConfig(extraBytes, false)
+		assert.NoError(t, err)
+
+		result, err := newTestBuilder("4.2.0").
+			AddVersion(defaultMongoDbVersion("4.2.0")).
+			SetPreviousAutomationConfig(parsed).
+			BuildWithResult()
+		assert.NoError(t, err)
+		assert.False(t, result.Changed)
+	})
+
+	t.Run("Invalid JSON is rejected", func(t *testing.T) {
+		_, err := UnmarshalAutomationConfig([]byte(`{"version": "one"}`), false)
+		assert.Error(t, err)
+
+		_, err = UnmarshalAutomationConfig([]byte(`{"version": 1} {"version": 2}`), false)
+		assert.Error(t, err)
+	})
+}
+
+func TestHash(t *testing.T) {
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.2.0").
+			AddVersion(defaultMongoDbVersion("4.2.0"))
+	}
+	ac, err := newBuilder().Build()
+	assert.NoError(t, err)
+	hash, err := ac.Hash()
+	assert.NoError(t, err)
+	assert.Len(t, hash, 64)
+
+	t.Run("Hash is stable", func(t *testing.T) {
+		rebuilt, err := newBuilder().Build()
+		assert.NoError(t, err)
+		rebuiltHash, err := rebuilt.Hash()
+		assert.NoError(t, err)
+		assert.Equal(t, hash, rebuiltHash)
+
+		acBytes, err := json.Marshal(ac)
+		assert.NoError(t, err)
+		unmarshaled, err := UnmarshalAutomationConfig(acBytes, true)
+		assert.NoError(t, err)
+		unmarshaledHash, err := unmarshaled.Hash()
+		assert.NoError(t, err)
+		assert.Equal(t, hash, unmarshaledHash, "the hash should not change when the config is stored and read back")
+	})
+
+	t.Run("Version is ignored", func(t *testing.T) {
+		ac := ac
+		ac.Version = 42
+		versionHash, err := ac.Hash()
+		assert.NoError(t, err)
+		assert.Equal(t, hash, versionHash)
+	})
+
+	t.Run("Content changes change the hash", func(t *testing.T) {
+		changed, err := newBuilder().SetMembers(5).Build()
+		assert.NoError(t, err)
+		changedHash, err := changed.Hash()
+		assert.NoError(t, err)
+		assert.NotEqual(t, hash, changedHash)
+	})
+}
+
+func TestMarshalRedacted(t *testing.T) {
+	alice := MongoDBUser{Username: "alice", Database: "admin", Roles: []Role{}}
+	creds := scramcredentials.ScramCreds{IterationCount: 15000, Salt: "salt-secret", ServerKey: "server-secret", StoredKey: "stored-secret"}
+	ac, err := newTestBuilder("4.4.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		SetTLSCertificateKeyFilePassword("password-secret").
+		EnableSCRAM(alice).
+		SetSCRAMAgentCredentials("agent-secret", "keyfile-secret").
+		SetUserSCRAMCredentials("alice", "admin", creds, creds).
+		Build()
+	assert.NoError(t, err)
+	ac.Processes[0].Args26.Set("security.kmip.clientCertificatePassword", "kmip-secret")
+
+	redacted, err := ac.MarshalRedacted()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(redacted), "secret")
+
+	parsed := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(redacted, &parsed))
+	auth := parsed["auth"].(map[string]interface{})
+	assert.Equal(t, "<redacted>", auth["autoPwd"])
+	assert.Equal(t, "<redacted>", auth["key"])
+	assert.Equal(t, "<redacted>", auth["usersWanted"].([]interface{})[0].(map[string]interface{})["scramSha256Creds"])
+	assert.Equal(t, "alice", auth["usersWanted"].([]interface{})[0].(map[string]interface{})["user"], "other fields are kept")
+
+	t.Run("Fields which aren't set are left out", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			Build()
+		assert.NoError(t, err)
+
+		redacted, err := ac.MarshalRedacted()
+		assert.NoError(t, err)
+		expected, err := json.Marshal(ac)
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(expected), string(redacted))
+	})
+}
+
+func TestAuthoritativeEmptyAuth(t *testing.T) {
+	authOf := func(t *testing.T, ac AutomationConfig) map[string]interface{} {
+		acBytes, err := json.Marshal(ac)
+		assert.NoError(t, err)
+		value := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(acBytes, &value))
+		return value["auth"].(map[string]interface{})
+	}
+
+	t.Run("Empty fields are omitted by default", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"disabled":          true,
+			"authoritativeSet":  false,
+			"autoAuthMechanism": "MONGODB-CR",
+		}, authOf(t, ac))
+	})
+
+	t.Run("Authoritative empty auth is fully populated", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").SetAuthoritativeEmptyAuth(true).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"usersWanted":              []interface{}{},
+			"disabled":                 true,
+			"authoritativeSet":         true,
+			"autoAuthMechanisms":       []interface{}{},
+			"autoAuthMechanism":        "MONGODB-CR",
+			"deploymentAuthMechanisms": []interface{}{},
+		}, authOf(t, ac))
+	})
+
+	t.Run("The shape survives a round trip without a version bump", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").SetAuthoritativeEmptyAuth(true).Build()
+		assert.NoError(t, err)
+		acBytes, err := json.Marshal(ac)
+		assert.NoError(t, err)
+		previous, err := UnmarshalAutomationConfig(acBytes, true)
+		assert.NoError(t, err)
+
+		rebuilt, err := newTestBuilder("4.4.0").SetAuthoritativeEmptyAuth(true).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, ac.Version, rebuilt.Version)
+	})
+
+	t.Run("It has no effect when authentication is enabled", func(t *testing.T) {
+		enabled, err := newTestBuilder("4.4.0").SetSCRAMAgentCredentials("my-password", "my-keyfile").EnableSCRAM().Build()
+		assert.NoError(t, err)
+		authoritative, err := newTestBuilder("4.4.0").SetSCRAMAgentCredentials("my-password", "my-keyfile").EnableSCRAM().SetAuthoritativeEmptyAuth(true).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, authOf(t, enabled), authOf(t, authoritative))
+	})
+}
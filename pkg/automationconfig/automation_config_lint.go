@@ -0,0 +1,94 @@
+package automationconfig
+
+import (
+	"fmt"
+)
+
+const (
+	LintEvenVotingMembers      = "EvenVotingMembers"
+	LintSingleMemberReplicaSet = "SingleMemberReplicaSet"
+	LintTLSNotRequired         = "TLSNotRequired"
+	LintAuthDisabled           = "AuthDisabled"
+	LintFCVMismatch            = "FCVMismatch"
+)
+
+// LintWarning is a non-fatal advisory about a configuration which is valid, but doesn't follow best practices.
+type LintWarning struct {
+	// Check identifies the check which produced the warning
+	Check   string
+	Message string
+}
+
+// Lint inspects the AutomationConfig for common mistakes. Unlike the validation performed by the Builder,
+// none of the returned warnings prevent the config from being applied.
+func Lint(ac AutomationConfig) []LintWarning {
+	var warnings []LintWarning
+	for _, rs := range ac.ReplicaSets {
+		if len(rs.Members) == 1 {
+			warnings = append(warnings, LintWarning{
+				Check:   LintSingleMemberReplicaSet,
+				Message: fmt.Sprintf("replica set %s has a single member and can't tolerate any failure", rs.Id),
+			})
+		}
+		votingMembers := 0
+		for _, m := range rs.Members {
+			if m.Votes > 0 {
+				votingMembers++
+			}
+		}
+		if votingMembers > 0 && votingMembers%2 == 0 {
+			warnings = append(warnings, LintWarning{
+				Check:   LintEvenVotingMembers,
+				Message: fmt.Sprintf("replica set %s has an even number of voting members (%d), consider adding or removing a voting member", rs.Id, votingMembers),
+			})
+		}
+	}
+
+	for _, p := range ac.Processes {
+		if mode := tlsModeOf(p); mode == TLSModeAllowed || mode == TLSModePreferred {
+			warnings = append(warnings, LintWarning{
+				Check:   LintTLSNotRequired,
+				Message: fmt.Sprintf("process %s accepts connections which don't use TLS (mode %s)", p.Name, mode),
+			})
+		}
+		if fcv, ok := majorMinorOf(p.Version); ok && p.FeatureCompatibilityVersion != "" && p.FeatureCompatibilityVersion != fcv {
+			warnings = append(warnings, LintWarning{
+				Check:   LintFCVMismatch,
+				Message: fmt.Sprintf("process %s runs version %s with feature compatibility version %s", p.Name, p.Version, p.FeatureCompatibilityVersion),
+			})
+		}
+	}
+
+	if ac.Auth.Disabled {
+		warnings = append(warnings, LintWarning{
+			Check:   LintAuthDisabled,
+			Message: "authentication is disabled",
+		})
+	}
+	return warnings
+}
+
+// tlsModeOf returns the TLS mode of the process, regardless of whether it is configured through net.tls or net.ssl.
+func tlsModeOf(p Process) TLSMode {
+	if mode, ok := p.Args26.Get("net.tls.mode").Data().(TLSMode); ok {
+		return mode
+	}
+	if mode, ok := p.Args26.Get("net.tls.mode").Data().(string); ok {
+		return TLSMode(mode)
+	}
+	sslMode := p.Args26.Get("net.ssl.mode").Data()
+	if mode, ok := sslMode.(string); ok {
+		sslMode = SSLMode(mode)
+	}
+	switch sslMode {
+	case SSLModeAllowed:
+		return TLSModeAllowed
+	case SSLModePreferred:
+		return TLSModePreferred
+	case SSLModeRequired:
+		return TLSModeRequired
+	case SSLModeDisabled:
+		return TLSModeDisabled
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package automationconfig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lintChecks(warnings []LintWarning) []string {
+	checks := make([]string, len(warnings))
+	for i, w := range warnings {
+		checks[i] = w.Check
+	}
+	return checks
+}
+
+func TestLint(t *testing.T) {
+	t.Run("A recommended configuration has no warnings", func(t *testing.T) {
+		ac, err := newTestBuilder("4.2.0").
+			SetFCV("4.2").
+			SetMembers(3).
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			SetAuthEnabler(scramLikeEnabler{}).
+			Build()
+		assert.NoError(t, err)
+		assert.Empty(t, Lint(ac))
+	})
+
+	t.Run("Common mistakes are reported", func(t *testing.T) {
+		ac, err := newTestBuilder("4.2.0").
+			SetFCV("4.0").
+			SetMembers(2).
+			SetTLS(TLSModePreferred, "/tls/ca.crt", "/tls/server.pem").
+			Build()
+		assert.NoError(t, err)
+
+		checks := lintChecks(Lint(ac))
+		assert.Contains(t, checks, LintEvenVotingMembers)
+		assert.Contains(t, checks, LintTLSNotRequired)
+		assert.Contains(t, checks, LintAuthDisabled)
+		assert.Contains(t, checks, LintFCVMismatch)
+		assert.NotContains(t, checks, LintSingleMemberReplicaSet)
+	})
+
+	t.Run("Single member replica sets are reported", func(t *testing.T) {
+		ac, err := newTestBuilder("4.0.0").
+			SetFCV("4.0").
+			SetMembers(1).
+			SetTLS(TLSModeAllowed, "/tls/ca.crt", "/tls/server.pem").
+			Build()
+		assert.NoError(t, err)
+
+		checks := lintChecks(Lint(ac))
+		assert.Contains(t, checks, LintSingleMemberReplicaSet)
+		assert.Contains(t, checks, LintTLSNotRequired, "net.ssl modes should be inspected for older versions")
+	})
+
+	t.Run("Configs read from JSON are inspected", func(t *testing.T) {
+		ac, err := newTestBuilder("4.2.0").
+			SetFCV("4.2").
+			SetMembers(3).
+			SetTLS(TLSModePreferred, "/tls/ca.crt", "/tls/server.pem").
+			Build()
+		assert.NoError(t, err)
+
+		bytes, err := json.Marshal(ac)
+		assert.NoError(t, err)
+		fromJSON := AutomationConfig{}
+		assert.NoError(t, json.Unmarshal(bytes, &fromJSON))
+		assert.Contains(t, lintChecks(Lint(fromJSON)), LintTLSNotRequired)
+	})
+}
+
+type scramLikeEnabler struct{}
+
+func (scramLikeEnabler) EnableAuth(auth Auth) Auth {
+	auth.Disabled = false
+	auth.AutoAuthMechanism = "SCRAM-SHA-256"
+	auth.AutoAuthMechanisms = []string{"SCRAM-SHA-256"}
+	auth.DeploymentAuthMechanisms = []string{"SCRAM-SHA-256"}
+	return auth
+}
@@ -0,0 +1,39 @@
+package automationconfig
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// opsManagerImport is the part of an AutomationConfig Ops Manager imports a deployment from.
+type opsManagerImport struct {
+	Processes   []Process    `json:"processes"`
+	ReplicaSets []ReplicaSet `json:"replicaSets"`
+	Auth        Auth         `json:"auth"`
+	// SSL is the name Ops Manager uses for the TLS settings
+	SSL TLS `json:"ssl"`
+}
+
+// ToOpsManagerImport returns the deployment in the form the automation config API of Ops Manager imports it
+// from: the processes, replica sets, authentication and TLS settings. The following fields don't map to the
+// deployment and are dropped:
+//
+//	version:          Ops Manager assigns the versions of its own configs
+//	mongoDbVersions:  Ops Manager downloads the builds listed in its version manifest
+//	options:          the download directory is configured for each agent
+//	agentSettings:    the agent settings are configured for each agent
+//	agentVersion:     Ops Manager upgrades the agents itself
+//	annotations:      they describe what built the config, not the deployment
+func (ac AutomationConfig) ToOpsManagerImport() ([]byte, error) {
+	data, err := json.Marshal(opsManagerImport{
+		Processes:   ac.Processes,
+		ReplicaSets: ac.ReplicaSets,
+		Auth:        ac.Auth,
+		SSL:         ac.TLS,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not marshal the Ops Manager import")
+	}
+	return data, nil
+}
@@ -0,0 +1,36 @@
+package automationconfig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToOpsManagerImport(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		AddVersion(defaultMongoDbVersion("4.4.0")).
+		SetGoalStateAnnotations(map[string]string{"generation": "1"}).
+		Build()
+	assert.NoError(t, err)
+
+	data, err := ac.ToOpsManagerImport()
+	assert.NoError(t, err)
+
+	payload := map[string]json.RawMessage{}
+	assert.NoError(t, json.Unmarshal(data, &payload))
+	assert.Len(t, payload, 4)
+	for _, field := range []string{"processes", "replicaSets", "auth", "ssl"} {
+		assert.Contains(t, payload, field)
+	}
+
+	var processes []Process
+	assert.NoError(t, json.Unmarshal(payload["processes"], &processes))
+	assert.Len(t, processes, 3)
+	assert.Equal(t, "my-rs-0.my-ns.svc.cluster.local", processes[0].HostName)
+
+	var ssl TLS
+	assert.NoError(t, json.Unmarshal(payload["ssl"], &ssl))
+	assert.Equal(t, ac.TLS, ssl)
+}
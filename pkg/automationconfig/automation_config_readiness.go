@@ -0,0 +1,32 @@
+package automationconfig
+
+// ReadinessTarget describes how a readiness probe connects to a process.
+type ReadinessTarget struct {
+	// Name is the name of the process
+	Name string
+	Host string
+	Port int
+	// TLSEnabled is true if the process accepts TLS connections, TLSRequired if it only accepts TLS connections
+	TLSEnabled  bool
+	TLSRequired bool
+	// AuthRequired is true if clients have to authenticate
+	AuthRequired bool
+}
+
+// ReadinessTargets returns the ReadinessTarget of each process, in the order of the processes. They are derived
+// from the options of the processes, so that probes connect the same way as clients do.
+func (ac AutomationConfig) ReadinessTargets() []ReadinessTarget {
+	targets := make([]ReadinessTarget, 0, len(ac.Processes))
+	for _, p := range ac.Processes {
+		mode := tlsModeOrDisabled(p)
+		targets = append(targets, ReadinessTarget{
+			Name:         p.Name,
+			Host:         p.HostName,
+			Port:         portOf(p),
+			TLSEnabled:   mode != TLSModeDisabled,
+			TLSRequired:  mode == TLSModeRequired,
+			AuthRequired: !ac.Auth.Disabled,
+		})
+	}
+	return targets
+}
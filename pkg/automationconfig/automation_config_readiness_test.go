@@ -0,0 +1,58 @@
+package automationconfig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadinessTargets(t *testing.T) {
+	t.Run("Without TLS and authentication", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		targets := ac.ReadinessTargets()
+		assert.Len(t, targets, 3)
+		assert.Equal(t, ReadinessTarget{
+			Name: "my-rs-0",
+			Host: "my-rs-0.my-ns.svc.cluster.local",
+			Port: 27017,
+		}, targets[0])
+	})
+
+	t.Run("TLS and authentication are required", func(t *testing.T) {
+		ac, err := newTestBuilder("4.0.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			EnableSCRAM().
+			SetSCRAMAgentCredentials("agent-password", "keyfile-contents").
+			Build()
+		assert.NoError(t, err)
+		for _, target := range ac.ReadinessTargets() {
+			assert.True(t, target.TLSEnabled)
+			assert.True(t, target.TLSRequired)
+			assert.True(t, target.AuthRequired)
+		}
+	})
+
+	t.Run("TLS is optional", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").SetTLS(TLSModePreferred, "/tls/ca.crt", "/tls/server.pem").Build()
+		assert.NoError(t, err)
+		target := ac.ReadinessTargets()[0]
+		assert.True(t, target.TLSEnabled)
+		assert.False(t, target.TLSRequired)
+	})
+
+	t.Run("The port of an unmarshaled config is read", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			AddProcessMutator(func(idx int, p *Process) {
+				p.Args26.Set("net.port", 27018)
+			}).
+			Build()
+		assert.NoError(t, err)
+		acBytes, err := json.Marshal(ac)
+		assert.NoError(t, err)
+		unmarshaled, err := UnmarshalAutomationConfig(acBytes, true)
+		assert.NoError(t, err)
+		assert.Equal(t, 27018, unmarshaled.ReadinessTargets()[0].Port)
+	})
+}
@@ -0,0 +1,258 @@
+package automationconfig
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/objx"
+)
+
+// argsSchemaRelease lists the args2_6 options added and removed by a MongoDB release, relative to the
+// previous release. Options ending in ".*" allow any option below them, e.g. the free-form setParameter.
+type argsSchemaRelease struct {
+	version string
+	added   []string
+	removed []string
+}
+
+// argsSchemaReleases are the MongoDB releases the args2_6 options can be validated for, oldest first.
+var argsSchemaReleases = []argsSchemaRelease{
+	{
+		version: "3.6",
+		added: []string{
+			"auditLog.destination",
+			"auditLog.filter",
+			"auditLog.format",
+			"auditLog.path",
+			"net.bindIp",
+			"net.bindIpAll",
+			"net.compression.compressors",
+			"net.ipv6",
+			"net.maxIncomingConnections",
+			"net.port",
+			"net.serviceExecutor",
+			"net.ssl.CAFile",
+			"net.ssl.CRLFile",
+			"net.ssl.FIPSMode",
+			"net.ssl.PEMKeyFile",
+			"net.ssl.PEMKeyPassword",
+			"net.ssl.allowConnectionsWithoutCertificates",
+			"net.ssl.allowInvalidCertificates",
+			"net.ssl.allowInvalidHostnames",
+			"net.ssl.clusterFile",
+			"net.ssl.clusterPassword",
+			"net.ssl.disabledProtocols",
+			"net.ssl.mode",
+			"net.ssl.weakCertificateValidation",
+			"net.unixDomainSocket.enabled",
+			"net.unixDomainSocket.filePermissions",
+			"net.unixDomainSocket.pathPrefix",
+			"net.wireObjectCheck",
+			"operationProfiling.mode",
+			"operationProfiling.slowOpSampleRate",
+			"operationProfiling.slowOpThresholdMs",
+			"processManagement.fork",
+			"processManagement.pidFilePath",
+			"processManagement.timeZoneInfo",
+			"replication.enableMajorityReadConcern",
+			"replication.localPingThresholdMs",
+			"replication.oplogSizeMB",
+			"replication.replSetName",
+			"security.authorization",
+			"security.clusterAuthMode",
+			"security.enableEncryption",
+			"security.encryptionCipherMode",
+			"security.encryptionKeyFile",
+			"security.javascriptEnabled",
+			"security.keyFile",
+			"security.kmip.*",
+			"security.ldap.*",
+			"security.redactClientLogData",
+			"setParameter.*",
+			"sharding.archiveMovedChunks",
+			"sharding.clusterRole",
+			"sharding.configDB",
+			"storage.dbPath",
+			"storage.directoryPerDB",
+			"storage.engine",
+			"storage.inMemory.engineConfig.inMemorySizeGB",
+			"storage.journal.commitIntervalMs",
+			"storage.journal.enabled",
+			"storage.mmapv1.*",
+			"storage.syncPeriodSecs",
+			"storage.wiredTiger.collectionConfig.blockCompressor",
+			"storage.wiredTiger.engineConfig.cacheSizeGB",
+			"storage.wiredTiger.engineConfig.directoryForIndexes",
+			"storage.wiredTiger.engineConfig.journalCompressor",
+			"storage.wiredTiger.indexConfig.prefixCompression",
+			"systemLog.component.*",
+			"systemLog.destination",
+			"systemLog.logAppend",
+			"systemLog.logRotate",
+			"systemLog.path",
+			"systemLog.quiet",
+			"systemLog.timeStampFormat",
+			"systemLog.verbosity",
+		},
+	},
+	{
+		version: "4.0",
+		added: []string{
+			"cloud.monitoring.free.state",
+			"cloud.monitoring.free.tags",
+			"net.ssl.certificateSelector",
+			"net.ssl.clusterCAFile",
+			"net.ssl.clusterCertificateSelector",
+			"storage.wiredTiger.engineConfig.maxCacheOverflowFileSizeGB",
+		},
+	},
+	{
+		// MongoDB 4.2 renamed the net.ssl options to net.tls and removed the MMAPv1 storage engine.
+		version: "4.2",
+		added: []string{
+			"net.tls.CAFile",
+			"net.tls.CRLFile",
+			"net.tls.FIPSMode",
+			"net.tls.allowConnectionsWithoutCertificates",
+			"net.tls.allowInvalidCertificates",
+			"net.tls.allowInvalidHostnames",
+			"net.tls.certificateKeyFile",
+			"net.tls.certificateKeyFilePassword",
+			"net.tls.certificateSelector",
+			"net.tls.clusterCAFile",
+			"net.tls.clusterCertificateSelector",
+			"net.tls.clusterFile",
+			"net.tls.clusterPassword",
+			"net.tls.disabledProtocols",
+			"net.tls.mode",
+		},
+		removed: []string{
+			"net.ssl.CAFile",
+			"net.ssl.CRLFile",
+			"net.ssl.FIPSMode",
+			"net.ssl.PEMKeyFile",
+			"net.ssl.PEMKeyPassword",
+			"net.ssl.allowConnectionsWithoutCertificates",
+			"net.ssl.allowInvalidCertificates",
+			"net.ssl.allowInvalidHostnames",
+			"net.ssl.certificateSelector",
+			"net.ssl.clusterCAFile",
+			"net.ssl.clusterCertificateSelector",
+			"net.ssl.clusterFile",
+			"net.ssl.clusterPassword",
+			"net.ssl.disabledProtocols",
+			"net.ssl.mode",
+			"net.ssl.weakCertificateValidation",
+			"storage.mmapv1.*",
+		},
+	},
+	{
+		version: "4.4",
+		added: []string{
+			"net.tls.logVersions",
+			"operationProfiling.filter",
+			"storage.oplogMinRetentionHours",
+		},
+		removed: []string{
+			"storage.wiredTiger.engineConfig.maxCacheOverflowFileSizeGB",
+		},
+	},
+	{
+		version: "5.0",
+		removed: []string{
+			"net.serviceExecutor",
+		},
+	},
+}
+
+// argsSchemas are the args2_6 options supported by each MongoDB release, keyed by major.minor.
+var argsSchemas = buildArgsSchemas(argsSchemaReleases)
+
+func buildArgsSchemas(releases []argsSchemaRelease) map[string]map[string]bool {
+	schemas := map[string]map[string]bool{}
+	current := map[string]bool{}
+	for _, release := range releases {
+		next := map[string]bool{}
+		for option := range current {
+			next[option] = true
+		}
+		for _, option := range release.added {
+			next[option] = true
+		}
+		for _, option := range release.removed {
+			delete(next, option)
+		}
+		schemas[release.version] = next
+		current = next
+	}
+	return schemas
+}
+
+// schemaAllows returns true if the schema contains the option, directly or through a ".*" entry of one of its parents.
+func schemaAllows(schema map[string]bool, option string) bool {
+	if schema[option] {
+		return true
+	}
+	for i := strings.LastIndex(option, "."); i > 0; i = strings.LastIndex(option[:i], ".") {
+		if schema[option[:i]+".*"] {
+			return true
+		}
+	}
+	return false
+}
+
+// argsOptions returns the dotted names of the options set in args2_6, e.g. "net.tls.mode".
+func argsOptions(prefix string, value map[string]interface{}, options *[]string) {
+	for key, field := range value {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		switch nested := field.(type) {
+		case map[string]interface{}:
+			argsOptions(name, nested, options)
+		case objx.Map:
+			argsOptions(name, nested, options)
+		default:
+			*options = append(*options, name)
+		}
+	}
+}
+
+// ValidateAgainstVersionSchema builds the AutomationConfig and checks that every option of args2_6 is supported
+// by the MongoDB version of its process, which catches typos as well as removed or renamed options, e.g. net.ssl
+// from MongoDB 4.2. The options added by templates and modifications are checked too.
+func (b *Builder) ValidateAgainstVersionSchema() error {
+	ac, err := b.Build()
+	if err != nil {
+		return err
+	}
+	for _, p := range ac.Processes {
+		version := p.Version
+		if version == "" {
+			version = b.mongodbVersion
+		}
+		release, ok := majorMinorOf(version)
+		if !ok {
+			return errors.Errorf("invalid MongoDB version %q of process %s", version, p.Name)
+		}
+		schema, ok := argsSchemas[release]
+		if !ok {
+			return errors.Errorf("there is no args schema for MongoDB %s", release)
+		}
+
+		var options, unknown []string
+		argsOptions("", p.Args26, &options)
+		for _, option := range options {
+			if !schemaAllows(schema, option) {
+				unknown = append(unknown, option)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return errors.Errorf("process %s has options which MongoDB %s doesn't support: %s", p.Name, release, strings.Join(unknown, ", "))
+		}
+	}
+	return nil
+}
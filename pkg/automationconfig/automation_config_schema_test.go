@@ -0,0 +1,52 @@
+package automationconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAgainstVersionSchema(t *testing.T) {
+	t.Run("Configs built by the Builder are valid", func(t *testing.T) {
+		for _, version := range []string{"3.6.0", "4.0.0", "4.2.0", "4.4.0", "5.0.0"} {
+			assert.NoError(t, newTestBuilder(version).
+				SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+				SetTLSCipherConfig("HIGH").
+				SetTLSCertificateKeyFilePassword("/tls/password").
+				ValidateAgainstVersionSchema(), version)
+		}
+		assert.NoError(t, newTestBuilder("4.4.0").SetOplogMinRetentionHours(24).ValidateAgainstVersionSchema())
+	})
+
+	t.Run("Typos are rejected", func(t *testing.T) {
+		err := newTestBuilder("4.4.0").
+			AddModifications(func(ac *AutomationConfig) {
+				ac.Processes[0].Args26.Set("storage.wiredTiger.engineConfig.cacheSizeGb", 1)
+			}).
+			ValidateAgainstVersionSchema()
+		assert.EqualError(t, err, "process my-rs-0 has options which MongoDB 4.4 doesn't support: storage.wiredTiger.engineConfig.cacheSizeGb")
+	})
+
+	t.Run("Renamed options are rejected", func(t *testing.T) {
+		err := newTestBuilder("4.2.0").
+			AddModifications(func(ac *AutomationConfig) {
+				ac.Processes[0].Args26.Set("net.ssl.CRLFile", "/tls/crl.pem")
+			}).
+			ValidateAgainstVersionSchema()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "net.ssl.CRLFile")
+	})
+
+	t.Run("Options below a wildcard are allowed", func(t *testing.T) {
+		err := newTestBuilder("4.4.0").
+			AddModifications(func(ac *AutomationConfig) {
+				ac.Processes[0].Args26.Set("setParameter.anyParameter", 1)
+			}).
+			ValidateAgainstVersionSchema()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Versions without a schema are rejected", func(t *testing.T) {
+		assert.Error(t, newTestBuilder("3.4.0").ValidateAgainstVersionSchema())
+	})
+}
@@ -0,0 +1,141 @@
+package automationconfig
+
+import "github.com/pkg/errors"
+
+const (
+	scramSha256Mechanism = "SCRAM-SHA-256"
+	// scramAgentName is the user the automation agent authenticates as
+	scramAgentName               = "mms-automation"
+	scramAgentKeyFilePath        = "/var/lib/mongodb-mms-automation/authentication/keyfile"
+	scramAgentKeyFilePathWindows = "%SystemDrive%\\MMSAutomation\\versions\\keyfile"
+)
+
+// scramOptions are the users and agent credentials configured with EnableSCRAM and SetSCRAMAgentCredentials.
+type scramOptions struct {
+	users         []MongoDBUser
+	agentPassword string
+	agentKeyFile  string
+	// readOnlyUsers are the users added with AddReadOnlyUser, they are part of users as well
+	readOnlyUsers []MongoDBUser
+}
+
+// scramEnabler enables SCRAM-SHA-256 authentication, for the agent and the deployment, with the configured users.
+type scramEnabler struct {
+	options *scramOptions
+}
+
+func (e scramEnabler) EnableAuth(auth Auth) Auth {
+	auth.Disabled = false
+	auth.AuthoritativeSet = true
+	auth.KeyFile = scramAgentKeyFilePath
+	// the windows file is only specified to pass validation, it is never used
+	auth.KeyFileWindows = scramAgentKeyFilePathWindows
+	auth.AutoAuthMechanisms = []string{scramSha256Mechanism}
+	auth.AutoUser = scramAgentName
+	auth.AutoAuthMechanism = scramSha256Mechanism
+	auth.AutoPwd = e.options.agentPassword
+	auth.Key = e.options.agentKeyFile
+	auth.Users = append(auth.Users, e.options.users...)
+
+	for _, mechanism := range auth.DeploymentAuthMechanisms {
+		if mechanism == scramSha256Mechanism {
+			return auth
+		}
+	}
+	auth.DeploymentAuthMechanisms = append(auth.DeploymentAuthMechanisms, scramSha256Mechanism)
+	return auth
+}
+
+// EnableSCRAM enables SCRAM-SHA-256 authentication with the given users, without constructing an AuthEnabler.
+// The agent authenticates with the credentials configured with SetSCRAMAgentCredentials. Like AddAuthEnabler,
+// it is applied after the enablers already configured, and SetAuthEnabler replaces it.
+func (b *Builder) EnableSCRAM(users ...MongoDBUser) *Builder {
+	if b.scram == nil {
+		b.scram = &scramOptions{}
+	}
+	b.scram.users = append(b.scram.users, users...)
+	if !b.hasSCRAMEnabler() {
+		b.enablers = append(b.enablers, scramEnabler{options: b.scram})
+	}
+	return b
+}
+
+// AddReadOnlyUser adds a user with the read role on each of the given databases, or the readAnyDatabase role
+// if there are none, e.g. for a BI tool. The user is added with EnableSCRAM, and its credentials can be
+// configured with SetUserSCRAMCredentials like any other user. The username must be unique in its database.
+func (b *Builder) AddReadOnlyUser(username, db string, databases []string) *Builder {
+	user := MongoDBUser{Username: username, Database: db, Roles: []Role{}}
+	for _, database := range databases {
+		user.Roles = append(user.Roles, Role{Role: "read", Database: database})
+	}
+	if len(databases) == 0 {
+		user.Roles = append(user.Roles, Role{Role: "readAnyDatabase", Database: "admin"})
+	}
+	b.EnableSCRAM(user)
+	b.scram.readOnlyUsers = append(b.scram.readOnlyUsers, user)
+	return b
+}
+
+// SetSCRAMAgentCredentials configures the password the automation agent authenticates with when SCRAM is
+// enabled with EnableSCRAM, and the contents of the keyfile used for internal authentication.
+func (b *Builder) SetSCRAMAgentCredentials(password, keyFile string) *Builder {
+	if b.scram == nil {
+		b.scram = &scramOptions{}
+	}
+	b.scram.agentPassword = password
+	b.scram.agentKeyFile = keyFile
+	return b
+}
+
+func (b *Builder) hasSCRAMEnabler() bool {
+	for _, enabler := range flattenAuthEnablers(b.enablers) {
+		if _, ok := enabler.(scramEnabler); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSCRAM ensures SCRAM enabled with EnableSCRAM has at least one user, or credentials for the agent.
+func (b *Builder) validateSCRAM() error {
+	if !b.hasSCRAMEnabler() {
+		return nil
+	}
+	if len(b.scram.users) == 0 && b.scram.agentPassword == "" {
+		return errors.Errorf("SCRAM requires at least one user or the credentials of the agent")
+	}
+	if b.scram.agentPassword != "" && b.scram.agentKeyFile == "" {
+		return errors.Errorf("SCRAM requires the contents of the keyfile when the agent authenticates with a password")
+	}
+	for _, user := range b.scram.readOnlyUsers {
+		if user.Username == "" || user.Database == "" {
+			return errors.Errorf("the read-only user %q of database %q needs a username and a database", user.Username, user.Database)
+		}
+		for _, role := range user.Roles {
+			if role.Database == "" {
+				return errors.Errorf("the read-only user %s can't be granted access to a database without a name", user.Username)
+			}
+		}
+	}
+	return nil
+}
+
+// validateReadOnlyUsers ensures the users added with AddReadOnlyUser aren't added again, e.g. by another
+// AuthEnabler or a modification, as only one of them would be applied.
+func (b *Builder) validateReadOnlyUsers(ac AutomationConfig) error {
+	if b.scram == nil {
+		return nil
+	}
+	for _, readOnlyUser := range b.scram.readOnlyUsers {
+		count := 0
+		for _, user := range ac.Auth.Users {
+			if user.Username == readOnlyUser.Username && user.Database == readOnlyUser.Database {
+				count++
+			}
+		}
+		if count > 1 {
+			return errors.Errorf("the read-only user %s of database %s is configured %d times", readOnlyUser.Username, readOnlyUser.Database, count)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package automationconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnableSCRAM(t *testing.T) {
+	alice := MongoDBUser{Username: "alice", Database: "admin", Roles: []Role{{Role: "readWrite", Database: "app"}}}
+	bob := MongoDBUser{Username: "bob", Database: "admin"}
+
+	t.Run("Users and agent credentials are configured", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			EnableSCRAM(alice).
+			EnableSCRAM(bob).
+			SetSCRAMAgentCredentials("agent-password", "keyfile-contents").
+			Build()
+		assert.NoError(t, err)
+
+		assert.False(t, ac.Auth.Disabled)
+		assert.Equal(t, []MongoDBUser{alice, bob}, ac.Auth.Users)
+		assert.Equal(t, "mms-automation", ac.Auth.AutoUser)
+		assert.Equal(t, "SCRAM-SHA-256", ac.Auth.AutoAuthMechanism)
+		assert.Equal(t, []string{"SCRAM-SHA-256"}, ac.Auth.AutoAuthMechanisms)
+		assert.Equal(t, []string{"SCRAM-SHA-256"}, ac.Auth.DeploymentAuthMechanisms)
+		assert.Equal(t, "agent-password", ac.Auth.AutoPwd)
+		assert.Equal(t, "keyfile-contents", ac.Auth.Key)
+		assert.NotEmpty(t, ac.Auth.KeyFile)
+	})
+
+	t.Run("Composes with other enablers", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			AddAuthEnabler(usersEnabler{users: []MongoDBUser{bob}}).
+			EnableSCRAM(alice).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []MongoDBUser{bob, alice}, ac.Auth.Users)
+	})
+
+	t.Run("A custom enabler overrides it", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			EnableSCRAM(alice).
+			SetAuthEnabler(usersEnabler{users: []MongoDBUser{bob}}).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []MongoDBUser{bob}, ac.Auth.Users)
+		assert.Empty(t, ac.Auth.AutoUser)
+	})
+
+	t.Run("Requires a user or the agent credentials", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").EnableSCRAM().Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").EnableSCRAM().SetSCRAMAgentCredentials("agent-password", "keyfile-contents").Build()
+		assert.NoError(t, err)
+
+		_, err = newTestBuilder("4.4.0").EnableSCRAM().SetSCRAMAgentCredentials("agent-password", "").Build()
+		assert.Error(t, err, "the keyfile is required as well")
+	})
+}
+
+func TestAddReadOnlyUser(t *testing.T) {
+	t.Run("The user can read the given databases", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").AddReadOnlyUser("bi-tool", "admin", []string{"sales", "inventory"}).Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.Auth.Users, 1)
+		assert.Equal(t, "bi-tool", ac.Auth.Users[0].Username)
+		assert.Equal(t, []Role{{Role: "read", Database: "sales"}, {Role: "read", Database: "inventory"}}, ac.Auth.Users[0].Roles)
+		assert.False(t, ac.Auth.Disabled)
+	})
+
+	t.Run("The user can read any database without databases", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").AddReadOnlyUser("bi-tool", "admin", nil).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []Role{{Role: "readAnyDatabase", Database: "admin"}}, ac.Auth.Users[0].Roles)
+	})
+
+	t.Run("Composes with other users", func(t *testing.T) {
+		alice := MongoDBUser{Username: "alice", Database: "admin", Roles: []Role{{Role: "readWrite", Database: "app"}}}
+		ac, err := newTestBuilder("4.4.0").EnableSCRAM(alice).AddReadOnlyUser("bi-tool", "admin", []string{"app"}).Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.Auth.Users, 2)
+	})
+
+	t.Run("Database names must not be empty", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").AddReadOnlyUser("bi-tool", "admin", []string{"sales", ""}).Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").AddReadOnlyUser("bi-tool", "", nil).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("The username must be unique", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").
+			AddReadOnlyUser("bi-tool", "admin", []string{"sales"}).
+			AddReadOnlyUser("bi-tool", "admin", []string{"inventory"}).
+			Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").
+			AddReadOnlyUser("bi-tool", "admin", []string{"sales"}).
+			AddReadOnlyUser("bi-tool", "reporting", []string{"sales"}).
+			Build()
+		assert.NoError(t, err, "the same username can be used in another database")
+	})
+}
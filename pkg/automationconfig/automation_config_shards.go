@@ -0,0 +1,136 @@
+package automationconfig
+
+import "github.com/pkg/errors"
+
+// MongosFragment is the name of the fragment returned by BuildPerShard which contains the mongos processes.
+const MongosFragment = "mongos"
+
+// BuildPerShard builds the AutomationConfig and splits it into fragments which can be applied one at a time,
+// e.g. to verify a change on one shard before applying it to the others. There is one fragment per replica set,
+// i.e. per shard and for the config servers, keyed by the name of the replica set, and one with the mongos
+// processes keyed by MongosFragment. The fragments share the rest of the config, such as the authentication and
+// the versions.
+//
+// Each fragment is versioned on its own: it keeps the version of the previous AutomationConfig if the same
+// fragment of the previous config is unchanged, otherwise its version is increased.
+func (b *Builder) BuildPerShard() (map[string]AutomationConfig, error) {
+	result, err := b.BuildWithResult()
+	if err != nil {
+		return nil, err
+	}
+	fragments, err := splitPerShard(result.Config)
+	if err != nil {
+		return nil, err
+	}
+	previousFragments, err := splitPerShard(b.previousAC)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid previous AutomationConfig")
+	}
+
+	for name, fragment := range fragments {
+		if err := b.validateFragment(fragment); err != nil {
+			return nil, errors.Wrapf(err, "invalid fragment %s", name)
+		}
+		fragment.Version = b.previousAC.Version
+		changed, err := b.fragmentChanged(previousFragments[name], fragment)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			fragment.Version++
+		}
+		fragments[name] = fragment
+	}
+	return fragments, nil
+}
+
+// splitPerShard returns a copy of the AutomationConfig for each replica set, with only its processes,
+// and one with the mongos processes, if there are any.
+func splitPerShard(ac AutomationConfig) (map[string]AutomationConfig, error) {
+	fragments := map[string]AutomationConfig{}
+	assigned := map[string]bool{}
+	for _, rs := range ac.ReplicaSets {
+		if rs.Id == MongosFragment {
+			return nil, errors.Errorf("replica set %s has the name of the mongos fragment", rs.Id)
+		}
+		members := map[string]bool{}
+		for _, m := range rs.Members {
+			members[m.Host] = true
+		}
+		fragment := ac
+		fragment.ReplicaSets = []ReplicaSet{rs}
+		fragment.Processes = []Process{}
+		for _, p := range ac.Processes {
+			if members[p.Name] {
+				fragment.Processes = append(fragment.Processes, p)
+				assigned[p.Name] = true
+			}
+		}
+		fragments[rs.Id] = fragment
+	}
+
+	mongos := ac
+	mongos.ReplicaSets = []ReplicaSet{}
+	mongos.Processes = []Process{}
+	for _, p := range ac.Processes {
+		if assigned[p.Name] {
+			continue
+		}
+		if p.ProcessType != Mongos {
+			return nil, errors.Errorf("process %s is neither a member of a replica set nor a mongos", p.Name)
+		}
+		mongos.Processes = append(mongos.Processes, p)
+	}
+	if len(mongos.Processes) > 0 {
+		fragments[MongosFragment] = mongos
+	}
+	return fragments, nil
+}
+
+// validateFragment runs the checks of the AutomationConfig which only concern the processes and replica sets
+// of the fragment, so it can be applied without the other fragments.
+func (b *Builder) validateFragment(fragment AutomationConfig) error {
+	if err := validateAuthMechanisms(fragment); err != nil {
+		return err
+	}
+	if err := validateMajorityReadConcern(fragment); err != nil {
+		return err
+	}
+	if err := validateEnterpriseFeatures(fragment); err != nil {
+		return err
+	}
+	if err := validateTLSConsistency(fragment, len(b.tls.memberCertificateKeyFiles) > 0); err != nil {
+		return err
+	}
+	for _, rs := range fragment.ReplicaSets {
+		if err := validateMembers(rs); err != nil {
+			return err
+		}
+		if err := validateArbiterProcesses(rs, fragment.Processes); err != nil {
+			return err
+		}
+		if err := validateWriteConcernModes(rs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fragmentChanged returns true if the fragment is different from the previous one, ignoring the same fields
+// as the version of the whole AutomationConfig. Both fragments must have the same version.
+func (b *Builder) fragmentChanged(previous, current AutomationConfig) (bool, error) {
+	if len(previous.Processes) == 0 {
+		return true, nil
+	}
+	previousValue, err := b.comparableValue(previous)
+	if err != nil {
+		return false, err
+	}
+	currentValue, err := b.comparableValue(current)
+	if err != nil {
+		return false, err
+	}
+	var changes []FieldChange
+	diffValues("", previousValue, currentValue, &changes)
+	return len(changes) > 0, nil
+}
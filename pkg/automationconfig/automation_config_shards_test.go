@@ -0,0 +1,93 @@
+package automationconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildPerShard(t *testing.T) {
+	newReplicaSet := func(name string, role ClusterRole, modifications ...Modification) AutomationConfig {
+		ac, err := NewBuilder().
+			SetName(name).
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion("4.4.0").
+			SetMembers(3).
+			SetClusterRole(role).
+			AddModifications(modifications...).
+			Build()
+		assert.NoError(t, err)
+		// only keep the replica set built, not the ones added by the modifications
+		var processes []Process
+		for _, p := range ac.Processes {
+			if p.Args26.Get("replication.replSetName").Data() == name {
+				processes = append(processes, p)
+			}
+		}
+		ac.Processes = processes
+		ac.ReplicaSets = ac.ReplicaSets[:1]
+		return ac
+	}
+	csrs := newReplicaSet("my-csrs", ClusterRoleConfigServer)
+	otherShard := newReplicaSet("my-shard-1", ClusterRoleShardServer, func(config *AutomationConfig) {
+		config.Processes = append(config.Processes, csrs.Processes...)
+		config.ReplicaSets = append(config.ReplicaSets, csrs.ReplicaSets...)
+	})
+
+	// the Builder builds a single replica set, the rest of the sharded cluster is added by a modification
+	newBuilder := func() *Builder {
+		return NewBuilder().
+			SetName("my-shard-0").
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion("4.4.0").
+			SetMembers(3).
+			SetClusterRole(ClusterRoleShardServer).
+			AddModifications(func(config *AutomationConfig) {
+				for _, other := range []AutomationConfig{csrs, otherShard} {
+					config.Processes = append(config.Processes, other.Processes...)
+					config.ReplicaSets = append(config.ReplicaSets, other.ReplicaSets...)
+				}
+				mongos := newProcess("my-mongos-0", "my-mongos-0.my-ns.svc.cluster.local", "4.4.0", "")
+				mongos.ProcessType = Mongos
+				config.Processes = append(config.Processes, mongos)
+			})
+	}
+
+	fragments, err := newBuilder().BuildPerShard()
+	assert.NoError(t, err)
+	assert.Len(t, fragments, 4)
+	for _, name := range []string{"my-shard-0", "my-shard-1", "my-csrs"} {
+		fragment := fragments[name]
+		assert.Len(t, fragment.ReplicaSets, 1, name)
+		assert.Equal(t, name, fragment.ReplicaSets[0].Id)
+		assert.Len(t, fragment.Processes, 3, name)
+		for _, p := range fragment.Processes {
+			assert.Equal(t, name, p.Args26.Get("replication.replSetName").Data())
+		}
+		assert.Equal(t, 1, fragment.Version)
+	}
+	assert.Empty(t, fragments[MongosFragment].ReplicaSets)
+	assert.Len(t, fragments[MongosFragment].Processes, 1)
+	assert.Equal(t, fragments["my-csrs"].Auth, fragments[MongosFragment].Auth, "the fragments share the rest of the config")
+
+	t.Run("Only the fragments which changed are versioned", func(t *testing.T) {
+		previous, err := newBuilder().Build()
+		assert.NoError(t, err)
+
+		fragments, err := newBuilder().SetWireObjectCheck(false).SetPreviousAutomationConfig(previous).BuildPerShard()
+		assert.NoError(t, err)
+		assert.Equal(t, previous.Version+1, fragments["my-shard-0"].Version)
+		assert.Equal(t, previous.Version, fragments["my-shard-1"].Version)
+		assert.Equal(t, previous.Version, fragments["my-csrs"].Version)
+		assert.Equal(t, previous.Version, fragments[MongosFragment].Version)
+	})
+
+	t.Run("Processes must be members or mongos", func(t *testing.T) {
+		_, err := newBuilder().
+			AddModifications(func(config *AutomationConfig) {
+				config.Processes = append(config.Processes, newProcess("orphan", "orphan.my-ns.svc.cluster.local", "4.4.0", ""))
+			}).
+			BuildPerShard()
+		assert.Error(t, err)
+	})
+}
@@ -1,12 +1,31 @@
 package automationconfig
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/authentication/scramcredentials"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig/internal/testdefaults"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
+// newTestBuilder returns a Builder for the test replica set with the given MongoDB version, so that tests only
+// configure the options they are testing, and the number of members if it matters.
+func newTestBuilder(version string) *Builder {
+	return NewBuilder().
+		SetName(testdefaults.ReplicaSetName).
+		SetDomain(testdefaults.Domain).
+		SetMongoDBVersion(version).
+		SetMembers(testdefaults.Members)
+}
+
 func defaultMongoDbVersion(version string) MongoDbVersionConfig {
 	return MongoDbVersionConfig{
 		Builds: []BuildConfig{
@@ -25,11 +44,7 @@ func defaultMongoDbVersion(version string) MongoDbVersionConfig {
 }
 
 func TestBuildAutomationConfig(t *testing.T) {
-	ac, err := NewBuilder().
-		SetName("my-rs").
-		SetDomain("my-ns.svc.cluster.local").
-		SetMongoDBVersion("4.2.0").
-		SetMembers(3).
+	ac, err := newTestBuilder("4.2.0").
 		SetFCV("4.0").
 		Build()
 
@@ -63,11 +78,7 @@ func TestBuildAutomationConfig(t *testing.T) {
 }
 
 func TestReplicaSetHorizons(t *testing.T) {
-	ac, err := NewBuilder().
-		SetName("my-rs").
-		SetDomain("my-ns.svc.cluster.local").
-		SetMongoDBVersion("4.2.0").
-		SetMembers(3).
+	ac, err := newTestBuilder("4.2.0").
 		SetReplicaSetHorizons([]ReplicaSetHorizons{
 			{"horizon": "test-horizon-0"},
 			{"horizon": "test-horizon-1"},
@@ -85,11 +96,7 @@ func TestReplicaSetHorizons(t *testing.T) {
 }
 
 func TestMongoDbVersions(t *testing.T) {
-	ac, err := NewBuilder().
-		SetName("my-rs").
-		SetDomain("my-ns.svc.cluster.local").
-		SetMongoDBVersion("4.2.0").
-		SetMembers(3).
+	ac, err := newTestBuilder("4.2.0").
 		AddVersion(defaultMongoDbVersion("4.2.0")).
 		Build()
 
@@ -102,7 +109,7 @@ func TestMongoDbVersions(t *testing.T) {
 	version2 := defaultMongoDbVersion("4.2.3")
 	version2.Builds = append(version2.Builds,
 		BuildConfig{
-			Architecture: "amd64",
+			Architecture: "aarch64",
 			GitVersion:   "some-git-version",
 			Platform:     "linux",
 			Url:          "some-url",
@@ -112,11 +119,7 @@ func TestMongoDbVersions(t *testing.T) {
 		},
 	)
 
-	ac, err = NewBuilder().
-		SetName("my-rs").
-		SetDomain("my-ns.svc.cluster.local").
-		SetMongoDBVersion("4.2.0").
-		SetMembers(3).
+	ac, err = newTestBuilder("4.2.0").
 		AddVersion(defaultMongoDbVersion("4.2.0")).
 		AddVersion(version2).
 		Build()
@@ -129,11 +132,7 @@ func TestMongoDbVersions(t *testing.T) {
 }
 
 func TestHasOptions(t *testing.T) {
-	ac, err := NewBuilder().
-		SetName("my-rs").
-		SetDomain("my-ns.svc.cluster.local").
-		SetMongoDBVersion("4.2.0").
-		SetMembers(3).
+	ac, err := newTestBuilder("4.2.0").
 		Build()
 
 	assert.NoError(t, err)
@@ -143,11 +142,7 @@ func TestHasOptions(t *testing.T) {
 func TestModulesNotNil(t *testing.T) {
 	// We make sure the .Modules is initialized as an empty list of strings
 	// or it will dumped as null attribute in json.
-	ac, err := NewBuilder().
-		SetName("my-rs").
-		SetDomain("my-ns.svc.cluster.local").
-		SetMongoDBVersion("4.2.0").
-		SetMembers(3).
+	ac, err := newTestBuilder("4.2.0").
 		AddVersion(defaultMongoDbVersion("4.3.2")).
 		Build()
 
@@ -156,11 +151,7 @@ func TestModulesNotNil(t *testing.T) {
 }
 
 func TestProcessHasPortSetToDefault(t *testing.T) {
-	ac, err := NewBuilder().
-		SetName("my-rs").
-		SetDomain("my-ns.svc.cluster.local").
-		SetMongoDBVersion("4.2.0").
-		SetMembers(3).
+	ac, err := newTestBuilder("4.2.0").
 		AddVersion(defaultMongoDbVersion("4.3.2")).
 		Build()
 
@@ -210,3 +201,4097 @@ func TestModifications(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 4, ac.Version)
 }
+
+func TestBuildProcessesOnly(t *testing.T) {
+	builder := newTestBuilder("4.2.0").
+		SetFCV("4.0")
+
+	processes, err := builder.BuildProcessesOnly()
+	assert.NoError(t, err)
+	assert.Len(t, processes, 3)
+
+	ac, err := builder.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, ac.Processes, processes, "the processes should be identical to the ones generated by Build")
+}
+
+func TestBuildWithTLS(t *testing.T) {
+	ac, err := newTestBuilder("4.2.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		Build()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/tls/ca.crt", ac.TLS.CAFilePath, "the agent should trust the configured CA")
+
+	for _, p := range ac.Processes {
+		assert.Equal(t, TLSModeRequired, p.Args26.Get("net.tls.mode").Data())
+		assert.Equal(t, "/tls/ca.crt", p.Args26.Get("net.tls.CAFile").Data())
+		assert.Equal(t, "/tls/server.pem", p.Args26.Get("net.tls.certificateKeyFile").Data())
+		assert.Equal(t, true, p.Args26.Get("net.tls.allowConnectionsWithoutCertificates").Data())
+		assert.Equal(t, DefaultMongoDBDataDir, p.Args26.Get("storage.dbPath").Data(), "TLS should not touch the storage options")
+	}
+}
+
+func TestBuildWithTLSAndMongos(t *testing.T) {
+	addMongos := func(name string, opts ...func(*Process)) Modification {
+		return func(config *AutomationConfig) {
+			mongos := newProcess(name, name+".my-ns.svc.cluster.local", "4.2.0", "", opts...)
+			mongos.ProcessType = Mongos
+			config.Processes = append(config.Processes, mongos)
+		}
+	}
+	newBuilder := func(modifications ...Modification) *Builder {
+		return newTestBuilder("4.2.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			AddModifications(modifications...)
+	}
+
+	ac, err := newBuilder(addMongos("my-mongos-0"), addMongos("my-mongos-1")).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, "/tls/ca.crt", ac.TLS.CAFilePath, "the agent should trust the configured CA")
+	processTypes := map[ProcessType]int{}
+	for _, p := range ac.Processes {
+		processTypes[p.ProcessType]++
+		assert.Equal(t, TLSModeRequired, p.Args26.Get("net.tls.mode").Data(), p.Name)
+		assert.Equal(t, "/tls/ca.crt", p.Args26.Get("net.tls.CAFile").Data(), p.Name)
+		assert.Equal(t, "/tls/server.pem", p.Args26.Get("net.tls.certificateKeyFile").Data(), p.Name)
+		assert.Equal(t, true, p.Args26.Get("net.tls.allowConnectionsWithoutCertificates").Data(), p.Name)
+	}
+	assert.Equal(t, map[ProcessType]int{Mongod: 3, Mongos: 2}, processTypes)
+
+	t.Run("The TLS options of mongos processes are kept", func(t *testing.T) {
+		requireCertificates := func(process *Process) {
+			withTLS(tlsOptions{mode: TLSModeRequired, caFile: "/tls/ca.crt", certAndKeyFile: "/tls/server.pem"})(process)
+			process.Args26.Set("net.tls.allowConnectionsWithoutCertificates", false)
+		}
+		ac, err := newBuilder(addMongos("my-mongos-0", requireCertificates)).Build()
+		assert.NoError(t, err)
+		mongos := ac.Processes[len(ac.Processes)-1]
+		assert.Equal(t, Mongos, mongos.ProcessType)
+		assert.Equal(t, false, mongos.Args26.Get("net.tls.allowConnectionsWithoutCertificates").Data())
+	})
+}
+
+func TestBuildWithTLSDisabled(t *testing.T) {
+	ac, err := newTestBuilder("4.2.0").
+		SetTLS(TLSModeDisabled, "/tls/ca.crt", "/tls/server.pem").
+		Build()
+
+	assert.NoError(t, err)
+	assert.Empty(t, ac.TLS.CAFilePath)
+	for _, p := range ac.Processes {
+		assert.Nil(t, p.Args26.Get("net.tls").Data())
+	}
+}
+
+func TestBuildWithTLS_UsesSSLNamespaceBefore42(t *testing.T) {
+	ac, err := newTestBuilder("4.0.18").
+		SetTLS(TLSModePreferred, "/tls/ca.crt", "/tls/server.pem").
+		Build()
+
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Nil(t, p.Args26.Get("net.tls").Data())
+		assert.Equal(t, SSLModePreferred, p.Args26.Get("net.ssl.mode").Data())
+		assert.Equal(t, "/tls/ca.crt", p.Args26.Get("net.ssl.CAFile").Data())
+		assert.Equal(t, "/tls/server.pem", p.Args26.Get("net.ssl.PEMKeyFile").Data())
+		assert.Equal(t, true, p.Args26.Get("net.ssl.allowConnectionsWithoutCertificates").Data())
+	}
+}
+
+func TestTLSMode_SSLMode(t *testing.T) {
+	assert.Equal(t, SSLModeDisabled, TLSModeDisabled.SSLMode())
+	assert.Equal(t, SSLModeAllowed, TLSModeAllowed.SSLMode())
+	assert.Equal(t, SSLModePreferred, TLSModePreferred.SSLMode())
+	assert.Equal(t, SSLModeRequired, TLSModeRequired.SSLMode())
+}
+
+func TestBuildWithTLSClusterFile(t *testing.T) {
+	builder := newTestBuilder("4.2.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		SetTLSClusterFile("/tls/member.pem")
+
+	t.Run("Requires x509 cluster authentication", func(t *testing.T) {
+		_, err := builder.Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Sets the cluster file on every process", func(t *testing.T) {
+		ac, err := builder.SetClusterAuthMode(ClusterAuthModeX509).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, "/tls/member.pem", p.Args26.Get("net.tls.clusterFile").Data())
+			assert.Equal(t, "/tls/server.pem", p.Args26.Get("net.tls.certificateKeyFile").Data())
+			assert.Equal(t, ClusterAuthModeX509, p.Args26.Get("security.clusterAuthMode").Data())
+		}
+	})
+}
+
+// nonVotingMember sets the priority and votes of the member at the given index to 0, which is required for delayed members.
+func nonVotingMember(index int) ReplicaSetMutator {
+	return func(rs *ReplicaSet) {
+		rs.Members[index].Priority = 0
+		rs.Members[index].Votes = 0
+	}
+}
+
+func TestMemberSecondaryDelay(t *testing.T) {
+	t.Run("slaveDelay is used before MongoDB 5.0", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			SetMemberSecondaryDelay(2, 3600).
+			AddReplicaSetMutator(nonVotingMember(2)).
+			Build()
+
+		assert.NoError(t, err)
+		members := ac.ReplicaSets[0].Members
+		assert.Equal(t, 3600, members[2].SlaveDelay)
+		assert.Equal(t, 0, members[2].SecondaryDelaySecs)
+		assert.Equal(t, 0, members[0].SlaveDelay)
+	})
+
+	t.Run("secondaryDelaySecs is used from MongoDB 5.0", func(t *testing.T) {
+		ac, err := newTestBuilder("6.0.0").
+			SetMemberSecondaryDelay(2, 3600).
+			AddReplicaSetMutator(nonVotingMember(2)).
+			Build()
+
+		assert.NoError(t, err)
+		members := ac.ReplicaSets[0].Members
+		assert.Equal(t, 3600, members[2].SecondaryDelaySecs)
+		assert.Equal(t, 0, members[2].SlaveDelay)
+	})
+}
+
+func TestBindAllInterfaces(t *testing.T) {
+	newBuilder := func(version string) *Builder {
+		return newTestBuilder(version).
+			SetBindAllInterfaces(true)
+	}
+
+	t.Run("bindIpAll is used from MongoDB 3.6", func(t *testing.T) {
+		ac, err := newBuilder("3.6.0").Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, true, p.Args26.Get("net.bindIpAll").Data())
+			assert.Nil(t, p.Args26.Get("net.bindIp").Data())
+			assert.Nil(t, p.Args26.Get("net.ipv6").Data())
+		}
+	})
+
+	t.Run("bindIp is used before MongoDB 3.6", func(t *testing.T) {
+		ac, err := newBuilder("3.4.0").Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, "0.0.0.0,::", p.Args26.Get("net.bindIp").Data())
+			assert.Equal(t, true, p.Args26.Get("net.ipv6").Data())
+			assert.Nil(t, p.Args26.Get("net.bindIpAll").Data())
+		}
+	})
+
+	t.Run("Nothing is configured by default", func(t *testing.T) {
+		ac, err := newBuilder("4.4.0").SetBindAllInterfaces(false).Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.Processes[0].Args26.Get("net.bindIpAll").Data())
+		assert.Nil(t, ac.Processes[0].Args26.Get("net.bindIp").Data())
+	})
+}
+
+func TestAuthSchemaVersion(t *testing.T) {
+	t.Run("Version is applied to every process", func(t *testing.T) {
+		ac, err := newTestBuilder("4.2.0").SetAuthSchemaVersion(3).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, 3, p.AuthSchemaVersion)
+		}
+	})
+
+	t.Run("Previous version is kept when unset", func(t *testing.T) {
+		previous, err := newTestBuilder("4.2.0").SetAuthSchemaVersion(3).Build()
+		assert.NoError(t, err)
+
+		ac, err := newTestBuilder("4.2.0").SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, 3, p.AuthSchemaVersion)
+		}
+		assert.Equal(t, previous.Version, ac.Version)
+	})
+
+	t.Run("Version can be upgraded", func(t *testing.T) {
+		previous, err := newTestBuilder("4.2.0").SetAuthSchemaVersion(3).Build()
+		assert.NoError(t, err)
+
+		ac, err := newTestBuilder("4.2.0").SetPreviousAutomationConfig(previous).SetAuthSchemaVersion(5).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 5, ac.Processes[0].AuthSchemaVersion)
+	})
+
+	t.Run("Version can't be downgraded", func(t *testing.T) {
+		previous, err := newTestBuilder("4.2.0").Build()
+		assert.NoError(t, err)
+
+		_, err = newTestBuilder("4.2.0").SetPreviousAutomationConfig(previous).SetAuthSchemaVersion(3).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid version is rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.2.0").SetAuthSchemaVersion(4).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Processes must have the same version", func(t *testing.T) {
+		_, err := newTestBuilder("4.2.0").
+			AddModifications(func(config *AutomationConfig) {
+				config.Processes[1].AuthSchemaVersion = 3
+			}).
+			Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("SCRAM requires version 5", func(t *testing.T) {
+		_, err := newTestBuilder("4.2.0").SetAuthSchemaVersion(3).SetAuthEnabler(scramLikeEnabler{}).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestDelayedBackupMember(t *testing.T) {
+	newBuilder := func(version string) *Builder {
+		return newTestBuilder(version).
+			AddDelayedBackupMember(3600)
+	}
+
+	t.Run("Backup member is added after the regular members", func(t *testing.T) {
+		ac, err := newBuilder("6.0.0").Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.Processes, 4)
+
+		members := ac.ReplicaSets[0].Members
+		assert.Len(t, members, 4)
+		backup := members[3]
+		assert.Equal(t, "my-rs-3", backup.Host)
+		assert.Equal(t, 3, backup.Id)
+		assert.True(t, backup.Hidden)
+		assert.Equal(t, 0, backup.Priority)
+		assert.Equal(t, 0, backup.Votes)
+		assert.Equal(t, 3600, backup.SecondaryDelaySecs)
+		assert.Equal(t, 0, backup.SlaveDelay)
+		assert.Equal(t, map[string]string{"backup": "true"}, backup.Tags)
+
+		for _, m := range members[:3] {
+			assert.False(t, m.Hidden)
+			assert.Equal(t, 1, m.Votes)
+			assert.Nil(t, m.Tags)
+		}
+	})
+
+	t.Run("slaveDelay is used before MongoDB 5.0", func(t *testing.T) {
+		ac, err := newBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		backup := ac.ReplicaSets[0].Members[3]
+		assert.Equal(t, 3600, backup.SlaveDelay)
+		assert.Equal(t, 0, backup.SecondaryDelaySecs)
+	})
+
+	t.Run("Backup members are added regardless of the order of the options", func(t *testing.T) {
+		ac, err := newTestBuilder("6.0.0").
+			AddDelayedBackupMember(3600).
+			SetMembers(3).
+			Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.ReplicaSets[0].Members, 4)
+		assert.True(t, ac.ReplicaSets[0].Members[3].Hidden)
+	})
+
+	t.Run("Backup members don't need a horizon", func(t *testing.T) {
+		ac, err := newBuilder("6.0.0").
+			SetReplicaSetHorizons([]ReplicaSetHorizons{
+				{"horizon": "my-rs-0.example.com:27017"},
+				{"horizon": "my-rs-1.example.com:27017"},
+				{"horizon": "my-rs-2.example.com:27017"},
+			}).
+			Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.ReplicaSets[0].Members[3].Horizons)
+	})
+
+	t.Run("Replica set needs a member which can become primary", func(t *testing.T) {
+		_, err := NewBuilder().
+			SetName("my-rs").
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion("6.0.0").
+			AddDelayedBackupMember(3600).
+			Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Non-voting members must have priority 0", func(t *testing.T) {
+		_, err := newBuilder("6.0.0").
+			AddReplicaSetMutator(func(rs *ReplicaSet) {
+				rs.Members[3].Priority = 1
+			}).
+			Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Hidden members must have priority 0", func(t *testing.T) {
+		_, err := newBuilder("6.0.0").
+			AddReplicaSetMutator(func(rs *ReplicaSet) {
+				rs.Members[3].Votes = 1
+				rs.Members[3].Priority = 1
+			}).
+			Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestBuildAndValidate(t *testing.T) {
+	builder := newTestBuilder("4.2.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		AddVersion(defaultMongoDbVersion("4.2.0"))
+
+	ac, err := builder.BuildAndValidate()
+	assert.NoError(t, err)
+	assert.Len(t, ac.Processes, 3)
+
+	t.Run("Unstable configs are rejected", func(t *testing.T) {
+		_, err := builder.AddModifications(func(config *AutomationConfig) {
+			// integers above 2^53 lose precision when they are unmarshalled into a float64
+			config.Processes[0].Args26.Set("setParameter.someLargeValue", int64(9007199254740993))
+		}).BuildAndValidate()
+		assert.Error(t, err)
+	})
+}
+
+func TestInitialSyncSourceReadPreference(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").SetInitialSyncSourceReadPreference("secondaryPreferred").Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, "secondaryPreferred", p.Args26.Get("setParameter.initialSyncSourceReadPreference").Data())
+	}
+
+	_, err = newTestBuilder("4.4.0").SetInitialSyncSourceReadPreference("anywhere").Build()
+	assert.Error(t, err, "invalid read preferences should be rejected")
+
+	_, err = newTestBuilder("4.2.0").SetInitialSyncSourceReadPreference("secondary").Build()
+	assert.Error(t, err, "the parameter is not supported before MongoDB 4.4")
+
+	ac, err = newTestBuilder("4.4.0").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.Processes[0].Args26.Get("setParameter").Data(), "no parameter should be set by default")
+}
+
+func TestProcessMutators(t *testing.T) {
+	previousAc, err := newTestBuilder("4.2.0").
+		Build()
+	assert.NoError(t, err)
+
+	ac, err := newTestBuilder("4.2.0").
+		SetPreviousAutomationConfig(previousAc).
+		AddProcessMutator(func(idx int, p *Process) {
+			p.Args26.Set("net.port", 27017+idx)
+		}).
+		AddProcessMutator(func(idx int, p *Process) {
+			if idx == 0 {
+				p.Args26.Set("net.port", 30000)
+			}
+		}).
+		Build()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 30000, ac.Processes[0].Args26.Get("net.port").Data(), "mutators should be applied in order")
+	assert.Equal(t, 27018, ac.Processes[1].Args26.Get("net.port").Data())
+	assert.Equal(t, 27019, ac.Processes[2].Args26.Get("net.port").Data())
+	assert.Equal(t, previousAc.Version+1, ac.Version, "changes made by mutators should increase the version")
+}
+
+func TestReplicaSetMutators(t *testing.T) {
+	previousAc, err := newTestBuilder("4.2.0").
+		Build()
+	assert.NoError(t, err)
+
+	ac, err := newTestBuilder("4.2.0").
+		SetPreviousAutomationConfig(previousAc).
+		AddModifications(func(config *AutomationConfig) {
+			config.ReplicaSets[0].Members[2].Priority = 2
+		}).
+		AddReplicaSetMutator(func(rs *ReplicaSet) {
+			rs.Members[2].Priority = 0
+			rs.Members[2].Votes = 0
+		}).
+		Build()
+
+	assert.NoError(t, err)
+	member := ac.ReplicaSets[0].Members[2]
+	assert.Equal(t, 0, member.Priority, "mutators should be applied after modifications")
+	assert.Equal(t, 0, member.Votes)
+	assert.Equal(t, previousAc.Version+1, ac.Version, "changes made by mutators should increase the version")
+}
+
+func TestServiceExecutor(t *testing.T) {
+	ac, err := newTestBuilder("4.2.0").SetServiceExecutor("adaptive").Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, "adaptive", p.Args26.Get("net.serviceExecutor").Data())
+	}
+
+	ac, err = newTestBuilder("4.2.0").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.Processes[0].Args26.Get("net.serviceExecutor").Data(), "the option should not be set by default")
+
+	_, err = newTestBuilder("4.2.0").SetServiceExecutor("threaded").Build()
+	assert.Error(t, err)
+
+	_, err = newTestBuilder("3.4.0").SetServiceExecutor("adaptive").Build()
+	assert.Error(t, err, "the adaptive executor was introduced in 3.6")
+
+	_, err = newTestBuilder("5.0.0").SetServiceExecutor("synchronous").Build()
+	assert.Error(t, err, "the option was removed in 5.0")
+}
+
+func TestHostnames(t *testing.T) {
+	builder := newTestBuilder("4.2.0")
+
+	hostnames, err := builder.Hostnames()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"my-rs-0.my-ns.svc.cluster.local",
+		"my-rs-1.my-ns.svc.cluster.local",
+		"my-rs-2.my-ns.svc.cluster.local",
+	}, hostnames)
+
+	ac, err := builder.Build()
+	assert.NoError(t, err)
+	for i, p := range ac.Processes {
+		assert.Equal(t, hostnames[i], p.HostName)
+	}
+
+	_, err = builder.SetServiceExecutor("threaded").Hostnames()
+	assert.Error(t, err, "an invalid builder should not produce hostnames")
+}
+
+func TestDefaultRWConcern(t *testing.T) {
+	journaled := true
+	concern := DefaultRWConcern{
+		DefaultReadConcern:  &ReadConcern{Level: "majority"},
+		DefaultWriteConcern: &WriteConcern{W: "majority", J: &journaled, WTimeout: 5000},
+	}
+
+	ac, err := newTestBuilder("4.4.0").SetDefaultRWConcern(concern).Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, &concern, p.DefaultRWConcern)
+	}
+
+	t.Run("It is omitted when unset", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		bytes, err := json.Marshal(ac)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(bytes), "defaultRWConcern")
+	})
+
+	t.Run("It requires MongoDB 4.4", func(t *testing.T) {
+		_, err := newTestBuilder("4.2.0").SetDefaultRWConcern(concern).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid concerns are rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetDefaultRWConcern(DefaultRWConcern{}).Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").SetDefaultRWConcern(DefaultRWConcern{DefaultReadConcern: &ReadConcern{Level: "snapshot"}}).Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").SetDefaultRWConcern(DefaultRWConcern{DefaultWriteConcern: &WriteConcern{W: -1}}).Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").SetDefaultRWConcern(DefaultRWConcern{DefaultWriteConcern: &WriteConcern{W: 1, WTimeout: -1}}).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestFreeMonitoring(t *testing.T) {
+	ac, err := newTestBuilder("4.2.0").SetFreeMonitoring("off").Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, "off", p.Args26.Get("cloud.monitoring.free.state").Data())
+	}
+
+	ac, err = newTestBuilder("4.2.0").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.Processes[0].Args26.Get("cloud").Data(), "free monitoring should not be configured by default")
+
+	_, err = newTestBuilder("4.2.0").SetFreeMonitoring("enabled").Build()
+	assert.Error(t, err)
+
+	_, err = newTestBuilder("3.6.0").SetFreeMonitoring("on").Build()
+	assert.Error(t, err)
+}
+
+func TestWriteConcernMajorityJournalDefault(t *testing.T) {
+	newBuilder := func(log *zap.SugaredLogger) *Builder {
+		return newTestBuilder("4.2.0").
+			SetLogger(log)
+	}
+
+	t.Run("It is omitted by default", func(t *testing.T) {
+		ac, err := newBuilder(zap.S()).Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.ReplicaSets[0].WriteConcernMajorityJournalDefault)
+	})
+
+	t.Run("Disabling it with journaled members logs a warning", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder(zap.New(core).Sugar()).
+			SetWriteConcernMajorityJournalDefault(false).
+			Build()
+		assert.NoError(t, err)
+		assert.False(t, *ac.ReplicaSets[0].WriteConcernMajorityJournalDefault)
+		assert.Equal(t, 1, logs.FilterMessageSnippet("writeConcernMajorityJournalDefault").Len())
+	})
+
+	t.Run("Disabling it with in-memory members doesn't log a warning", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder(zap.New(core).Sugar()).
+			SetWriteConcernMajorityJournalDefault(false).
+			AddProcessMutator(func(idx int, p *Process) {
+				p.Args26.Set("storage.engine", "inMemory")
+			}).
+			Build()
+		assert.NoError(t, err)
+		assert.False(t, *ac.ReplicaSets[0].WriteConcernMajorityJournalDefault)
+		assert.Equal(t, 0, logs.Len())
+	})
+}
+
+func TestProcessOrderIsDeterministic(t *testing.T) {
+	// MongoDB allows at most 7 voting members
+	zero := 0
+	specs := make([]MemberSpec, 12)
+	for i := 7; i < len(specs); i++ {
+		specs[i] = MemberSpec{Votes: &zero, Priority: &zero}
+	}
+
+	ac, err := NewBuilder().
+		SetName("my-rs").
+		SetDomain("my-ns.svc.cluster.local").
+		SetMongoDBVersion("4.2.0").
+		SetMembersSpec(specs).
+		SetFCV("4.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		Build()
+	assert.NoError(t, err)
+
+	otherAc, err := NewBuilder().
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		SetFCV("4.0").
+		SetMembersSpec(specs).
+		SetMongoDBVersion("4.2.0").
+		SetDomain("my-ns.svc.cluster.local").
+		SetName("my-rs").
+		Build()
+	assert.NoError(t, err)
+	assert.Equal(t, ac.Processes, otherAc.Processes)
+
+	for i, p := range ac.Processes {
+		assert.Equal(t, toHostName("my-rs", i), p.Name, "my-rs-10 should be ordered after my-rs-9")
+	}
+}
+
+func TestProcessesAreOrderedByType(t *testing.T) {
+	ac, err := newTestBuilder("4.2.0").
+		SetReplicaSetHorizons([]ReplicaSetHorizons{
+			{"horizon": "test-horizon-0"},
+			{"horizon": "test-horizon-1"},
+			{"horizon": "test-horizon-2"},
+		}).
+		AddProcessMutator(func(idx int, p *Process) {
+			if idx == 0 {
+				p.ProcessType = "mongos"
+			}
+		}).
+		Build()
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"my-rs-1", "my-rs-2", "my-rs-0"}, []string{ac.Processes[0].Name, ac.Processes[1].Name, ac.Processes[2].Name})
+	for i, member := range ac.ReplicaSets[0].Members {
+		assert.Equal(t, toHostName("my-rs", i), member.Host, "members should not be affected by the process order")
+		assert.Equal(t, fmt.Sprintf("test-horizon-%d", i), member.Horizons["horizon"])
+	}
+}
+
+func TestProcessesAddedByModificationsAreOrdered(t *testing.T) {
+	prependMongos := func(name string) Modification {
+		return func(config *AutomationConfig) {
+			mongos := newProcess(name, name+".my-ns.svc.cluster.local", "4.4.0", "")
+			mongos.ProcessType = Mongos
+			config.Processes = append([]Process{mongos}, config.Processes...)
+		}
+	}
+	newBuilder := func(modifications ...Modification) *Builder {
+		return newTestBuilder("4.4.0").
+			AddModifications(modifications...)
+	}
+
+	ac, err := newBuilder(prependMongos("my-mongos-0"), prependMongos("my-mongos-1")).Build()
+	assert.NoError(t, err)
+	var names []string
+	for _, p := range ac.Processes {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"my-rs-0", "my-rs-1", "my-rs-2", "my-mongos-0", "my-mongos-1"}, names, "the mongod processes should come first")
+
+	otherAc, err := newBuilder(prependMongos("my-mongos-1"), prependMongos("my-mongos-0")).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, ac.Processes, otherAc.Processes, "the order should not depend on the order of the modifications")
+}
+
+func TestNaturalLess(t *testing.T) {
+	assert.True(t, naturalLess("my-rs-2", "my-rs-10"))
+	assert.False(t, naturalLess("my-rs-10", "my-rs-2"))
+	assert.True(t, naturalLess("a-rs-10", "b-rs-2"))
+	assert.True(t, naturalLess("my-rs", "my-rs-0"))
+	assert.False(t, naturalLess("my-rs-1", "my-rs-1"))
+}
+
+func TestAgentSettings(t *testing.T) {
+	ac, err := newTestBuilder("4.2.0").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.AgentSettings, "agent settings should be omitted by default")
+
+	settings := AgentSettings{LogLevel: "DEBUG", MaxRetries: 10, HealthCheckIntervalSeconds: 30}
+	ac, err = newTestBuilder("4.2.0").SetAgentSettings(settings).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, &settings, ac.AgentSettings)
+
+	_, err = newTestBuilder("4.2.0").SetAgentSettings(AgentSettings{LogLevel: "VERBOSE"}).Build()
+	assert.Error(t, err)
+
+	_, err = newTestBuilder("4.2.0").SetAgentSettings(AgentSettings{MaxRetries: -1}).Build()
+	assert.Error(t, err)
+
+	_, err = newTestBuilder("4.2.0").SetAgentSettings(AgentSettings{HealthCheckIntervalSeconds: 3601}).Build()
+	assert.Error(t, err)
+}
+
+func TestConfigServerReplicaSet(t *testing.T) {
+	newBuilder := func(members int) *Builder {
+		return NewBuilder().
+			SetName("my-csrs").
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion("4.2.0").
+			SetMembers(members).
+			SetConfigServerReplicaSet(true)
+	}
+
+	ac, err := newBuilder(3).Build()
+	assert.NoError(t, err)
+	assert.True(t, ac.ReplicaSets[0].ConfigServer)
+	for _, p := range ac.Processes {
+		assert.Equal(t, ClusterRoleConfigServer, p.Args26.Get("sharding.clusterRole").Data())
+		assert.Equal(t, "my-csrs", p.Args26.Get("replication.replSetName").Data())
+	}
+
+	_, err = newBuilder(0).Build()
+	assert.Error(t, err, "a config server replica set needs members")
+
+	_, err = newBuilder(3).AddReplicaSetMutator(func(rs *ReplicaSet) {
+		rs.Members[2].ArbiterOnly = true
+	}).Build()
+	assert.Error(t, err, "a config server replica set can't have arbiters")
+
+	ac, err = NewBuilder().SetName("my-rs").SetMembers(3).Build()
+	assert.NoError(t, err)
+	assert.False(t, ac.ReplicaSets[0].ConfigServer)
+	assert.Nil(t, ac.Processes[0].Args26.Get("sharding").Data())
+}
+
+func TestTLSAllowInvalid(t *testing.T) {
+	newBuilder := func(log *zap.SugaredLogger) *Builder {
+		return newTestBuilder("4.2.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			SetLogger(log)
+	}
+
+	t.Run("Invalid certificates and hostnames are allowed with a warning", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder(zap.New(core).Sugar()).SetTLSAllowInvalid(true, true).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, true, p.Args26.Get("net.tls.allowInvalidCertificates").Data())
+			assert.Equal(t, true, p.Args26.Get("net.tls.allowInvalidHostnames").Data())
+		}
+		assert.Equal(t, 1, logs.FilterMessageSnippet("invalid certificates").Len())
+		assert.Equal(t, 1, logs.FilterMessageSnippet("invalid hostnames").Len())
+	})
+
+	t.Run("Only the configured option is set", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder(zap.New(core).Sugar()).SetTLSAllowInvalid(false, true).Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.Processes[0].Args26.Get("net.tls.allowInvalidCertificates").Data())
+		assert.Equal(t, true, ac.Processes[0].Args26.Get("net.tls.allowInvalidHostnames").Data())
+		assert.Equal(t, 1, logs.Len())
+	})
+
+	t.Run("No warning is logged by default", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		_, err := newBuilder(zap.New(core).Sugar()).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("They are rejected with strict TLS", func(t *testing.T) {
+		_, err := newBuilder(zap.S()).SetTLSAllowInvalid(true, false).SetStrictTLS(true).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestTLSWeakCertificateValidation(t *testing.T) {
+	newBuilder := func(version string, log *zap.SugaredLogger) *Builder {
+		return newTestBuilder(version).
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			SetLogger(log)
+	}
+
+	t.Run("Weak certificate validation is configured with a warning", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder("4.2.0", zap.New(core).Sugar()).SetTLSWeakCertificateValidation(true).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, true, p.Args26.Get("net.tls.allowConnectionsWithoutCertificates").Data())
+			assert.Nil(t, p.Args26.Get("net.tls.weakCertificateValidation").Data(), "net.tls has no weakCertificateValidation")
+		}
+		assert.Equal(t, 1, logs.FilterMessageSnippet("weak certificate validation").Len())
+	})
+
+	t.Run("It is written with its net.ssl name before MongoDB 4.2", func(t *testing.T) {
+		ac, err := newBuilder("4.0.0", zap.S()).SetTLSWeakCertificateValidation(true).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, true, ac.Processes[0].Args26.Get("net.ssl.weakCertificateValidation").Data())
+		assert.Nil(t, ac.Processes[0].Args26.Get("net.ssl.allowConnectionsWithoutCertificates").Data(), "only one of the aliases is written")
+		assert.Nil(t, ac.Processes[0].Args26.Get("net.tls").Data())
+
+		assert.NoError(t, newBuilder("4.0.0", zap.S()).SetTLSWeakCertificateValidation(true).ValidateAgainstVersionSchema())
+		assert.NoError(t, newBuilder("4.2.0", zap.S()).SetTLSWeakCertificateValidation(true).ValidateAgainstVersionSchema())
+	})
+
+	t.Run("It can't be combined with disallowing connections without certificates", func(t *testing.T) {
+		_, err := newBuilder("4.2.0", zap.S()).
+			SetTLSWeakCertificateValidation(true).
+			SetTLSAllowConnectionsWithoutCertificates(Mongod, false).
+			Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("It is not set by default", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder("4.2.0", zap.New(core).Sugar()).Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.Processes[0].Args26.Get("net.tls.weakCertificateValidation").Data())
+		assert.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("It is rejected with strict TLS", func(t *testing.T) {
+		_, err := newBuilder("4.2.0", zap.S()).SetTLSWeakCertificateValidation(true).SetStrictTLS(true).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestMemberIds(t *testing.T) {
+	newBuilder := func(members int) *Builder {
+		return newTestBuilder("4.2.0").
+			SetMembers(members)
+	}
+	memberIds := func(ac AutomationConfig) []int {
+		var ids []int
+		for _, m := range ac.ReplicaSets[0].Members {
+			ids = append(ids, m.Id)
+		}
+		return ids
+	}
+
+	t.Run("Ids can be configured explicitly", func(t *testing.T) {
+		ac, err := newBuilder(3).SetMemberId(0, 10).SetMemberId(2, 20).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []int{10, 1, 20}, memberIds(ac))
+	})
+
+	t.Run("Ids must be unique", func(t *testing.T) {
+		_, err := newBuilder(3).SetMemberId(0, 1).Build()
+		assert.NoError(t, err, "the member at index 1 should get a different id")
+
+		_, err = newBuilder(3).SetMemberId(0, 5).SetMemberId(1, 5).Build()
+		assert.Error(t, err)
+
+		_, err = newBuilder(3).SetMemberId(0, 256).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Ids are carried forward from the previous config", func(t *testing.T) {
+		previousAc, err := newBuilder(3).SetMemberId(0, 7).SetMemberId(1, 0).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []int{7, 0, 2}, memberIds(previousAc))
+
+		ac, err := newBuilder(4).SetPreviousAutomationConfig(previousAc).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []int{7, 0, 2, 3}, memberIds(ac))
+	})
+
+	t.Run("The id of an existing member can't be changed", func(t *testing.T) {
+		previousAc, err := newBuilder(3).Build()
+		assert.NoError(t, err)
+
+		_, err = newBuilder(3).SetPreviousAutomationConfig(previousAc).SetMemberId(1, 5).Build()
+		assert.Error(t, err)
+
+		_, err = newBuilder(3).SetPreviousAutomationConfig(previousAc).SetMemberId(1, 1).Build()
+		assert.NoError(t, err)
+	})
+}
+
+func TestBuildWithResult(t *testing.T) {
+	result, err := newTestBuilder("4.2.0").BuildWithResult()
+	assert.NoError(t, err)
+	assert.True(t, result.Changed)
+	assert.Equal(t, 0, result.PreviousVersion)
+	assert.Equal(t, 1, result.NewVersion)
+	assert.Equal(t, 1, result.Config.Version)
+
+	unchanged, err := newTestBuilder("4.2.0").SetPreviousAutomationConfig(result.Config).BuildWithResult()
+	assert.NoError(t, err)
+	assert.False(t, unchanged.Changed)
+	assert.Equal(t, 1, unchanged.PreviousVersion)
+	assert.Equal(t, 1, unchanged.NewVersion)
+	assert.Empty(t, unchanged.Changes)
+
+	changed, err := newTestBuilder("4.2.0").SetMembers(5).SetPreviousAutomationConfig(result.Config).BuildWithResult()
+	assert.NoError(t, err)
+	assert.True(t, changed.Changed)
+	assert.Equal(t, 1, changed.PreviousVersion)
+	assert.Equal(t, 2, changed.NewVersion)
+	assert.NotEmpty(t, changed.Changes)
+}
+
+func TestTLSLogVersions(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		SetTLSLogVersions("TLS1_2,TLS1_3").
+		Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, "TLS1_2,TLS1_3", p.Args26.Get("net.tls.logVersions").Data())
+	}
+
+	ac, err = newTestBuilder("4.4.0").SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.Processes[0].Args26.Get("net.tls.logVersions").Data())
+
+	_, err = newTestBuilder("4.4.0").SetTLSLogVersions("TLS1_2").Build()
+	assert.Error(t, err, "TLS needs to be enabled")
+
+	_, err = newTestBuilder("4.4.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		SetTLSLogVersions("TLS1_2,SSL3").
+		Build()
+	assert.Error(t, err, "unknown protocol versions should be rejected")
+
+	_, err = newTestBuilder("4.2.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		SetTLSLogVersions("TLS1_2").
+		Build()
+	assert.Error(t, err)
+}
+
+func TestTLSFileValidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.crt")
+	certFile := filepath.Join(dir, "server.pem")
+	assert.NoError(t, ioutil.WriteFile(caFile, []byte("ca"), 0600))
+	assert.NoError(t, ioutil.WriteFile(certFile, []byte("cert"), 0600))
+
+	newBuilder := func(caFile, certFile string) *Builder {
+		return newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, caFile, certFile).
+			SetTLSFileValidation(true)
+	}
+
+	t.Run("Existing files are accepted", func(t *testing.T) {
+		_, err := newBuilder(caFile, certFile).Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Missing CA file is rejected", func(t *testing.T) {
+		_, err := newBuilder(filepath.Join(dir, "missing.crt"), certFile).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Missing certificate file is rejected", func(t *testing.T) {
+		_, err := newBuilder(caFile, filepath.Join(dir, "missing.pem")).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Files aren't checked by default", func(t *testing.T) {
+		_, err := newBuilder("/missing/ca.crt", "/missing/server.pem").SetTLSFileValidation(false).Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Files aren't checked when TLS is disabled", func(t *testing.T) {
+		_, err := newBuilder("", "").SetTLS(TLSModeDisabled, "", "").Build()
+		assert.NoError(t, err)
+	})
+}
+
+func TestAgentStartupArgs(t *testing.T) {
+	t.Run("Args are configured for every process", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			SetAgentStartupArgs(map[string]interface{}{
+				"httpProxy":   "http://proxy:3128",
+				"maxLogFiles": 10,
+			}).
+			Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, "http://proxy:3128", p.AgentStartupArgs["httpProxy"])
+			assert.Equal(t, 10, p.AgentStartupArgs["maxLogFiles"])
+		}
+	})
+
+	t.Run("Each process has its own args", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			SetAgentStartupArgs(map[string]interface{}{"logLevel": "INFO"}).
+			AddProcessMutator(func(idx int, p *Process) {
+				if idx == 0 {
+					p.AgentStartupArgs["logLevel"] = "DEBUG"
+				}
+			}).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "DEBUG", ac.Processes[0].AgentStartupArgs["logLevel"])
+		assert.Equal(t, "INFO", ac.Processes[1].AgentStartupArgs["logLevel"])
+	})
+
+	t.Run("Unknown args are rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").
+			SetAgentStartupArgs(map[string]interface{}{"notAFlag": true}).
+			Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Args are omitted by default", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+
+		bytes, err := json.Marshal(ac.Processes[0])
+		assert.NoError(t, err)
+		assert.NotContains(t, string(bytes), "agentStartupArgs")
+	})
+}
+
+func TestReplicaSetSettings(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+
+	t.Run("Settings are omitted by default", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.ReplicaSets[0].Settings)
+	})
+
+	t.Run("WAN preset", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").ApplyWANPreset().Build()
+		assert.NoError(t, err)
+
+		settings := ac.ReplicaSets[0].Settings
+		assert.Equal(t, true, *settings.ChainingAllowed)
+		assert.Equal(t, 20000, *settings.ElectionTimeoutMillis)
+		assert.Equal(t, 20, *settings.HeartbeatTimeoutSecs)
+		assert.Equal(t, 60000, *settings.CatchUpTimeoutMillis)
+	})
+
+	t.Run("WAN preset can be overridden", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			ApplyWANPreset().
+			SetReplicaSetSettings(ReplicaSetSettings{ElectionTimeoutMillis: intPtr(30000)}).
+			Build()
+		assert.NoError(t, err)
+
+		settings := ac.ReplicaSets[0].Settings
+		assert.Equal(t, 30000, *settings.ElectionTimeoutMillis)
+		assert.Equal(t, 20, *settings.HeartbeatTimeoutSecs, "settings which aren't overridden should be kept")
+	})
+
+	t.Run("Election presets", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").ApplyLowLatencyElection().Build()
+		assert.NoError(t, err)
+
+		settings := ac.ReplicaSets[0].Settings
+		assert.Equal(t, 5000, *settings.ElectionTimeoutMillis)
+		assert.Equal(t, 1000, *settings.HeartbeatIntervalMillis)
+		assert.Equal(t, 2000, *settings.CatchUpTimeoutMillis)
+		assert.Equal(t, 10000, *settings.CatchUpTakeoverDelayMillis)
+
+		ac, err = newTestBuilder("4.4.0").ApplyHighStabilityElection().Build()
+		assert.NoError(t, err)
+
+		settings = ac.ReplicaSets[0].Settings
+		assert.Equal(t, 30000, *settings.ElectionTimeoutMillis)
+		assert.Equal(t, 20, *settings.HeartbeatTimeoutSecs)
+		assert.Equal(t, -1, *settings.CatchUpTimeoutMillis)
+		assert.Equal(t, 60000, *settings.CatchUpTakeoverDelayMillis)
+	})
+
+	t.Run("Later setters override election presets", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			ApplyHighStabilityElection().
+			ApplyLowLatencyElection().
+			SetReplicaSetSettings(ReplicaSetSettings{CatchUpTakeoverDelayMillis: intPtr(-1)}).
+			Build()
+		assert.NoError(t, err)
+
+		settings := ac.ReplicaSets[0].Settings
+		assert.Equal(t, 5000, *settings.ElectionTimeoutMillis)
+		assert.Equal(t, -1, *settings.CatchUpTakeoverDelayMillis)
+		assert.Equal(t, 20, *settings.HeartbeatTimeoutSecs, "settings the later preset doesn't set should be kept")
+	})
+
+	t.Run("Invalid settings are rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetReplicaSetSettings(ReplicaSetSettings{ElectionTimeoutMillis: intPtr(0)}).Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").SetReplicaSetSettings(ReplicaSetSettings{HeartbeatTimeoutSecs: intPtr(-1)}).Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").SetReplicaSetSettings(ReplicaSetSettings{CatchUpTimeoutMillis: intPtr(-2)}).Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").SetReplicaSetSettings(ReplicaSetSettings{CatchUpTakeoverDelayMillis: intPtr(-2)}).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestForceReconfig(t *testing.T) {
+	newBuilder := func(log *zap.SugaredLogger) *Builder {
+		return newTestBuilder("4.4.0").
+			SetLogger(log)
+	}
+
+	t.Run("Forced reconfig is configured with a warning", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder(zap.New(core).Sugar()).SetForceReconfig(true).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, &ReplicaSetForceConfig{CurrentVersion: -1}, ac.ReplicaSets[0].Force)
+		assert.Equal(t, 1, logs.FilterMessageSnippet("forced reconfig").Len())
+	})
+
+	t.Run("Forced reconfig is not carried forward", func(t *testing.T) {
+		previous, err := newBuilder(zap.S()).SetForceReconfig(true).Build()
+		assert.NoError(t, err)
+
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder(zap.New(core).Sugar()).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.ReplicaSets[0].Force)
+		assert.Equal(t, previous.Version+1, ac.Version)
+		assert.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("Force is omitted by default", func(t *testing.T) {
+		ac, err := newBuilder(zap.S()).Build()
+		assert.NoError(t, err)
+
+		bytes, err := json.Marshal(ac.ReplicaSets[0])
+		assert.NoError(t, err)
+		assert.NotContains(t, string(bytes), "force")
+	})
+}
+
+func TestProcessManagement(t *testing.T) {
+	t.Run("processManagement is omitted by default", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.Processes[0].Args26.Get("processManagement").Data())
+	})
+
+	t.Run("PID file is configured", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").SetProcessManagement(ProcessManagementConfig{PIDFilePath: "/data/mongod.pid"}).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, "/data/mongod.pid", p.Args26.Get("processManagement.pidFilePath").Data())
+			assert.Nil(t, p.Args26.Get("processManagement.fork").Data())
+		}
+	})
+
+	t.Run("Processes can't fork in Kubernetes", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetProcessManagement(ProcessManagementConfig{Fork: true}).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Processes can fork outside of Kubernetes", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			SetKubernetesMode(false).
+			SetProcessManagement(ProcessManagementConfig{Fork: true}).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, true, ac.Processes[0].Args26.Get("processManagement.fork").Data())
+	})
+}
+
+type usersEnabler struct {
+	users []MongoDBUser
+}
+
+func (e usersEnabler) EnableAuth(auth Auth) Auth {
+	auth.Disabled = false
+	auth.Users = e.users
+	return auth
+}
+
+func TestUserSCRAMCredentials(t *testing.T) {
+	sha1 := scramcredentials.ScramCreds{IterationCount: 10000, Salt: "sha1-salt", ServerKey: "sha1-server", StoredKey: "sha1-stored"}
+	sha256 := scramcredentials.ScramCreds{IterationCount: 15000, Salt: "sha256-salt", ServerKey: "sha256-server", StoredKey: "sha256-stored"}
+	generated := scramcredentials.ScramCreds{IterationCount: 15000, Salt: "random-salt"}
+
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			SetAuthEnabler(usersEnabler{users: []MongoDBUser{
+				{Username: "my-user", Database: "admin", Roles: []Role{{Role: "root", Database: "admin"}}, ScramSha1Creds: &generated, ScramSha256Creds: &generated},
+			}}).
+			SetUserSCRAMCredentials("my-user", "admin", sha1, sha256)
+	}
+
+	t.Run("Credentials of an existing user are replaced", func(t *testing.T) {
+		ac, err := newBuilder().Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.Auth.Users, 1)
+		user := ac.Auth.Users[0]
+		assert.Equal(t, sha1, *user.ScramSha1Creds)
+		assert.Equal(t, sha256, *user.ScramSha256Creds)
+		assert.Equal(t, []Role{{Role: "root", Database: "admin"}}, user.Roles, "the rest of the user should be kept")
+	})
+
+	t.Run("Missing users are added", func(t *testing.T) {
+		ac, err := newBuilder().SetUserSCRAMCredentials("other-user", "my-db", sha1, sha256).Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.Auth.Users, 2)
+		user := ac.Auth.Users[1]
+		assert.Equal(t, "other-user", user.Username)
+		assert.Equal(t, "my-db", user.Database)
+		assert.Equal(t, sha256, *user.ScramSha256Creds)
+		assert.Empty(t, user.Roles)
+	})
+
+	t.Run("Credentials are kept when users are replaced by a modification", func(t *testing.T) {
+		ac, err := newBuilder().
+			AddModifications(func(config *AutomationConfig) {
+				config.Auth.Users = []MongoDBUser{{Username: "my-user", Database: "admin", ScramSha256Creds: &generated}}
+			}).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, sha256, *ac.Auth.Users[0].ScramSha256Creds)
+	})
+
+	t.Run("Config is reproducible", func(t *testing.T) {
+		first, err := newBuilder().Build()
+		assert.NoError(t, err)
+
+		second, err := newBuilder().SetPreviousAutomationConfig(first).BuildWithResult()
+		assert.NoError(t, err)
+		assert.False(t, second.Changed)
+	})
+}
+
+func TestTLSCertificateSelector(t *testing.T) {
+	t.Run("Selector is used instead of a certificate file", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "").
+			SetTLSCertificateSelector("subject=mongod").
+			Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, "subject=mongod", p.Args26.Get("net.tls.certificateSelector").Data())
+			assert.Nil(t, p.Args26.Get("net.tls.certificateKeyFile").Data())
+		}
+	})
+
+	t.Run("net.ssl is used before MongoDB 4.2", func(t *testing.T) {
+		ac, err := newTestBuilder("4.0.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "").
+			SetTLSCertificateSelector("subject=mongod").
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "subject=mongod", ac.Processes[0].Args26.Get("net.ssl.certificateSelector").Data())
+		assert.Nil(t, ac.Processes[0].Args26.Get("net.ssl.PEMKeyFile").Data())
+	})
+
+	t.Run("Both a selector and a certificate file are rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			SetTLSCertificateSelector("subject=mongod").
+			Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Either a selector or a certificate file is required", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetTLS(TLSModeRequired, "/tls/ca.crt", "").Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestArbiterWithStorageOptions(t *testing.T) {
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			AddReplicaSetMutator(func(rs *ReplicaSet) {
+				rs.Members[2].ArbiterOnly = true
+				rs.Members[2].Priority = 0
+			})
+	}
+
+	t.Run("Arbiter without storage options is accepted", func(t *testing.T) {
+		_, err := newBuilder().Build()
+		assert.NoError(t, err)
+	})
+
+	for _, option := range []string{"storage.engine", "storage.wiredTiger.engineConfig.journalCompressor", "replication.oplogSizeMB"} {
+		t.Run(fmt.Sprintf("Arbiter with %s is rejected", option), func(t *testing.T) {
+			_, err := newBuilder().
+				AddProcessMutator(func(idx int, p *Process) {
+					if idx == 2 {
+						p.Args26.Set(option, "value")
+					}
+				}).
+				Build()
+			assert.Error(t, err)
+			assert.Equal(t, ErrArbiterWithStorageOptions, errors.Cause(err))
+		})
+	}
+
+	t.Run("Arbiter with a cache size is rejected", func(t *testing.T) {
+		_, err := newBuilder().
+			AddProcessMutator(func(idx int, p *Process) {
+				if idx == 2 {
+					p.WiredTiger.EngineConfig.CacheSizeGB = 1
+				}
+			}).
+			Build()
+		assert.Equal(t, ErrArbiterWithStorageOptions, errors.Cause(err))
+	})
+
+	t.Run("Members with data can have storage options", func(t *testing.T) {
+		_, err := newBuilder().
+			AddProcessMutator(func(idx int, p *Process) {
+				if idx != 2 {
+					p.Args26.Set("storage.engine", "wiredTiger")
+				}
+			}).
+			Build()
+		assert.NoError(t, err)
+	})
+}
+
+func TestAuthPreview(t *testing.T) {
+	t.Run("Auth is disabled without an enabler", func(t *testing.T) {
+		auth, err := NewBuilder().AuthPreview()
+		assert.NoError(t, err)
+		assert.Equal(t, disabledAuth(), auth)
+	})
+
+	t.Run("Auth matches the one of the built config", func(t *testing.T) {
+		sha256 := scramcredentials.ScramCreds{IterationCount: 15000, Salt: "salt"}
+		builder := newTestBuilder("4.4.0").
+			SetAuthEnabler(scramLikeEnabler{}).
+			SetUserSCRAMCredentials("my-user", "admin", sha256, sha256)
+
+		auth, err := builder.AuthPreview()
+		assert.NoError(t, err)
+		assert.False(t, auth.Disabled)
+		assert.Equal(t, []string{"SCRAM-SHA-256"}, auth.DeploymentAuthMechanisms)
+		assert.Len(t, auth.Users, 1)
+
+		ac, err := builder.Build()
+		assert.NoError(t, err)
+		assert.Equal(t, ac.Auth, auth)
+	})
+}
+
+type mechanismEnabler struct {
+	mechanism string
+}
+
+func (e mechanismEnabler) EnableAuth(auth Auth) Auth {
+	auth.Disabled = false
+	auth.AutoAuthMechanism = e.mechanism
+	auth.DeploymentAuthMechanisms = append(auth.DeploymentAuthMechanisms, e.mechanism)
+	return auth
+}
+
+func TestAuthEnablerChain(t *testing.T) {
+	t.Run("Enablers are applied in order", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			AddAuthEnabler(scramLikeEnabler{}).
+			AddAuthEnabler(usersEnabler{users: []MongoDBUser{{Username: "my-user", Database: "admin"}}}).
+			Build()
+		assert.NoError(t, err)
+		assert.False(t, ac.Auth.Disabled)
+		assert.Equal(t, "SCRAM-SHA-256", ac.Auth.AutoAuthMechanism)
+		assert.Len(t, ac.Auth.Users, 1)
+	})
+
+	t.Run("SetAuthEnabler replaces the enablers", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			AddAuthEnabler(mechanismEnabler{mechanism: "MONGODB-X509"}).
+			SetAuthEnabler(scramLikeEnabler{}).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"SCRAM-SHA-256"}, ac.Auth.DeploymentAuthMechanisms)
+	})
+
+	t.Run("Composite enabler folds its enablers", func(t *testing.T) {
+		composite := CompositeAuthEnabler{
+			mechanismEnabler{mechanism: "SCRAM-SHA-256"},
+			usersEnabler{users: []MongoDBUser{{Username: "my-user", Database: "admin"}}},
+		}
+		auth := composite.EnableAuth(disabledAuth())
+		assert.Equal(t, "SCRAM-SHA-256", auth.AutoAuthMechanism)
+		assert.Len(t, auth.Users, 1)
+
+		ac, err := newTestBuilder("4.4.0").SetAuthEnabler(composite).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, auth, ac.Auth)
+	})
+
+	t.Run("Same agent mechanism can be configured more than once", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").
+			AddAuthEnabler(mechanismEnabler{mechanism: "SCRAM-SHA-256"}).
+			AddAuthEnabler(mechanismEnabler{mechanism: "SCRAM-SHA-256"}).
+			Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Conflicting agent mechanisms are rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").
+			AddAuthEnabler(mechanismEnabler{mechanism: "SCRAM-SHA-256"}).
+			AddAuthEnabler(mechanismEnabler{mechanism: "MONGODB-X509"}).
+			Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").
+			SetAuthEnabler(CompositeAuthEnabler{
+				mechanismEnabler{mechanism: "SCRAM-SHA-256"},
+				mechanismEnabler{mechanism: "MONGODB-X509"},
+			}).
+			AuthPreview()
+		assert.Error(t, err, "enablers of a composite enabler should be validated as well")
+	})
+}
+
+func TestNewlyAddedMembers(t *testing.T) {
+	newBuilder := func(members int) *Builder {
+		return newTestBuilder("5.0.0").
+			SetMembers(members)
+	}
+
+	previous, err := newBuilder(4).Build()
+	assert.NoError(t, err)
+	previous.ReplicaSets[0].Members[3].NewlyAdded = true
+
+	t.Run("Flag is kept for members which still have it", func(t *testing.T) {
+		ac, err := newBuilder(4).SetPreviousAutomationConfig(previous).BuildWithResult()
+		assert.NoError(t, err)
+		assert.True(t, ac.Config.ReplicaSets[0].Members[3].NewlyAdded)
+		assert.False(t, ac.Config.ReplicaSets[0].Members[2].NewlyAdded)
+		assert.False(t, ac.Changed)
+	})
+
+	t.Run("Flag isn't set on other members", func(t *testing.T) {
+		ac, err := newBuilder(3).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+		for _, m := range ac.ReplicaSets[0].Members {
+			assert.False(t, m.NewlyAdded)
+		}
+	})
+
+	t.Run("Flag is omitted by default", func(t *testing.T) {
+		ac, err := newBuilder(3).Build()
+		assert.NoError(t, err)
+
+		bytes, err := json.Marshal(ac.ReplicaSets[0])
+		assert.NoError(t, err)
+		assert.NotContains(t, string(bytes), "newlyAdded")
+	})
+}
+
+func TestClearNewlyAddedWhenCaughtUp(t *testing.T) {
+	newBuilder := func(members int) *Builder {
+		return newTestBuilder("5.0.0").
+			SetMembers(members)
+	}
+
+	// the replica set is scaled up from 3 to 6 members, which are all still catching up
+	previous, err := newBuilder(6).Build()
+	assert.NoError(t, err)
+	for i := 3; i < 6; i++ {
+		previous.ReplicaSets[0].Members[i].NewlyAdded = true
+	}
+	newlyAdded := func(ac AutomationConfig) []bool {
+		var flags []bool
+		for _, m := range ac.ReplicaSets[0].Members {
+			flags = append(flags, m.NewlyAdded)
+		}
+		return flags
+	}
+
+	t.Run("Only caught up members are cleared", func(t *testing.T) {
+		result, err := newBuilder(6).
+			SetPreviousAutomationConfig(previous).
+			SetClearNewlyAddedWhenCaughtUp(true).
+			SetMemberCaughtUp(3, true).
+			SetMemberCaughtUp(4, false).
+			BuildWithResult()
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{false, false, false, false, true, true}, newlyAdded(result.Config))
+		assert.True(t, result.Changed)
+	})
+
+	t.Run("The flag is kept when no member caught up", func(t *testing.T) {
+		result, err := newBuilder(6).SetPreviousAutomationConfig(previous).SetClearNewlyAddedWhenCaughtUp(true).BuildWithResult()
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{false, false, false, true, true, true}, newlyAdded(result.Config))
+		assert.False(t, result.Changed)
+	})
+
+	t.Run("All members can be cleared", func(t *testing.T) {
+		ac, err := newBuilder(6).
+			SetPreviousAutomationConfig(previous).
+			SetClearNewlyAddedWhenCaughtUp(true).
+			SetMemberCaughtUp(3, true).
+			SetMemberCaughtUp(4, true).
+			SetMemberCaughtUp(5, true).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{false, false, false, false, false, false}, newlyAdded(ac))
+	})
+
+	t.Run("The catch-up status requires the policy", func(t *testing.T) {
+		_, err := newBuilder(6).SetPreviousAutomationConfig(previous).SetMemberCaughtUp(3, true).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("The member must exist", func(t *testing.T) {
+		_, err := newBuilder(6).SetClearNewlyAddedWhenCaughtUp(true).SetMemberCaughtUp(6, true).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestClusterRole(t *testing.T) {
+	newBuilder := func(name string, role ClusterRole) *Builder {
+		return NewBuilder().
+			SetName(name).
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion("4.4.0").
+			SetMembers(3).
+			SetClusterRole(role)
+	}
+
+	t.Run("Role is set on every process", func(t *testing.T) {
+		csrs, err := newBuilder("my-csrs", ClusterRoleConfigServer).Build()
+		assert.NoError(t, err)
+		assert.True(t, csrs.ReplicaSets[0].ConfigServer)
+		for _, p := range csrs.Processes {
+			assert.Equal(t, ClusterRoleConfigServer, p.Args26.Get("sharding.clusterRole").Data())
+		}
+
+		shard, err := newBuilder("my-shard", ClusterRoleShardServer).
+			AddModifications(func(config *AutomationConfig) {
+				// a sharded deployment also contains the config server replica set
+				config.Processes = append(config.Processes, csrs.Processes...)
+				config.ReplicaSets = append(config.ReplicaSets, csrs.ReplicaSets...)
+			}).
+			Build()
+		assert.NoError(t, err)
+		assert.False(t, shard.ReplicaSets[0].ConfigServer)
+		for _, p := range shard.Processes {
+			if p.Args26.Get("replication.replSetName").Data() == "my-shard" {
+				assert.Equal(t, ClusterRoleShardServer, p.Args26.Get("sharding.clusterRole").Data())
+			}
+		}
+	})
+
+	t.Run("SetConfigServerReplicaSet is the same as the config server role", func(t *testing.T) {
+		ac, err := newBuilder("my-csrs", "").SetConfigServerReplicaSet(true).Build()
+		assert.NoError(t, err)
+		assert.True(t, ac.ReplicaSets[0].ConfigServer)
+
+		ac, err = newBuilder("my-csrs", ClusterRoleConfigServer).SetConfigServerReplicaSet(false).Build()
+		assert.NoError(t, err)
+		assert.False(t, ac.ReplicaSets[0].ConfigServer)
+		assert.Nil(t, ac.Processes[0].Args26.Get("sharding").Data())
+	})
+
+	t.Run("Invalid role is rejected", func(t *testing.T) {
+		_, err := newBuilder("my-rs", "mongos").Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Shard requires a config server replica set", func(t *testing.T) {
+		_, err := newBuilder("my-shard", ClusterRoleShardServer).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Only one config server replica set is allowed", func(t *testing.T) {
+		other, err := newBuilder("other-csrs", ClusterRoleConfigServer).Build()
+		assert.NoError(t, err)
+
+		_, err = newBuilder("my-csrs", ClusterRoleConfigServer).
+			AddModifications(func(config *AutomationConfig) {
+				config.ReplicaSets = append(config.ReplicaSets, other.ReplicaSets...)
+			}).
+			Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestAgentInstallerOptions(t *testing.T) {
+	t.Run("Options are omitted by default", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.AgentVersion)
+
+		bytes, err := json.Marshal(ac)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(bytes), "useBarInstaller")
+		assert.NotContains(t, string(bytes), "agentVersion")
+	})
+
+	t.Run("Options are configured", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").SetUseBarInstaller(true).SetAgentVersion("10.2.15.5958-1").Build()
+		assert.NoError(t, err)
+		assert.True(t, ac.Options.UseBarInstaller)
+		assert.Equal(t, "/var/lib/mongodb-mms-automation", ac.Options.DownloadBase)
+		assert.Equal(t, &AgentVersion{Name: "10.2.15.5958-1"}, ac.AgentVersion)
+	})
+
+	t.Run("Invalid agent versions are rejected", func(t *testing.T) {
+		for _, version := range []string{"latest", "10", "v10.2.15", "10.2.15.5958-x"} {
+			_, err := newTestBuilder("4.4.0").SetAgentVersion(version).Build()
+			assert.Error(t, err, version)
+		}
+	})
+}
+
+func TestRegionTags(t *testing.T) {
+	regions := map[int]string{0: "us-east-1", 1: "us-west-2", 2: "eu-west-1"}
+
+	t.Run("Every member is tagged with its region", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").ConfigureRegionTags(regions).ApplyWANPreset().Build()
+		assert.NoError(t, err)
+		for i, m := range ac.ReplicaSets[0].Members {
+			assert.Equal(t, map[string]string{"region": regions[i]}, m.Tags)
+		}
+		assert.NotNil(t, ac.ReplicaSets[0].Settings)
+	})
+
+	t.Run("Region tags are combined with the backup tag", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			AddDelayedBackupMember(3600).
+			ConfigureRegionTags(map[int]string{3: "us-east-1"}).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"backup": "true", "region": "us-east-1"}, ac.ReplicaSets[0].Members[3].Tags)
+	})
+
+	t.Run("Version isn't increased when the tags are the same", func(t *testing.T) {
+		previous, err := newTestBuilder("4.4.0").ConfigureRegionTags(regions).Build()
+		assert.NoError(t, err)
+
+		result, err := newTestBuilder("4.4.0").ConfigureRegionTags(regions).SetPreviousAutomationConfig(previous).BuildWithResult()
+		assert.NoError(t, err)
+		assert.False(t, result.Changed)
+	})
+
+	t.Run("Invalid regions are rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").ConfigureRegionTags(map[int]string{3: "us-east-1"}).Build()
+		assert.Error(t, err, "the member doesn't exist")
+
+		_, err = newTestBuilder("4.4.0").ConfigureRegionTags(map[int]string{0: ""}).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestTLSRollingValidation(t *testing.T) {
+	newBuilder := func(version string, mode TLSMode) *Builder {
+		b := newTestBuilder(version).
+			SetTLSRollingValidation(true).
+			SetAllowTLSDisable(true)
+		if mode != "" {
+			b.SetTLS(mode, "/tls/ca.crt", "/tls/server.pem")
+		}
+		return b
+	}
+	build := func(version string, from, to TLSMode) error {
+		previous, err := newBuilder(version, from).Build()
+		assert.NoError(t, err)
+		_, err = newBuilder(version, to).SetPreviousAutomationConfig(previous).Build()
+		return err
+	}
+
+	t.Run("Modes can change one step at a time", func(t *testing.T) {
+		modes := []TLSMode{"", TLSModeAllowed, TLSModePreferred, TLSModeRequired}
+		for _, version := range []string{"4.0.0", "4.4.0"} {
+			for i := 1; i < len(modes); i++ {
+				assert.NoError(t, build(version, modes[i-1], modes[i]))
+				assert.NoError(t, build(version, modes[i], modes[i-1]))
+			}
+		}
+	})
+
+	t.Run("Skipping a step is rejected", func(t *testing.T) {
+		for _, version := range []string{"4.0.0", "4.4.0"} {
+			err := build(version, "", TLSModeRequired)
+			assert.Equal(t, ErrInvalidTLSModeTransition, errors.Cause(err))
+
+			err = build(version, TLSModeAllowed, TLSModeRequired)
+			assert.Equal(t, ErrInvalidTLSModeTransition, errors.Cause(err))
+
+			err = build(version, TLSModeRequired, TLSModeDisabled)
+			assert.Equal(t, ErrInvalidTLSModeTransition, errors.Cause(err))
+		}
+	})
+
+	t.Run("New processes can have any mode", func(t *testing.T) {
+		_, err := newBuilder("4.4.0", TLSModeRequired).Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Transitions aren't validated by default", func(t *testing.T) {
+		previous, err := newBuilder("4.4.0", "").Build()
+		assert.NoError(t, err)
+		_, err = newBuilder("4.4.0", TLSModeRequired).SetTLSRollingValidation(false).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+	})
+}
+
+func TestArchitectureFilter(t *testing.T) {
+	multiArchVersion := func(name string, architectures ...string) MongoDbVersionConfig {
+		version := MongoDbVersionConfig{Name: name}
+		for _, architecture := range architectures {
+			version.Builds = append(version.Builds, BuildConfig{Architecture: architecture, Platform: "linux", Url: "some-url-" + architecture})
+		}
+		return version
+	}
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			AddVersion(multiArchVersion("4.4.0", "amd64", "aarch64", "ppc64le")).
+			AddVersion(multiArchVersion("4.4.1", "amd64", "s390x"))
+	}
+
+	t.Run("All builds are kept by default", func(t *testing.T) {
+		ac, err := newBuilder().Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.Versions[0].Builds, 3)
+		assert.Len(t, ac.Versions[1].Builds, 2)
+	})
+
+	t.Run("Only builds for the architectures are kept", func(t *testing.T) {
+		builder := newBuilder().SetArchitectureFilter([]string{"amd64"})
+		ac, err := builder.Build()
+		assert.NoError(t, err)
+		for _, version := range ac.Versions {
+			assert.Len(t, version.Builds, 1)
+			assert.Equal(t, "amd64", version.Builds[0].Architecture)
+			assert.NotNil(t, version.Builds[0].Modules)
+		}
+
+		ac, err = builder.SetArchitectureFilter(nil).Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.Versions[0].Builds, 3, "the configured versions should not be changed")
+	})
+
+	t.Run("Every version needs a build", func(t *testing.T) {
+		_, err := newBuilder().SetArchitectureFilter([]string{"aarch64"}).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestChainingAllowed(t *testing.T) {
+	newBuilder := func(members int, log *zap.SugaredLogger) *Builder {
+		return newTestBuilder("4.4.0").
+			SetMembers(members).
+			SetLogger(log)
+	}
+
+	t.Run("Chaining can be disabled", func(t *testing.T) {
+		ac, err := newBuilder(3, zap.S()).SetChainingAllowed(false).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, false, *ac.ReplicaSets[0].Settings.ChainingAllowed)
+	})
+
+	t.Run("It overrides the preset", func(t *testing.T) {
+		ac, err := newBuilder(3, zap.S()).ApplyWANPreset().SetChainingAllowed(false).Build()
+		assert.NoError(t, err)
+		settings := ac.ReplicaSets[0].Settings
+		assert.Equal(t, false, *settings.ChainingAllowed)
+		assert.Equal(t, 20000, *settings.ElectionTimeoutMillis, "the other settings should be kept")
+	})
+
+	t.Run("A warning is logged for more than 5 members", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		_, err := newBuilder(5, zap.New(core).Sugar()).SetChainingAllowed(false).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, logs.Len())
+
+		_, err = newBuilder(6, zap.New(core).Sugar()).SetChainingAllowed(false).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, logs.FilterMessageSnippet("all its 6 members sync from the primary").Len())
+	})
+
+	t.Run("No warning is logged when chaining is allowed", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		_, err := newBuilder(6, zap.New(core).Sugar()).SetChainingAllowed(true).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, logs.Len())
+	})
+}
+
+func TestWriteConcernModes(t *testing.T) {
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			ConfigureRegionTags(map[int]string{0: "us-east-1", 1: "us-east-1", 2: "eu-west-1"})
+	}
+
+	t.Run("Modes are configured in the settings", func(t *testing.T) {
+		modes := map[string]map[string]int{"multiRegion": {"region": 2}}
+		ac, err := newBuilder().ApplyWANPreset().SetWriteConcernModes(modes).Build()
+		assert.NoError(t, err)
+		settings := ac.ReplicaSets[0].Settings
+		assert.Equal(t, modes, settings.GetLastErrorModes)
+		assert.Equal(t, 20000, *settings.ElectionTimeoutMillis, "the other settings should be kept")
+	})
+
+	t.Run("Unknown tags are rejected", func(t *testing.T) {
+		_, err := newBuilder().SetWriteConcernModes(map[string]map[string]int{"multiZone": {"zone": 2}}).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Modes which can't be satisfied are rejected", func(t *testing.T) {
+		_, err := newBuilder().SetWriteConcernModes(map[string]map[string]int{"multiRegion": {"region": 3}}).Build()
+		assert.Error(t, err)
+
+		_, err = newBuilder().SetWriteConcernModes(map[string]map[string]int{"multiRegion": {"region": 0}}).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestUnixDomainSocket(t *testing.T) {
+	t.Run("Socket isn't configured by default", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.Processes[0].Args26.Get("net.unixDomainSocket").Data())
+	})
+
+	t.Run("Socket is enabled with a path prefix", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").SetUnixDomainSocket(true, "/var/run/mongodb").Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, true, p.Args26.Get("net.unixDomainSocket.enabled").Data())
+			assert.Equal(t, "/var/run/mongodb", p.Args26.Get("net.unixDomainSocket.pathPrefix").Data())
+		}
+	})
+
+	t.Run("Socket can be disabled", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").SetUnixDomainSocket(false, "").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, false, ac.Processes[0].Args26.Get("net.unixDomainSocket.enabled").Data())
+		assert.Nil(t, ac.Processes[0].Args26.Get("net.unixDomainSocket.pathPrefix").Data())
+	})
+
+	t.Run("Relative path prefix is rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetUnixDomainSocket(true, "run/mongodb").Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestReplicaSetIdIsPreserved(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.ReplicaSets[0].Settings)
+
+	// the id is set once the replica set has been initiated
+	ac.ReplicaSets[0].Settings = &ReplicaSetSettings{ReplicaSetId: "5f7a2b7c9d3e4f1a2b3c4d5e"}
+
+	t.Run("Id survives repeated builds", func(t *testing.T) {
+		previous := ac
+		for i := 0; i < 3; i++ {
+			result, err := newTestBuilder("4.4.0").SetPreviousAutomationConfig(previous).BuildWithResult()
+			assert.NoError(t, err)
+			assert.Equal(t, "5f7a2b7c9d3e4f1a2b3c4d5e", result.Config.ReplicaSets[0].Settings.ReplicaSetId)
+			assert.False(t, result.Changed)
+			previous = result.Config
+		}
+	})
+
+	t.Run("Id is kept with other settings", func(t *testing.T) {
+		result, err := newTestBuilder("4.4.0").ApplyWANPreset().SetPreviousAutomationConfig(ac).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "5f7a2b7c9d3e4f1a2b3c4d5e", result.ReplicaSets[0].Settings.ReplicaSetId)
+		assert.Equal(t, 20000, *result.ReplicaSets[0].Settings.ElectionTimeoutMillis)
+	})
+
+	t.Run("Id can't be changed", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").
+			SetReplicaSetSettings(ReplicaSetSettings{ReplicaSetId: "000000000000000000000000"}).
+			SetPreviousAutomationConfig(ac).
+			Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").
+			AddReplicaSetMutator(func(rs *ReplicaSet) {
+				rs.Settings = nil
+			}).
+			SetPreviousAutomationConfig(ac).
+			Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestMongosConfigDB(t *testing.T) {
+	// the Builder only builds replica sets, so the mongos is added by a modification
+	withMongos := func(config *AutomationConfig) {
+		mongos := newProcess("my-mongos-0", "my-mongos-0.my-ns.svc.cluster.local", "4.4.0", "")
+		mongos.ProcessType = Mongos
+		config.Processes = append(config.Processes, mongos)
+	}
+	newBuilder := func() *Builder {
+		return NewBuilder().
+			SetName("my-csrs").
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion("4.4.0").
+			SetMembers(3).
+			SetClusterRole(ClusterRoleConfigServer).
+			AddModifications(withMongos)
+	}
+	mongosOf := func(ac AutomationConfig) Process {
+		return ac.Processes[len(ac.Processes)-1]
+	}
+
+	t.Run("Config DB is derived from the config server replica set", func(t *testing.T) {
+		ac, err := newBuilder().Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "my-csrs/my-csrs-0.my-ns.svc.cluster.local:27017,my-csrs-1.my-ns.svc.cluster.local:27017,my-csrs-2.my-ns.svc.cluster.local:27017",
+			mongosOf(ac).Args26.Get("sharding.configDB").Data())
+		assert.Nil(t, ac.Processes[0].Args26.Get("sharding.configDB").Data(), "only mongos processes should have a config DB")
+	})
+
+	t.Run("Mongos processes of a sharded cluster with TLS", func(t *testing.T) {
+		newTLSBuilder := func(name string, role ClusterRole) *Builder {
+			return NewBuilder().
+				SetName(name).
+				SetDomain("my-ns.svc.cluster.local").
+				SetMongoDBVersion("4.4.0").
+				SetMembers(3).
+				SetClusterRole(role).
+				SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem")
+		}
+		csrs, err := newTLSBuilder("my-csrs", ClusterRoleConfigServer).Build()
+		assert.NoError(t, err)
+
+		ac, err := newTLSBuilder("my-shard", ClusterRoleShardServer).
+			AddModifications(func(config *AutomationConfig) {
+				config.Processes = append(config.Processes, csrs.Processes...)
+				config.ReplicaSets = append(config.ReplicaSets, csrs.ReplicaSets...)
+			}, withMongos).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "/tls/ca.crt", ac.TLS.CAFilePath, "the agent should trust the configured CA")
+		processTypes := map[ProcessType]int{}
+		for _, p := range ac.Processes {
+			processTypes[p.ProcessType]++
+			assert.Equal(t, TLSModeRequired, p.Args26.Get("net.tls.mode").Data(), p.Name)
+			assert.Equal(t, "/tls/ca.crt", p.Args26.Get("net.tls.CAFile").Data(), p.Name)
+		}
+		assert.Equal(t, map[ProcessType]int{Mongod: 6, Mongos: 1}, processTypes)
+		assert.Equal(t, "my-csrs/my-csrs-0.my-ns.svc.cluster.local:27017,my-csrs-1.my-ns.svc.cluster.local:27017,my-csrs-2.my-ns.svc.cluster.local:27017",
+			mongosOf(ac).Args26.Get("sharding.configDB").Data())
+	})
+
+	t.Run("Config servers without a port use the default one", func(t *testing.T) {
+		ac, err := newBuilder().AddModifications(func(config *AutomationConfig) {
+			for _, p := range config.Processes {
+				if p.ProcessType == Mongod {
+					p.Args26.Set("net", map[string]interface{}{})
+				}
+			}
+		}).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "my-csrs/my-csrs-0.my-ns.svc.cluster.local:27017,my-csrs-1.my-ns.svc.cluster.local:27017,my-csrs-2.my-ns.svc.cluster.local:27017",
+			mongosOf(ac).Args26.Get("sharding.configDB").Data())
+	})
+
+	t.Run("Config DB can be configured explicitly", func(t *testing.T) {
+		ac, err := newBuilder().SetConfigDB("my-csrs/my-csrs-0.my-ns.svc.cluster.local:27017").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "my-csrs/my-csrs-0.my-ns.svc.cluster.local:27017", mongosOf(ac).Args26.Get("sharding.configDB").Data())
+	})
+
+	t.Run("Malformed config DB is rejected", func(t *testing.T) {
+		for _, configDB := range []string{"my-csrs", "my-csrs/", "my-csrs/host", "my-csrs/host:port", "/host:27017"} {
+			_, err := newBuilder().SetConfigDB(configDB).Build()
+			assert.Error(t, err, configDB)
+		}
+	})
+
+	t.Run("Config DB must reference the config server replica set", func(t *testing.T) {
+		_, err := newBuilder().SetConfigDB("other-csrs/my-csrs-0.my-ns.svc.cluster.local:27017").Build()
+		assert.Error(t, err)
+
+		_, err = newBuilder().SetConfigDB("my-csrs/other-host:27017").Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Config DB requires a config server replica set", func(t *testing.T) {
+		builder := newTestBuilder("4.4.0").
+			AddModifications(withMongos)
+
+		ac, err := builder.Build()
+		assert.NoError(t, err)
+		assert.Nil(t, mongosOf(ac).Args26.Get("sharding.configDB").Data(), "there is no config server replica set to derive it from")
+
+		_, err = builder.SetConfigDB("my-rs/my-rs-0.my-ns.svc.cluster.local:27017").Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestEnterpriseFeatures(t *testing.T) {
+	enterpriseVersion := func(version string) MongoDbVersionConfig {
+		v := defaultMongoDbVersion(version)
+		v.Builds[0].Modules = []string{"enterprise"}
+		return v
+	}
+	withAudit := func(idx int, p *Process) {
+		p.Args26.Set("auditLog.destination", "file")
+	}
+	newBuilder := func(version MongoDbVersionConfig) *Builder {
+		return newTestBuilder("4.4.0").
+			AddVersion(version)
+	}
+
+	t.Run("Enterprise features are allowed on enterprise builds", func(t *testing.T) {
+		_, err := newBuilder(enterpriseVersion("4.4.0")).AddProcessMutator(withAudit).Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Enterprise features are rejected on community builds", func(t *testing.T) {
+		for _, option := range []string{"auditLog.destination", "security.kmip.serverName", "security.ldap.servers", "security.redactClientLogData"} {
+			_, err := newBuilder(defaultMongoDbVersion("4.4.0")).
+				AddProcessMutator(func(idx int, p *Process) {
+					p.Args26.Set(option, "value")
+				}).
+				Build()
+			assert.Equal(t, ErrEnterpriseFeatureOnCommunity, errors.Cause(err), option)
+		}
+	})
+
+	t.Run("Community builds without enterprise features are accepted", func(t *testing.T) {
+		_, err := newBuilder(defaultMongoDbVersion("4.4.0")).Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Client log data can be redacted on enterprise builds", func(t *testing.T) {
+		ac, err := newBuilder(enterpriseVersion("4.4.0")).SetRedactClientLogData(true).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, true, p.Args26.Get("security.redactClientLogData").Data())
+		}
+
+		ac, err = newBuilder(enterpriseVersion("4.4.0")).SetRedactClientLogData(false).Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.Processes[0].Args26.Get("security.redactClientLogData").Data(), "it should only be written when enabled")
+	})
+
+	t.Run("Client log data can't be redacted on community builds", func(t *testing.T) {
+		_, err := newBuilder(defaultMongoDbVersion("4.4.0")).SetRedactClientLogData(true).Build()
+		assert.Equal(t, ErrEnterpriseFeatureOnCommunity, errors.Cause(err))
+	})
+
+	t.Run("Builds of a version must agree on the enterprise module", func(t *testing.T) {
+		mixed := enterpriseVersion("4.4.0")
+		mixed.Builds = append(mixed.Builds, defaultMongoDbVersion("4.4.0").Builds...)
+		_, err := newBuilder(mixed).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestBuildNoVersionChange(t *testing.T) {
+	newBuilder := func(members int) *Builder {
+		return newTestBuilder("4.4.0").
+			SetMembers(members)
+	}
+
+	ac, err := newBuilder(3).BuildNoVersionChange()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, ac.Version)
+
+	previous, err := newBuilder(3).Build()
+	assert.NoError(t, err)
+
+	ac, err = newBuilder(5).SetPreviousAutomationConfig(previous).BuildNoVersionChange()
+	assert.NoError(t, err)
+	assert.Equal(t, previous.Version, ac.Version, "the version should not be increased")
+	assert.Len(t, ac.Processes, 5, "the changes should be applied")
+}
+
+func TestBuildScaledToZero(t *testing.T) {
+	seven, zero, buildIndexes := 7, 0, false
+	newBuilder := func() *Builder {
+		return NewBuilder().
+			SetName("my-rs").
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion("4.4.0").
+			SetMembersSpec([]MemberSpec{
+				{},
+				{Tags: map[string]string{"zone": "b"}},
+				{Id: &seven, Priority: &zero, Hidden: true, BuildIndexes: &buildIndexes},
+			})
+	}
+
+	running, err := newBuilder().Build()
+	assert.NoError(t, err)
+	for _, p := range running.Processes {
+		assert.False(t, p.Disabled)
+	}
+
+	paused, err := newBuilder().SetPreviousAutomationConfig(running).BuildScaledToZero()
+	assert.NoError(t, err)
+	assert.Equal(t, running.Version+1, paused.Version, "the agents should shut the processes down")
+	assert.Len(t, paused.Processes, 3)
+	for _, p := range paused.Processes {
+		assert.True(t, p.Disabled)
+	}
+	assert.Equal(t, running.ReplicaSets, paused.ReplicaSets)
+
+	pausedBytes, err := json.Marshal(paused)
+	assert.NoError(t, err)
+	assert.Contains(t, string(pausedBytes), `"disabled":true`)
+
+	resumed, err := newBuilder().SetPreviousAutomationConfig(paused).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, paused.Version+1, resumed.Version, "the agents should start the processes again")
+	assert.Equal(t, running.Processes, resumed.Processes)
+	assert.Equal(t, running.ReplicaSets, resumed.ReplicaSets)
+	assert.Equal(t, 7, resumed.ReplicaSets[0].Members[2].Id)
+
+	t.Run("The Builder isn't scaled to zero", func(t *testing.T) {
+		builder := newBuilder()
+		_, err := builder.BuildScaledToZero()
+		assert.NoError(t, err)
+
+		ac, err := builder.Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.False(t, p.Disabled)
+		}
+	})
+}
+
+func TestMaxArbiters(t *testing.T) {
+	withArbiters := func(count int) ReplicaSetMutator {
+		return func(rs *ReplicaSet) {
+			for i := 0; i < count; i++ {
+				m := &rs.Members[len(rs.Members)-1-i]
+				m.ArbiterOnly = true
+				m.Priority = 0
+			}
+		}
+	}
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			SetMembers(5)
+	}
+
+	t.Run("One arbiter is allowed by default", func(t *testing.T) {
+		_, err := newBuilder().AddReplicaSetMutator(withArbiters(1)).Build()
+		assert.NoError(t, err)
+
+		_, err = newBuilder().AddReplicaSetMutator(withArbiters(2)).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Limit can be changed", func(t *testing.T) {
+		_, err := newBuilder().SetMaxArbiters(2).AddReplicaSetMutator(withArbiters(2)).Build()
+		assert.NoError(t, err)
+
+		_, err = newBuilder().SetMaxArbiters(0).AddReplicaSetMutator(withArbiters(1)).Build()
+		assert.Error(t, err)
+
+		_, err = newBuilder().SetMaxArbiters(-1).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestAgentProxy(t *testing.T) {
+	t.Run("Proxies are configured in the options", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			SetAgentProxy("http://proxy.example.com:3128", "https://proxy.example.com:3129", "localhost,.svc.cluster.local").
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "http://proxy.example.com:3128", ac.Options.HTTPProxy)
+		assert.Equal(t, "https://proxy.example.com:3129", ac.Options.HTTPSProxy)
+		assert.Equal(t, "localhost,.svc.cluster.local", ac.Options.NoProxy)
+		assert.Equal(t, "/var/lib/mongodb-mms-automation", ac.Options.DownloadBase)
+	})
+
+	t.Run("Proxies are omitted by default", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+
+		bytes, err := json.Marshal(ac.Options)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"downloadBase": "/var/lib/mongodb-mms-automation"}`, string(bytes))
+	})
+
+	t.Run("Invalid proxies are rejected", func(t *testing.T) {
+		for _, proxy := range []string{"proxy.example.com:3128", "ftp://proxy.example.com", "http://", "http://%zz"} {
+			_, err := newTestBuilder("4.4.0").SetAgentProxy(proxy, "", "").Build()
+			assert.Error(t, err, proxy)
+
+			_, err = newTestBuilder("4.4.0").SetAgentProxy("", proxy, "").Build()
+			assert.Error(t, err, proxy)
+		}
+	})
+}
+
+func TestDelayedMembersMustNotVote(t *testing.T) {
+	newBuilder := func(log *zap.SugaredLogger) *Builder {
+		return newTestBuilder("4.4.0").
+			SetMemberSecondaryDelay(2, 3600).
+			SetLogger(log)
+	}
+
+	t.Run("Delayed members which can vote are rejected by default", func(t *testing.T) {
+		_, err := newBuilder(zap.S()).Build()
+		assert.Error(t, err)
+
+		_, err = newBuilder(zap.S()).AddReplicaSetMutator(func(rs *ReplicaSet) {
+			rs.Members[2].Priority = 0
+		}).Build()
+		assert.Error(t, err, "delayed members must not vote either")
+	})
+
+	t.Run("Priority and votes are corrected with a warning", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder(zap.New(core).Sugar()).SetAutoCorrectDelayedMembers(true).Build()
+		assert.NoError(t, err)
+
+		delayed := ac.ReplicaSets[0].Members[2]
+		assert.Equal(t, 3600, delayed.SlaveDelay)
+		assert.Equal(t, 0, delayed.Priority)
+		assert.Equal(t, 0, delayed.Votes)
+		assert.Equal(t, 1, ac.ReplicaSets[0].Members[0].Votes, "other members should not be changed")
+		assert.Equal(t, 1, logs.FilterMessageSnippet("my-rs-2").Len())
+	})
+
+	t.Run("No warning is logged when nothing is corrected", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		_, err := newTestBuilder("4.4.0").
+			AddDelayedBackupMember(3600).
+			SetAutoCorrectDelayedMembers(true).
+			SetLogger(zap.New(core).Sugar()).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, logs.Len())
+	})
+}
+
+func TestTLSCipherConfig(t *testing.T) {
+	const ciphers = "HIGH:!EXPORT:!aNULL@STRENGTH"
+
+	ac, err := newTestBuilder("4.4.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		SetTLSCipherConfig(ciphers).
+		Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, ciphers, p.Args26.Get("setParameter.opensslCipherConfig").Data())
+		assert.Nil(t, p.Args26.Get("net.tls.tlsCipherConfig").Data(), "net.tls has no cipher config")
+	}
+
+	ac, err = newTestBuilder("4.0.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		SetTLSCipherConfig(ciphers).
+		Build()
+	assert.NoError(t, err)
+	assert.Equal(t, ciphers, ac.Processes[0].Args26.Get("setParameter.opensslCipherConfig").Data(), "the parameter doesn't depend on the namespace")
+	assert.Nil(t, ac.Processes[0].Args26.Get("net.ssl.sslCipherConfig").Data())
+
+	ac, err = newTestBuilder("4.4.0").SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.Processes[0].Args26.Get("setParameter.opensslCipherConfig").Data())
+
+	_, err = newTestBuilder("4.4.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		SetTLSCipherConfig("").
+		Build()
+	assert.Error(t, err, "the cipher config must not be empty")
+
+	_, err = newTestBuilder("4.4.0").SetTLSCipherConfig(ciphers).Build()
+	assert.Error(t, err, "TLS needs to be enabled")
+}
+
+func TestTLSDisableNotAllowed(t *testing.T) {
+	newBuilder := func(mode TLSMode) *Builder {
+		b := newTestBuilder("4.4.0")
+		if mode != "" {
+			b.SetTLS(mode, "/tls/ca.crt", "/tls/server.pem")
+		}
+		return b
+	}
+	previous, err := newBuilder(TLSModeAllowed).Build()
+	assert.NoError(t, err)
+
+	t.Run("Disabling TLS is rejected by default", func(t *testing.T) {
+		_, err := newBuilder("").SetPreviousAutomationConfig(previous).Build()
+		assert.Equal(t, ErrTLSDisableNotAllowed, errors.Cause(err))
+
+		_, err = newBuilder(TLSModeDisabled).SetPreviousAutomationConfig(previous).Build()
+		assert.Equal(t, ErrTLSDisableNotAllowed, errors.Cause(err))
+	})
+
+	t.Run("Disabling TLS can be allowed", func(t *testing.T) {
+		ac, err := newBuilder("").SetPreviousAutomationConfig(previous).SetAllowTLSDisable(true).Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.Processes[0].Args26.Get("net.tls.mode").Data())
+	})
+
+	t.Run("Changing the mode of enabled TLS is allowed", func(t *testing.T) {
+		_, err := newBuilder(TLSModePreferred).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Configs without TLS are not affected", func(t *testing.T) {
+		previous, err := newBuilder("").Build()
+		assert.NoError(t, err)
+		_, err = newBuilder("").SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+	})
+}
+
+func TestProcessArgsTemplate(t *testing.T) {
+	t.Run("Options are merged onto the template", func(t *testing.T) {
+		template := json.RawMessage(`{"net": {"port": 27018, "compression": {"compressors": "zstd"}}, "setParameter": {"newFlag": true}}`)
+		ac, err := newTestBuilder("4.4.0").
+			SetProcessArgsTemplate(template).
+			SetInitialSyncSourceReadPreference("secondaryPreferred").
+			Build()
+		assert.NoError(t, err)
+
+		for _, p := range ac.Processes {
+			assert.Equal(t, "zstd", p.Args26.Get("net.compression.compressors").Data())
+			assert.Equal(t, true, p.Args26.Get("setParameter.newFlag").Data())
+			assert.Equal(t, "secondaryPreferred", p.Args26.Get("setParameter.initialSyncSourceReadPreference").Data())
+			assert.Equal(t, 27017, p.Args26.Get("net.port").Data(), "the defaults of the Builder are merged onto the template")
+			assert.Equal(t, "my-rs", p.Args26.Get("replication.replSetName").Data())
+		}
+	})
+
+	t.Run("Processes don't share the template", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			SetProcessArgsTemplate(json.RawMessage(`{"setParameter": {"newFlag": true}}`)).
+			AddProcessMutator(func(idx int, p *Process) {
+				p.Args26.Set("setParameter.index", idx)
+			}).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, ac.Processes[0].Args26.Get("setParameter.index").Data())
+		assert.Equal(t, 2, ac.Processes[2].Args26.Get("setParameter.index").Data())
+	})
+
+	t.Run("Invalid templates are rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetProcessArgsTemplate(json.RawMessage(`{"net": `)).Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").SetProcessArgsTemplate(json.RawMessage(`["net"]`)).Build()
+		assert.Error(t, err, "the template must be an object")
+	})
+}
+
+func TestMinorityScaleDown(t *testing.T) {
+	newBuilder := func(members int) *Builder {
+		return newTestBuilder("4.4.0").
+			SetMembers(members)
+	}
+	previous, err := newBuilder(5).Build()
+	assert.NoError(t, err)
+
+	t.Run("Keeping a majority of the voting members is allowed", func(t *testing.T) {
+		_, err := newBuilder(4).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+
+		_, err = newBuilder(3).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("One voting member can always be removed", func(t *testing.T) {
+		previous, err := newBuilder(2).Build()
+		assert.NoError(t, err)
+
+		ac, err := newBuilder(1).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.ReplicaSets[0].Members, 1)
+
+		previous, err = newBuilder(3).Build()
+		assert.NoError(t, err)
+
+		_, err = newBuilder(1).SetPreviousAutomationConfig(previous).Build()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "at least 2 members")
+	})
+
+	t.Run("Keeping a minority of the voting members is rejected", func(t *testing.T) {
+		_, err := newBuilder(2).SetPreviousAutomationConfig(previous).Build()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "at least 3 members")
+	})
+
+	t.Run("Members which didn't vote before don't count towards the majority", func(t *testing.T) {
+		previous, err := newBuilder(5).AddReplicaSetMutator(func(rs *ReplicaSet) {
+			rs.Members[1].Votes = 0
+			rs.Members[1].Priority = 0
+		}).Build()
+		assert.NoError(t, err)
+
+		_, err = newBuilder(3).SetPreviousAutomationConfig(previous).Build()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "at least 4 members")
+	})
+
+	t.Run("Minority scale downs can be allowed", func(t *testing.T) {
+		ac, err := newBuilder(1).SetPreviousAutomationConfig(previous).SetAllowMinorityScaleDown(true).Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.ReplicaSets[0].Members, 1)
+	})
+}
+
+func TestIncrementalReconfigValidation(t *testing.T) {
+	newBuilder := func(version string, members int) *Builder {
+		return newTestBuilder(version).
+			SetMembers(members).
+			SetIncrementalReconfigValidation(true)
+	}
+	previous, err := newBuilder("4.4.0", 3).Build()
+	assert.NoError(t, err)
+
+	t.Run("The votes of one member can change", func(t *testing.T) {
+		_, err := newBuilder("4.4.0", 4).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+
+		zero := 0
+		_, err = newBuilder("4.4.0", 5).SetMembersSpec([]MemberSpec{
+			{}, {}, {}, {}, {Votes: &zero, Priority: &zero},
+		}).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err, "non-voting members don't count")
+	})
+
+	t.Run("The votes of several members can't change at once", func(t *testing.T) {
+		_, err := newBuilder("4.4.0", 5).SetPreviousAutomationConfig(previous).Build()
+		assert.Equal(t, ErrUnsafeSimultaneousReconfig, errors.Cause(err))
+		assert.Contains(t, err.Error(), "(my-rs-3, my-rs-4)")
+		assert.Contains(t, err.Error(), "in 2 steps")
+
+		zero := 0
+		_, err = newBuilder("4.4.0", 4).SetMembersSpec([]MemberSpec{
+			{}, {}, {Votes: &zero, Priority: &zero}, {},
+		}).SetPreviousAutomationConfig(previous).Build()
+		assert.Equal(t, ErrUnsafeSimultaneousReconfig, errors.Cause(err), "adding a voting member and removing the votes of another one are two changes")
+	})
+
+	t.Run("The votes check is skipped when it doesn't apply", func(t *testing.T) {
+		previous42, err := newBuilder("4.2.0", 3).Build()
+		assert.NoError(t, err)
+		_, err = newBuilder("4.2.0", 5).SetPreviousAutomationConfig(previous42).Build()
+		assert.NoError(t, err, "MongoDB 4.2 allows several voting changes")
+
+		_, err = newBuilder("4.4.0", 5).SetForceReconfig(true).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+
+		_, err = newBuilder("4.4.0", 5).SetIncrementalReconfigValidation(false).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("buildIndexes and arbiterOnly can't change", func(t *testing.T) {
+		zero, buildIndexes := 0, false
+		_, err := newBuilder("4.4.0", 3).SetMembersSpec([]MemberSpec{
+			{}, {}, {Priority: &zero, Hidden: true, BuildIndexes: &buildIndexes},
+		}).SetPreviousAutomationConfig(previous).Build()
+		assert.Equal(t, ErrUnsafeSimultaneousReconfig, errors.Cause(err))
+		assert.Contains(t, err.Error(), "changes buildIndexes")
+
+		_, err = newBuilder("4.4.0", 3).AddReplicaSetMutator(func(rs *ReplicaSet) {
+			rs.Members[2].ArbiterOnly = true
+			rs.Members[2].Priority = 0
+		}).SetPreviousAutomationConfig(previous).Build()
+		assert.Equal(t, ErrUnsafeSimultaneousReconfig, errors.Cause(err))
+		assert.Contains(t, err.Error(), "changes arbiterOnly")
+	})
+}
+
+func TestOplogMinRetentionHours(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").SetOplogMinRetentionHours(1.5).Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, 1.5, p.Args26.Get("storage.oplogMinRetentionHours").Data())
+	}
+
+	ac, err = newTestBuilder("4.4.0").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.Processes[0].Args26.Get("storage.oplogMinRetentionHours").Data())
+
+	_, err = newTestBuilder("4.4.0").SetOplogMinRetentionHours(-1).Build()
+	assert.Error(t, err)
+
+	_, err = newTestBuilder("4.2.0").SetOplogMinRetentionHours(24).Build()
+	assert.Error(t, err)
+}
+
+func TestConvertStandaloneToReplicaSet(t *testing.T) {
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			SetConvertStandaloneToReplicaSet(true)
+	}
+	newStandalone := func(name string) AutomationConfig {
+		p := newProcess(name, name+".my-ns.svc.cluster.local", "4.4.0", "")
+		delete(p.Args26, "replication")
+		return AutomationConfig{Version: 1, Processes: []Process{p}}
+	}
+
+	t.Run("The standalone becomes the only member", func(t *testing.T) {
+		ac, err := newBuilder().SetPreviousAutomationConfig(newStandalone("my-rs-0")).Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.Processes, 1)
+		assert.Equal(t, "my-rs", ac.Processes[0].Args26.Get("replication.replSetName").Data())
+		assert.Len(t, ac.ReplicaSets[0].Members, 1)
+		assert.Equal(t, "my-rs-0", ac.ReplicaSets[0].Members[0].Host)
+
+		ac, err = newBuilder().SetPreviousAutomationConfig(ac).Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.Processes, 3, "the other members should be added once the replica set exists")
+		assert.Len(t, ac.ReplicaSets[0].Members, 3)
+	})
+
+	t.Run("New deployments are not affected", func(t *testing.T) {
+		ac, err := newBuilder().Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.ReplicaSets[0].Members, 3)
+	})
+
+	t.Run("Only a standalone can be converted", func(t *testing.T) {
+		_, err := newBuilder().SetPreviousAutomationConfig(newStandalone("other-0")).Build()
+		assert.Error(t, err, "the standalone must become the first member")
+
+		previous := newStandalone("my-rs-0")
+		previous.Processes[0].Args26.Set("replication.replSetName", "other")
+		_, err = newBuilder().SetPreviousAutomationConfig(previous).Build()
+		assert.Error(t, err, "a member of another replica set is not a standalone")
+
+		previous = newStandalone("my-rs-0")
+		previous.Processes = append(previous.Processes, newStandalone("my-rs-1").Processes...)
+		_, err = newBuilder().SetPreviousAutomationConfig(previous).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestMemberBuildIndexes(t *testing.T) {
+	t.Run("Members build indexes by default", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		for _, m := range ac.ReplicaSets[0].Members {
+			assert.Nil(t, m.BuildIndexes)
+		}
+	})
+
+	t.Run("Hidden members with priority 0 can skip building indexes", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").AddDelayedBackupMember(3600).SetMemberBuildIndexes(3, false).Build()
+		assert.NoError(t, err)
+		assert.False(t, *ac.ReplicaSets[0].Members[3].BuildIndexes)
+
+		ac, err = newTestBuilder("4.4.0").SetMemberBuildIndexes(2, false).AddReplicaSetMutator(func(rs *ReplicaSet) {
+			rs.Members[2].Hidden = true
+			rs.Members[2].Priority = 0
+		}).Build()
+		assert.NoError(t, err)
+		assert.False(t, *ac.ReplicaSets[0].Members[2].BuildIndexes)
+	})
+
+	t.Run("Other members must build indexes", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetMemberBuildIndexes(2, false).Build()
+		assert.Equal(t, ErrBuildIndexesRequiresHidden, errors.Cause(err))
+
+		_, err = newTestBuilder("4.4.0").SetMemberBuildIndexes(2, false).AddReplicaSetMutator(func(rs *ReplicaSet) {
+			rs.Members[2].Priority = 0
+		}).Build()
+		assert.Equal(t, ErrBuildIndexesRequiresHidden, errors.Cause(err), "the member must be hidden too")
+
+		_, err = newTestBuilder("4.4.0").SetMemberBuildIndexes(2, true).Build()
+		assert.NoError(t, err)
+	})
+}
+
+func TestDuplicateVersionsAreMerged(t *testing.T) {
+	newBuilder := func(log *zap.SugaredLogger) *Builder {
+		return newTestBuilder("4.4.0").
+			SetLogger(log)
+	}
+	arm64 := defaultMongoDbVersion("4.4.0")
+	arm64.Builds[0].Architecture = "arm64"
+
+	core, logs := observer.New(zap.InfoLevel)
+	ac, err := newBuilder(zap.New(core).Sugar()).
+		AddVersion(defaultMongoDbVersion("4.4.0")).
+		AddVersion(defaultMongoDbVersion("4.2.0")).
+		AddVersion(defaultMongoDbVersion("4.4.0")).
+		AddVersion(arm64).
+		Build()
+	assert.NoError(t, err)
+
+	assert.Len(t, ac.Versions, 2)
+	assert.Equal(t, "4.4.0", ac.Versions[0].Name)
+	assert.Equal(t, "4.2.0", ac.Versions[1].Name)
+	assert.Len(t, ac.Versions[0].Builds, 2, "the exact duplicate build should be removed")
+	assert.Equal(t, "amd64", ac.Versions[0].Builds[0].Architecture)
+	assert.Equal(t, "arm64", ac.Versions[0].Builds[1].Architecture)
+	assert.Equal(t, 2, logs.FilterMessageSnippet("4.4.0").Len())
+
+	core, logs = observer.New(zap.InfoLevel)
+	ac, err = newBuilder(zap.New(core).Sugar()).AddVersion(defaultMongoDbVersion("4.4.0")).Build()
+	assert.NoError(t, err)
+	assert.Len(t, ac.Versions, 1)
+	assert.Equal(t, 0, logs.Len())
+}
+
+func TestJavascriptEnabled(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").SetJavascriptEnabled(false).Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, false, p.Args26.Get("security.javascriptEnabled").Data())
+	}
+
+	ac, err = newTestBuilder("4.4.0").SetJavascriptEnabled(true).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, true, ac.Processes[0].Args26.Get("security.javascriptEnabled").Data())
+
+	ac, err = newTestBuilder("4.4.0").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.Processes[0].Args26.Get("security").Data(), "the MongoDB default should be kept")
+}
+
+func TestBuildWithTLSClusterCAFile(t *testing.T) {
+	newBuilder := func(version string) *Builder {
+		return newTestBuilder(version).
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			SetTLSClusterCAFile("/tls/cluster-ca.crt")
+	}
+
+	t.Run("Requires x509 cluster authentication", func(t *testing.T) {
+		_, err := newBuilder("4.4.0").Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Requires TLS", func(t *testing.T) {
+		_, err := newBuilder("4.4.0").SetClusterAuthMode(ClusterAuthModeX509).SetTLS(TLSModeDisabled, "", "").Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Sets the cluster CA file on every process", func(t *testing.T) {
+		ac, err := newBuilder("4.4.0").SetClusterAuthMode(ClusterAuthModeX509).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, "/tls/cluster-ca.crt", p.Args26.Get("net.tls.clusterCAFile").Data())
+			assert.Equal(t, "/tls/ca.crt", p.Args26.Get("net.tls.CAFile").Data())
+		}
+
+		ac, err = newBuilder("4.0.0").SetClusterAuthMode(ClusterAuthModeX509).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "/tls/cluster-ca.crt", ac.Processes[0].Args26.Get("net.ssl.clusterCAFile").Data())
+	})
+
+	t.Run("Is only set when configured", func(t *testing.T) {
+		ac, err := newBuilder("4.4.0").SetTLSClusterCAFile("").Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.Processes[0].Args26.Get("net.tls.clusterCAFile").Data())
+	})
+}
+
+func TestMemberOrderIsKept(t *testing.T) {
+	newBuilder := func(members int) *Builder {
+		return newTestBuilder("4.4.0").
+			SetMembers(members)
+	}
+	hostsAndIds := func(rs ReplicaSet) ([]string, []int) {
+		hosts, ids := []string{}, []int{}
+		for _, m := range rs.Members {
+			hosts = append(hosts, m.Host)
+			ids = append(ids, m.Id)
+		}
+		return hosts, ids
+	}
+
+	t.Run("Added members are appended", func(t *testing.T) {
+		previous, err := newBuilder(3).Build()
+		assert.NoError(t, err)
+
+		ac, err := newBuilder(4).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+		hosts, ids := hostsAndIds(ac.ReplicaSets[0])
+		assert.Equal(t, []string{"my-rs-0", "my-rs-1", "my-rs-2", "my-rs-3"}, hosts)
+		assert.Equal(t, []int{0, 1, 2, 3}, ids)
+	})
+
+	t.Run("Existing members keep their positions and ids", func(t *testing.T) {
+		previous, err := newBuilder(3).AddReplicaSetMutator(func(rs *ReplicaSet) {
+			rs.Members[0], rs.Members[2] = rs.Members[2], rs.Members[0]
+		}).Build()
+		assert.NoError(t, err)
+
+		ac, err := newBuilder(4).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+		hosts, ids := hostsAndIds(ac.ReplicaSets[0])
+		assert.Equal(t, []string{"my-rs-2", "my-rs-1", "my-rs-0", "my-rs-3"}, hosts)
+		assert.Equal(t, []int{2, 1, 0, 3}, ids)
+
+		ac, err = newBuilder(2).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+		hosts, ids = hostsAndIds(ac.ReplicaSets[0])
+		assert.Equal(t, []string{"my-rs-1", "my-rs-0"}, hosts)
+		assert.Equal(t, []int{1, 0}, ids)
+	})
+}
+
+func TestFCVAutoBumpOnFreshInstall(t *testing.T) {
+	newBuilder := func(version string) *Builder {
+		return newTestBuilder(version).
+			SetFCVAutoBumpOnFreshInstall(true)
+	}
+
+	t.Run("Fresh installs use the version of the binary", func(t *testing.T) {
+		ac, err := newBuilder("4.4.2").Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, "4.4", p.FeatureCompatibilityVersion)
+		}
+	})
+
+	t.Run("The configured FCV takes precedence", func(t *testing.T) {
+		ac, err := newBuilder("4.4.2").SetFCV("4.2").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "4.2", ac.Processes[0].FeatureCompatibilityVersion)
+	})
+
+	t.Run("Existing clusters are not bumped", func(t *testing.T) {
+		previous, err := newTestBuilder("4.2.0").
+			SetFCV("4.2").
+			Build()
+		assert.NoError(t, err)
+
+		ac, err := newBuilder("4.4.2").SetFCV("4.2").SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "4.2", ac.Processes[0].FeatureCompatibilityVersion)
+
+		ac, err = newBuilder("4.4.2").SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+		assert.NotEqual(t, "4.4", ac.Processes[0].FeatureCompatibilityVersion)
+	})
+
+	t.Run("Fresh installs are not bumped by default", func(t *testing.T) {
+		ac, err := newBuilder("4.4.2").SetFCVAutoBumpOnFreshInstall(false).Build()
+		assert.NoError(t, err)
+		assert.NotEqual(t, "4.4", ac.Processes[0].FeatureCompatibilityVersion)
+	})
+}
+
+func TestTLSAllowConnectionsWithoutCertificatesPerProcessType(t *testing.T) {
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			AddProcessMutator(func(idx int, p *Process) {
+				if idx == 0 {
+					p.ProcessType = Mongos
+					delete(p.Args26, "storage")
+					delete(p.Args26, "replication")
+				}
+			})
+	}
+	allows := func(ac AutomationConfig, processType ProcessType) []interface{} {
+		values := []interface{}{}
+		for _, p := range ac.Processes {
+			if p.ProcessType == processType {
+				values = append(values, p.Args26.Get("net.tls.allowConnectionsWithoutCertificates").Data())
+			}
+		}
+		return values
+	}
+
+	t.Run("Connections without certificates are allowed by default", func(t *testing.T) {
+		ac, err := newBuilder().Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{true, true}, allows(ac, Mongod))
+		assert.Equal(t, []interface{}{true}, allows(ac, Mongos))
+	})
+
+	t.Run("The setting is applied per process type", func(t *testing.T) {
+		ac, err := newBuilder().SetTLSAllowConnectionsWithoutCertificates(Mongod, false).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{false, false}, allows(ac, Mongod))
+		assert.Equal(t, []interface{}{true}, allows(ac, Mongos))
+
+		ac, err = newBuilder().SetTLSAllowConnectionsWithoutCertificates(Mongos, false).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{true, true}, allows(ac, Mongod))
+		assert.Equal(t, []interface{}{false}, allows(ac, Mongos))
+	})
+
+	t.Run("Requires TLS and a valid process type", func(t *testing.T) {
+		_, err := newBuilder().SetTLS(TLSModeDisabled, "", "").SetTLSAllowConnectionsWithoutCertificates(Mongos, false).Build()
+		assert.Error(t, err)
+
+		_, err = newBuilder().SetTLSAllowConnectionsWithoutCertificates("mongoX", false).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestLocalPingThresholdMs(t *testing.T) {
+	addMongos := func(config *AutomationConfig) {
+		mongos := newProcess("my-mongos-0", "my-mongos-0.my-ns.svc.cluster.local", "4.4.0", "")
+		mongos.ProcessType = Mongos
+		delete(mongos.Args26, "storage")
+		delete(mongos.Args26, "replication")
+		config.Processes = append(config.Processes, mongos)
+	}
+
+	ac, err := newTestBuilder("4.4.0").AddModifications(addMongos).SetLocalPingThresholdMs(5).Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		if p.ProcessType == Mongos {
+			assert.Equal(t, 5, p.Args26.Get("replication.localPingThresholdMs").Data())
+		} else {
+			assert.Nil(t, p.Args26.Get("replication.localPingThresholdMs").Data(), "mongod processes should not be affected")
+		}
+	}
+
+	_, err = newTestBuilder("4.4.0").AddModifications(addMongos).SetLocalPingThresholdMs(0).Build()
+	assert.NoError(t, err)
+
+	_, err = newTestBuilder("4.4.0").AddModifications(addMongos).SetLocalPingThresholdMs(-1).Build()
+	assert.Error(t, err)
+
+	_, err = newTestBuilder("4.4.0").SetLocalPingThresholdMs(5).Build()
+	assert.Error(t, err, "there needs to be a mongos process")
+}
+
+func TestMongosConnectionPool(t *testing.T) {
+	addMongos := func(config *AutomationConfig) {
+		mongos := newProcess("my-mongos-0", "my-mongos-0.my-ns.svc.cluster.local", "4.4.0", "")
+		mongos.ProcessType = Mongos
+		delete(mongos.Args26, "storage")
+		delete(mongos.Args26, "replication")
+		config.Processes = append(config.Processes, mongos)
+	}
+
+	t.Run("Pool is only set on mongos processes", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").AddModifications(addMongos).SetMongosConnectionPool(4, 100).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			if p.ProcessType == Mongos {
+				assert.Equal(t, 4, p.Args26.Get("setParameter.taskExecutorPoolSize").Data())
+				assert.Equal(t, 100, p.Args26.Get("setParameter.ShardingTaskExecutorPoolMaxSize").Data())
+			} else {
+				assert.Nil(t, p.Args26.Get("setParameter.taskExecutorPoolSize").Data(), "mongod processes should not be affected")
+				assert.Nil(t, p.Args26.Get("setParameter.ShardingTaskExecutorPoolMaxSize").Data(), "mongod processes should not be affected")
+			}
+		}
+	})
+
+	t.Run("Sizes must be positive", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").AddModifications(addMongos).SetMongosConnectionPool(0, 100).Build()
+		assert.Error(t, err)
+		_, err = newTestBuilder("4.4.0").AddModifications(addMongos).SetMongosConnectionPool(4, -1).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Maximum size must be at least the pool size", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").AddModifications(addMongos).SetMongosConnectionPool(4, 2).Build()
+		assert.Error(t, err)
+		_, err = newTestBuilder("4.4.0").AddModifications(addMongos).SetMongosConnectionPool(4, 4).Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("There needs to be a mongos process", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetMongosConnectionPool(4, 100).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestStorageSyncPeriodSecs(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").SetStorageSyncPeriodSecs(30).Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, 30, p.Args26.Get("storage.syncPeriodSecs").Data())
+	}
+
+	ac, err = newTestBuilder("4.4.0").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.Processes[0].Args26.Get("storage.syncPeriodSecs").Data())
+
+	_, err = newTestBuilder("4.4.0").SetStorageSyncPeriodSecs(-1).Build()
+	assert.Error(t, err)
+}
+
+func TestInconsistentTLSAcrossProcesses(t *testing.T) {
+	t.Run("Processes built with the same options are consistent", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").Build()
+		assert.NoError(t, err)
+
+		_, err = newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "").
+			SetTLSCertificateSelector("subject=mongod").
+			Build()
+		assert.NoError(t, err)
+
+		_, err = newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Processes using net.ssl and net.tls are compared by their settings", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			AddProcessMutator(func(idx int, p *Process) {
+				if idx == 2 {
+					p.Version = "4.0.0"
+					delete(p.Args26["net"].(map[string]interface{}), "tls")
+					withTLS(tlsOptions{mode: TLSModeRequired, caFile: "/tls/ca.crt", certAndKeyFile: "/tls/server.pem"})(p)
+				}
+			}).
+			Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Divergent processes are rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			AddProcessMutator(func(idx int, p *Process) {
+				if idx == 1 {
+					delete(p.Args26["net"].(map[string]interface{}), "tls")
+				}
+			}).
+			Build()
+		assert.Equal(t, ErrInconsistentTLSAcrossProcesses, errors.Cause(err))
+		assert.Contains(t, err.Error(), "my-rs-1")
+		assert.NotContains(t, err.Error(), "my-rs-0")
+
+		_, err = newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			AddProcessMutator(func(idx int, p *Process) {
+				if idx == 0 {
+					p.Args26.Set("net.tls.CAFile", "/tls/other-ca.crt")
+				}
+			}).
+			Build()
+		assert.Equal(t, ErrInconsistentTLSAcrossProcesses, errors.Cause(err))
+		assert.Contains(t, err.Error(), "my-rs-0")
+	})
+}
+
+func TestRemoveMemberByHost(t *testing.T) {
+	newBuilder := func(members int) *Builder {
+		return newTestBuilder("4.4.0").
+			SetMembers(members)
+	}
+	hostsAndIds := func(ac AutomationConfig) ([]string, []int) {
+		hosts, ids := []string{}, []int{}
+		for _, m := range ac.ReplicaSets[0].Members {
+			hosts = append(hosts, m.Host)
+			ids = append(ids, m.Id)
+		}
+		return hosts, ids
+	}
+	previous, err := newBuilder(3).Build()
+	assert.NoError(t, err)
+
+	t.Run("The member with the given host is removed", func(t *testing.T) {
+		ac, err := newBuilder(2).SetPreviousAutomationConfig(previous).RemoveMemberByHost("my-rs-1").Build()
+		assert.NoError(t, err)
+		hosts, ids := hostsAndIds(ac)
+		assert.Equal(t, []string{"my-rs-0", "my-rs-2"}, hosts)
+		assert.Equal(t, []int{0, 2}, ids, "the remaining members should keep their ids")
+		assert.Len(t, ac.Processes, 2)
+		assert.Equal(t, "my-rs-2.my-ns.svc.cluster.local", ac.Processes[1].HostName)
+	})
+
+	t.Run("The member can be replaced", func(t *testing.T) {
+		ac, err := newBuilder(3).SetPreviousAutomationConfig(previous).RemoveMemberByHost("my-rs-1").Build()
+		assert.NoError(t, err)
+		hosts, ids := hostsAndIds(ac)
+		assert.Equal(t, []string{"my-rs-0", "my-rs-2", "my-rs-3"}, hosts)
+		assert.Equal(t, []int{0, 2, 1}, ids)
+
+		hostnames, err := newBuilder(3).RemoveMemberByHost("my-rs-1").Hostnames()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"my-rs-0.my-ns.svc.cluster.local", "my-rs-2.my-ns.svc.cluster.local", "my-rs-3.my-ns.svc.cluster.local"}, hostnames)
+	})
+
+	t.Run("Only members of the previous config can be removed", func(t *testing.T) {
+		_, err := newBuilder(2).SetPreviousAutomationConfig(previous).RemoveMemberByHost("my-rs-5").Build()
+		assert.Error(t, err)
+
+		_, err = newBuilder(2).RemoveMemberByHost("my-rs-1").Build()
+		assert.Error(t, err, "there is no previous config")
+	})
+
+	t.Run("A majority of the voting members must be kept", func(t *testing.T) {
+		_, err := newBuilder(3).SetPreviousAutomationConfig(previous).RemoveMemberByHost("my-rs-0").RemoveMemberByHost("my-rs-1").Build()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "at most 1 voting members")
+	})
+
+	t.Run("A data bearing member must be kept", func(t *testing.T) {
+		previous, err := newBuilder(2).AddReplicaSetMutator(func(rs *ReplicaSet) {
+			rs.Members[1].ArbiterOnly = true
+		}).Build()
+		assert.NoError(t, err)
+
+		_, err = newBuilder(2).SetPreviousAutomationConfig(previous).RemoveMemberByHost("my-rs-0").SetAllowMinorityScaleDown(true).Build()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "data bearing")
+	})
+}
+
+func TestAgentDialTimeout(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").SetAgentDialTimeout(30).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, &AgentSettings{DialTimeoutSeconds: 30}, ac.AgentSettings)
+
+	ac, err = newTestBuilder("4.4.0").SetAgentDialTimeout(30).SetAgentSettings(AgentSettings{LogLevel: "DEBUG"}).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, &AgentSettings{LogLevel: "DEBUG", DialTimeoutSeconds: 30}, ac.AgentSettings, "the timeout should be added to the other settings")
+
+	ac, err = newTestBuilder("4.4.0").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.AgentSettings)
+
+	_, err = newTestBuilder("4.4.0").SetAgentDialTimeout(0).Build()
+	assert.Error(t, err)
+
+	_, err = newTestBuilder("4.4.0").SetAgentSettings(AgentSettings{DialTimeoutSeconds: -1}).Build()
+	assert.Error(t, err)
+}
+
+func TestAgentServerTLSCAFile(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		SetAgentServerTLSCAFile("/ops-manager/ca.crt").
+		Build()
+	assert.NoError(t, err)
+	assert.Equal(t, &AgentSettings{ServerTLSCAFilePath: "/ops-manager/ca.crt"}, ac.AgentSettings)
+	assert.Equal(t, "/tls/ca.crt", ac.TLS.CAFilePath, "the CA of the processes should be kept")
+
+	ac, err = newTestBuilder("4.4.0").SetAgentServerTLSCAFile("/ops-manager/ca.crt").Build()
+	assert.NoError(t, err)
+	assert.Equal(t, "/ops-manager/ca.crt", ac.AgentSettings.ServerTLSCAFilePath, "the processes don't need TLS")
+	assert.Empty(t, ac.TLS.CAFilePath)
+
+	ac, err = newTestBuilder("4.4.0").
+		SetAgentServerTLSCAFile("/ops-manager/ca.crt").
+		SetAgentDialTimeout(30).
+		SetAgentSettings(AgentSettings{LogLevel: "DEBUG"}).
+		Build()
+	assert.NoError(t, err)
+	assert.Equal(t, &AgentSettings{LogLevel: "DEBUG", DialTimeoutSeconds: 30, ServerTLSCAFilePath: "/ops-manager/ca.crt"}, ac.AgentSettings)
+
+	_, err = newTestBuilder("4.4.0").SetAgentServerTLSCAFile("ca.crt").Build()
+	assert.Error(t, err)
+}
+
+func TestDiagnosticDataCollection(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").SetDiagnosticDataCollectionEnabled(false).Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, false, p.Args26.Get("setParameter.diagnosticDataCollectionEnabled").Data())
+		assert.Nil(t, p.Args26.Get("setParameter.diagnosticDataCollectionDirectorySizeMB").Data())
+	}
+
+	ac, err = newTestBuilder("4.4.0").SetDiagnosticDataCollectionDirectorySizeMB(400).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, 400, ac.Processes[0].Args26.Get("setParameter.diagnosticDataCollectionDirectorySizeMB").Data())
+	assert.Nil(t, ac.Processes[0].Args26.Get("setParameter.diagnosticDataCollectionEnabled").Data())
+
+	ac, err = newTestBuilder("4.4.0").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.Processes[0].Args26.Get("setParameter").Data())
+
+	_, err = newTestBuilder("4.4.0").SetDiagnosticDataCollectionDirectorySizeMB(-1).Build()
+	assert.Error(t, err)
+
+	_, err = newTestBuilder("4.4.0").SetDiagnosticDataCollectionEnabled(false).SetDiagnosticDataCollectionDirectorySizeMB(400).Build()
+	assert.Error(t, err)
+}
+
+func TestGoalStateAnnotations(t *testing.T) {
+	newBuilder := func(generation string) *Builder {
+		return newTestBuilder("4.4.0").
+			SetGoalStateAnnotations(map[string]string{"generation": generation})
+	}
+
+	first, err := newBuilder("1").Build()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"generation": "1"}, first.Annotations)
+
+	t.Run("Changing the annotations doesn't increase the version", func(t *testing.T) {
+		result, err := newBuilder("2").SetPreviousAutomationConfig(first).BuildWithResult()
+		assert.NoError(t, err)
+		assert.False(t, result.Changed)
+		assert.Equal(t, first.Version, result.Config.Version)
+		assert.Equal(t, map[string]string{"generation": "2"}, result.Config.Annotations)
+
+		firstHash, err := first.Hash()
+		assert.NoError(t, err)
+		hash, err := result.Config.Hash()
+		assert.NoError(t, err)
+		assert.Equal(t, firstHash, hash)
+	})
+
+	t.Run("Changes are reported without the annotations", func(t *testing.T) {
+		result, err := newBuilder("2").SetMembers(4).SetPreviousAutomationConfig(first).BuildWithResult()
+		assert.NoError(t, err)
+		assert.True(t, result.Changed)
+		for _, change := range result.Changes {
+			assert.NotContains(t, change.Path, "annotations")
+		}
+	})
+
+	t.Run("Annotations are omitted when not configured", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.Annotations)
+
+		_, err = newBuilder("1").SetGoalStateAnnotations(map[string]string{"": "1"}).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestSecondaryIndexPrefetch(t *testing.T) {
+	newBuilder := func(version string) *Builder {
+		return newTestBuilder(version).
+			SetSecondaryIndexPrefetch("_id_only")
+	}
+
+	t.Run("Configured before MongoDB 3.2", func(t *testing.T) {
+		ac, err := newBuilder("3.0.15").Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, "_id_only", p.Args26.Get("replication.secondaryIndexPrefetch").Data())
+		}
+	})
+
+	t.Run("Not supported from MongoDB 3.2", func(t *testing.T) {
+		for _, version := range []string{"3.2.0", "4.4.0"} {
+			_, err := newBuilder(version).Build()
+			assert.Equal(t, ErrOptionNotSupported, errors.Cause(err), version)
+		}
+	})
+
+	t.Run("Invalid modes are rejected", func(t *testing.T) {
+		_, err := newBuilder("3.0.15").SetSecondaryIndexPrefetch("some").Build()
+		assert.Error(t, err)
+		assert.NotEqual(t, ErrOptionNotSupported, errors.Cause(err))
+	})
+
+	t.Run("Not configured by default", func(t *testing.T) {
+		ac, err := newBuilder("4.4.0").SetSecondaryIndexPrefetch("").Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.Processes[0].Args26.Get("replication.secondaryIndexPrefetch").Data())
+	})
+}
+
+func TestStrictPreviousConfig(t *testing.T) {
+	previous, err := newTestBuilder("4.4.0").Build()
+	assert.NoError(t, err)
+	previousBytes, err := json.Marshal(previous)
+	assert.NoError(t, err)
+
+	previousMap := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(previousBytes, &previousMap))
+	previousMap["unmodeledSetting"] = true
+	unknownBytes, err := json.Marshal(previousMap)
+	assert.NoError(t, err)
+
+	t.Run("The previous config is parsed", func(t *testing.T) {
+		result, err := newTestBuilder("4.4.0").SetStrictPreviousConfig(true).SetPreviousAutomationConfigBytes(previousBytes).BuildWithResult()
+		assert.NoError(t, err)
+		assert.False(t, result.Changed)
+		assert.Equal(t, previous.Version, result.Config.Version)
+	})
+
+	t.Run("Unknown fields are rejected in strict mode", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetStrictPreviousConfig(true).SetPreviousAutomationConfigBytes(unknownBytes).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown fields are dropped otherwise", func(t *testing.T) {
+		result, err := newTestBuilder("4.4.0").SetPreviousAutomationConfigBytes(unknownBytes).BuildWithResult()
+		assert.NoError(t, err)
+		assert.Equal(t, previous.Version, result.Config.Version)
+	})
+}
+
+func TestHeartbeatInterval(t *testing.T) {
+	newBuilder := func(intervalMillis int) *Builder {
+		return newTestBuilder("4.4.0").
+			SetReplicaSetSettings(ReplicaSetSettings{HeartbeatIntervalMillis: &intervalMillis})
+	}
+
+	ac, err := newBuilder(5000).ApplyWANPreset().Build()
+	assert.NoError(t, err)
+	assert.Equal(t, 5000, *ac.ReplicaSets[0].Settings.HeartbeatIntervalMillis)
+	assert.Equal(t, 20, *ac.ReplicaSets[0].Settings.HeartbeatTimeoutSecs)
+
+	_, err = newBuilder(500).Build()
+	assert.NoError(t, err)
+
+	_, err = newBuilder(499).Build()
+	assert.Error(t, err)
+
+	ac, err = newTestBuilder("4.4.0").
+		ApplyWANPreset().
+		Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.ReplicaSets[0].Settings.HeartbeatIntervalMillis, "the default is not emitted")
+}
+
+func TestWireObjectCheck(t *testing.T) {
+	newBuilder := func(log *zap.SugaredLogger) *Builder {
+		return newTestBuilder("4.4.0").
+			SetLogger(log)
+	}
+
+	t.Run("Disabling it logs a warning", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder(zap.New(core).Sugar()).SetWireObjectCheck(false).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, false, p.Args26.Get("net.wireObjectCheck").Data())
+		}
+		assert.Equal(t, 1, logs.FilterMessageSnippet("wireObjectCheck").Len())
+	})
+
+	t.Run("Enabling it doesn't log a warning", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder(zap.New(core).Sugar()).SetWireObjectCheck(true).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, true, ac.Processes[0].Args26.Get("net.wireObjectCheck").Data())
+		assert.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("The MongoDB default is kept", func(t *testing.T) {
+		ac, err := newBuilder(zap.S()).Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.Processes[0].Args26.Get("net.wireObjectCheck").Data())
+	})
+}
+
+func TestProfilingFilter(t *testing.T) {
+	newBuilder := func(version string, filter string) *Builder {
+		return newTestBuilder(version).
+			SetProfilingFilter(json.RawMessage(filter))
+	}
+
+	t.Run("The filter is configured", func(t *testing.T) {
+		ac, err := newBuilder("4.4.2", `{"ns": "app.orders", "millis": {"$gt": 100}}`).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, "app.orders", p.Args26.Get("operationProfiling.filter.ns").Data())
+			assert.Equal(t, float64(100), p.Args26.Get("operationProfiling.filter.millis.$gt").Data())
+		}
+	})
+
+	t.Run("Requires MongoDB 4.4.2", func(t *testing.T) {
+		_, err := newBuilder("4.4.1", `{"ns": "app.orders"}`).Build()
+		assert.Equal(t, ErrOptionNotSupported, errors.Cause(err))
+	})
+
+	t.Run("The filter must be a JSON object", func(t *testing.T) {
+		for _, filter := range []string{`{"ns": `, `["app.orders"]`, `null`} {
+			_, err := newBuilder("4.4.2", filter).Build()
+			assert.Error(t, err, filter)
+		}
+	})
+}
+
+func TestVersionBuildsAreNormalized(t *testing.T) {
+	newBuilder := func(builds ...BuildConfig) *Builder {
+		return newTestBuilder("4.4.0").
+			AddVersion(MongoDbVersionConfig{Name: "4.4.0", Builds: builds})
+	}
+	ubuntu := BuildConfig{Platform: "linux", Architecture: "amd64", GitVersion: "abc", Flavor: "ubuntu", Url: "ubuntu-url", Modules: []string{"enterprise"}}
+	rhel := BuildConfig{Platform: "linux", Architecture: "amd64", GitVersion: "abc", Flavor: "rhel", Url: "rhel-url", Modules: []string{"enterprise", "debug"}}
+	rhelModulesReordered := rhel
+	rhelModulesReordered.Modules = []string{"debug", "enterprise"}
+	arm := BuildConfig{Platform: "linux", Architecture: "aarch64", GitVersion: "abc", Flavor: "ubuntu", Url: "arm-url", Modules: []string{"enterprise"}}
+
+	first, err := newBuilder(ubuntu, rhel, arm).Build()
+	assert.NoError(t, err)
+	builds := first.Versions[0].Builds
+	assert.Len(t, builds, 3)
+	assert.Equal(t, "aarch64", builds[0].Architecture)
+	assert.Equal(t, "rhel", builds[1].Flavor)
+	assert.Equal(t, []string{"debug", "enterprise"}, builds[1].Modules)
+	assert.Equal(t, "ubuntu", builds[2].Flavor)
+	assert.Equal(t, []string{"enterprise", "debug"}, rhel.Modules, "the configured builds are not modified")
+
+	result, err := newBuilder(arm, rhelModulesReordered, ubuntu, rhel).SetPreviousAutomationConfig(first).BuildWithResult()
+	assert.NoError(t, err)
+	assert.Equal(t, first.Versions, result.Config.Versions)
+	assert.False(t, result.Changed)
+}
+
+func TestAuthMechanisms(t *testing.T) {
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			EnableSCRAM().
+			SetSCRAMAgentCredentials("agent-password", "keyfile-contents")
+	}
+
+	t.Run("The processes are configured with the mechanisms", func(t *testing.T) {
+		ac, err := newBuilder().SetAuthMechanisms("SCRAM-SHA-256", "MONGODB-CR").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"SCRAM-SHA-256", "MONGODB-CR"}, ac.Auth.DeploymentAuthMechanisms)
+		for _, p := range ac.Processes {
+			assert.Equal(t, "SCRAM-SHA-1,SCRAM-SHA-256", p.Args26.Get("setParameter.authenticationMechanisms").Data())
+		}
+	})
+
+	t.Run("The mechanisms replace the ones of the process mutators", func(t *testing.T) {
+		ac, err := newBuilder().
+			SetAuthMechanisms("SCRAM-SHA-256").
+			AddProcessMutator(func(idx int, p *Process) {
+				p.Args26.Set("setParameter.authenticationMechanisms", "SCRAM-SHA-1")
+			}).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "SCRAM-SHA-256", ac.Processes[0].Args26.Get("setParameter.authenticationMechanisms").Data())
+	})
+
+	t.Run("Diverging mechanisms are rejected", func(t *testing.T) {
+		_, err := newBuilder().
+			AddModifications(func(ac *AutomationConfig) {
+				ac.Processes[0].Args26.Set("setParameter.authenticationMechanisms", "SCRAM-SHA-1")
+			}).
+			Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Authentication must be enabled", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").
+			SetAuthMechanisms("SCRAM-SHA-256").
+			Build()
+		assert.Error(t, err)
+
+		_, err = newBuilder().SetAuthMechanisms().Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestIgnoreAgentManagedFieldsInBump(t *testing.T) {
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem")
+	}
+	previous, err := newBuilder().Build()
+	assert.NoError(t, err)
+	rotated := previous
+	rotated.TLS.CAFilePath = "/tls/rotated-ca.crt"
+
+	t.Run("The CA file rewritten by the agent doesn't increase the version", func(t *testing.T) {
+		result, err := newBuilder().SetPreviousAutomationConfig(rotated).BuildWithResult()
+		assert.NoError(t, err)
+		assert.False(t, result.Changed)
+		assert.Equal(t, previous.Version, result.Config.Version)
+		assert.Equal(t, "/tls/ca.crt", result.Config.TLS.CAFilePath)
+	})
+
+	t.Run("No fields are ignored when configured without any", func(t *testing.T) {
+		result, err := newBuilder().SetIgnoreAgentManagedFieldsInBump([]string{}).SetPreviousAutomationConfig(rotated).BuildWithResult()
+		assert.NoError(t, err)
+		assert.True(t, result.Changed)
+		assert.Equal(t, []FieldChange{{Path: "tls.CAFilePath", Old: "/tls/rotated-ca.crt", New: "/tls/ca.crt"}}, result.Changes)
+	})
+
+	t.Run("Fields of every process can be ignored", func(t *testing.T) {
+		result, err := newBuilder().
+			SetIgnoreAgentManagedFieldsInBump([]string{"processes[].args2_6.systemLog"}).
+			AddProcessMutator(func(idx int, p *Process) {
+				p.Args26.Set("systemLog.verbosity", 2)
+			}).
+			SetPreviousAutomationConfig(previous).
+			BuildWithResult()
+		assert.NoError(t, err)
+		assert.False(t, result.Changed)
+		assert.Equal(t, 2, result.Config.Processes[0].Args26.Get("systemLog.verbosity").Data())
+	})
+
+	t.Run("Invalid fields are rejected", func(t *testing.T) {
+		_, err := newBuilder().SetIgnoreAgentManagedFieldsInBump([]string{"tls..CAFilePath"}).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestProcessCluster(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").
+		SetProcessCluster("payments").
+		AddModifications(func(ac *AutomationConfig) {
+			ac.Processes = append(ac.Processes, newProcess("my-mongos-0", "my-mongos-0.my-ns.svc.cluster.local", "4.4.0", ""))
+		}).
+		Build()
+	assert.NoError(t, err)
+	assert.Len(t, ac.Processes, 4)
+	for _, p := range ac.Processes {
+		assert.Equal(t, "payments", p.Cluster)
+	}
+
+	t.Run("Changing the label doesn't increase the version", func(t *testing.T) {
+		previous, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		assert.Empty(t, previous.Processes[0].Cluster)
+
+		result, err := newTestBuilder("4.4.0").SetProcessCluster("payments").SetPreviousAutomationConfig(previous).BuildWithResult()
+		assert.NoError(t, err)
+		assert.False(t, result.Changed)
+		assert.Equal(t, "payments", result.Config.Processes[0].Cluster)
+	})
+
+	t.Run("The label must not be empty", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetProcessCluster("").Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestBlockCompressor(t *testing.T) {
+	newBuilder := func(version string, log *zap.SugaredLogger) *Builder {
+		return newTestBuilder(version).
+			SetLogger(log)
+	}
+
+	t.Run("The compressor is configured", func(t *testing.T) {
+		ac, err := newBuilder("4.2.0", zap.S()).SetBlockCompressor("zstd").Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, "zstd", p.Args26.Get("storage.wiredTiger.collectionConfig.blockCompressor").Data())
+		}
+	})
+
+	t.Run("zstd requires MongoDB 4.2", func(t *testing.T) {
+		_, err := newBuilder("4.0.0", zap.S()).SetBlockCompressor("zstd").Build()
+		assert.Equal(t, ErrOptionNotSupported, errors.Cause(err))
+
+		_, err = newBuilder("4.0.0", zap.S()).SetBlockCompressor("zlib").Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Invalid compressors are rejected", func(t *testing.T) {
+		_, err := newBuilder("4.4.0", zap.S()).SetBlockCompressor("lz4").Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Changing it on an existing deployment logs a warning", func(t *testing.T) {
+		previous, err := newBuilder("4.4.0", zap.S()).Build()
+		assert.NoError(t, err)
+
+		core, logs := observer.New(zap.WarnLevel)
+		_, err = newBuilder("4.4.0", zap.New(core).Sugar()).SetBlockCompressor("zlib").SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, logs.FilterMessageSnippet("blockCompressor").Len())
+
+		core, logs = observer.New(zap.WarnLevel)
+		_, err = newBuilder("4.4.0", zap.New(core).Sugar()).SetBlockCompressor("zlib").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, logs.Len(), "new deployments are not affected")
+	})
+}
+
+func TestIndexPrefixCompression(t *testing.T) {
+	newBuilder := func(log *zap.SugaredLogger) *Builder {
+		return newTestBuilder("4.4.0").
+			SetLogger(log)
+	}
+
+	ac, err := newBuilder(zap.S()).SetIndexPrefixCompression(false).Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, false, p.Args26.Get("storage.wiredTiger.indexConfig.prefixCompression").Data())
+	}
+
+	previous, err := newBuilder(zap.S()).Build()
+	assert.NoError(t, err)
+	assert.Nil(t, previous.Processes[0].Args26.Get("storage.wiredTiger.indexConfig").Data(), "the MongoDB default should be kept")
+
+	core, logs := observer.New(zap.WarnLevel)
+	_, err = newBuilder(zap.New(core).Sugar()).SetIndexPrefixCompression(false).SetPreviousAutomationConfig(previous).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, logs.FilterMessageSnippet("prefixCompression").Len())
+}
+
+func TestMaxVersion(t *testing.T) {
+	newBuilder := func(members int) *Builder {
+		return newTestBuilder("4.4.0").
+			SetMembers(members).
+			SetMaxVersion(2)
+	}
+
+	first, err := newBuilder(3).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, first.Version)
+
+	second, err := newBuilder(4).SetPreviousAutomationConfig(first).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, second.Version)
+
+	t.Run("The version can't be increased beyond the ceiling", func(t *testing.T) {
+		_, err := newBuilder(5).SetPreviousAutomationConfig(second).Build()
+		assert.Equal(t, ErrVersionCeilingReached, errors.Cause(err))
+	})
+
+	t.Run("Unchanged configs can still be built", func(t *testing.T) {
+		ac, err := newBuilder(4).SetPreviousAutomationConfig(second).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, ac.Version)
+	})
+
+	t.Run("The ceiling doesn't apply without a version change", func(t *testing.T) {
+		ac, err := newBuilder(5).SetPreviousAutomationConfig(second).BuildNoVersionChange()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, ac.Version)
+		assert.Len(t, ac.Processes, 5, "the changes should be applied")
+	})
+
+	t.Run("The ceiling must not be negative", func(t *testing.T) {
+		_, err := newBuilder(3).SetMaxVersion(-1).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestReplicaSetMemberLimits(t *testing.T) {
+	// the members after the given number of voting members are non-voting
+	newBuilder := func(members, voting int) *Builder {
+		zero := 0
+		specs := make([]MemberSpec, members)
+		for i := voting; i < members; i++ {
+			specs[i] = MemberSpec{Votes: &zero, Priority: &zero}
+		}
+		return NewBuilder().
+			SetName("my-rs").
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion("4.4.0").
+			SetMembersSpec(specs)
+	}
+
+	t.Run("At most 50 members are allowed", func(t *testing.T) {
+		ac, err := newBuilder(50, 7).Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.ReplicaSets[0].Members, 50)
+
+		_, err = newBuilder(51, 7).Build()
+		assert.EqualError(t, err, "replica set my-rs has 51 members, including arbiters and non-voting members, but MongoDB allows at most 50")
+	})
+
+	t.Run("Arbiters count towards the members", func(t *testing.T) {
+		_, err := newBuilder(50, 7).SetMaxArbiters(1).AddModifications(func(config *AutomationConfig) {
+			arbiter := newProcess("my-rs-arbiter", "my-rs-arbiter.my-ns.svc.cluster.local", "4.4.0", "my-rs")
+			config.Processes = append(config.Processes, arbiter)
+			config.ReplicaSets[0].Members = append(config.ReplicaSets[0].Members, ReplicaSetMember{
+				Id: 100, Host: arbiter.Name, ArbiterOnly: true,
+			})
+		}).Build()
+		assert.EqualError(t, err, "replica set my-rs has 51 members, including arbiters and non-voting members, but MongoDB allows at most 50")
+	})
+
+	t.Run("At most 7 voting members are allowed", func(t *testing.T) {
+		_, err := newBuilder(7, 7).Build()
+		assert.NoError(t, err)
+
+		_, err = newBuilder(8, 8).Build()
+		assert.EqualError(t, err, "replica set my-rs has 8 voting members, but MongoDB allows at most 7. Make the other members non-voting")
+	})
+}
+
+func TestMembersSpec(t *testing.T) {
+	newBuilder := func() *Builder {
+		return NewBuilder().
+			SetName("my-rs").
+			SetDomain("my-ns.svc.cluster.local").
+			SetMongoDBVersion("4.4.0")
+	}
+	zero, two, seven := 0, 2, 7
+	noIndexes := false
+	specs := []MemberSpec{
+		{Priority: &two, Tags: map[string]string{"region": "us-east-1"}, HostName: "db0.example.com"},
+		{Id: &seven},
+		{ArbiterOnly: true},
+		{Hidden: true, Priority: &zero, Votes: &zero, SecondaryDelaySecs: 3600, BuildIndexes: &noIndexes},
+	}
+
+	t.Run("All members are configured", func(t *testing.T) {
+		ac, err := newBuilder().SetMembersSpec(specs).Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.Processes, 4)
+		assert.Equal(t, "db0.example.com", ac.Processes[0].HostName)
+		assert.Equal(t, "my-rs-1.my-ns.svc.cluster.local", ac.Processes[1].HostName)
+
+		members := ac.ReplicaSets[0].Members
+		assert.Len(t, members, 4)
+		assert.Equal(t, "my-rs-0", members[0].Host)
+		assert.Equal(t, 2, members[0].Priority)
+		assert.Equal(t, map[string]string{"region": "us-east-1"}, members[0].Tags)
+		assert.Equal(t, 7, members[1].Id)
+		assert.True(t, members[2].ArbiterOnly)
+		assert.Equal(t, 0, members[2].Priority)
+		assert.Equal(t, 1, members[2].Votes)
+		assert.True(t, members[3].Hidden)
+		assert.Equal(t, 0, members[3].Votes)
+		assert.Equal(t, 3600, members[3].SlaveDelay)
+		assert.False(t, *members[3].BuildIndexes)
+	})
+
+	t.Run("The options configured by index are replaced", func(t *testing.T) {
+		ac, err := newBuilder().SetMembers(4).SetMemberSecondaryDelay(1, 60).SetMembersSpec(specs).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, ac.ReplicaSets[0].Members[1].SlaveDelay)
+	})
+
+	t.Run("The number of members must match", func(t *testing.T) {
+		_, err := newBuilder().SetMembers(3).SetMembersSpec(specs).Build()
+		assert.Error(t, err)
+
+		_, err = newBuilder().SetMembersSpec(specs).SetMembers(5).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestMemberTLSCertFile(t *testing.T) {
+	t.Run("Members without their own certificate use the global one", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			SetMemberTLSCertFile(0, "/tls/my-rs-0.pem").
+			SetMemberTLSCertFile(2, "/tls/my-rs-2.pem").
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "/tls/my-rs-0.pem", ac.Processes[0].Args26.Get("net.tls.certificateKeyFile").Data())
+		assert.Equal(t, "/tls/server.pem", ac.Processes[1].Args26.Get("net.tls.certificateKeyFile").Data())
+		assert.Equal(t, "/tls/my-rs-2.pem", ac.Processes[2].Args26.Get("net.tls.certificateKeyFile").Data())
+	})
+
+	t.Run("The global certificate isn't required when every member has its own", func(t *testing.T) {
+		ac, err := newTestBuilder("4.0.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "").
+			SetMemberTLSCertFile(0, "/tls/my-rs-0.pem").
+			SetMemberTLSCertFile(1, "/tls/my-rs-1.pem").
+			SetMemberTLSCertFile(2, "/tls/my-rs-2.pem").
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "/tls/my-rs-1.pem", ac.Processes[1].Args26.Get("net.ssl.PEMKeyFile").Data())
+
+		_, err = newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "").
+			SetMemberTLSCertFile(0, "/tls/my-rs-0.pem").
+			Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid member certificates are rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetMemberTLSCertFile(0, "/tls/my-rs-0.pem").Build()
+		assert.Error(t, err, "TLS must be enabled")
+
+		_, err = newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			SetMemberTLSCertFile(0, "").
+			Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			SetMemberTLSCertFile(3, "/tls/my-rs-3.pem").
+			Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestTLSCertificateKeyFilePassword(t *testing.T) {
+	newBuilder := func(version string) *Builder {
+		return newTestBuilder(version).
+			SetTLSCertificateKeyFilePassword("/var/lib/tls/password")
+	}
+
+	ac, err := newBuilder("4.4.0").SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, "/var/lib/tls/password", p.Args26.Get("net.tls.certificateKeyFilePassword").Data())
+	}
+
+	ac, err = newBuilder("4.0.0").SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").Build()
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/lib/tls/password", ac.Processes[0].Args26.Get("net.ssl.PEMKeyPassword").Data())
+
+	_, err = newBuilder("4.4.0").Build()
+	assert.Error(t, err, "TLS must be enabled")
+
+	_, err = newBuilder("4.4.0").
+		SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+		SetTLSCertificateKeyFilePassword("").
+		Build()
+	assert.Error(t, err)
+}
+
+func TestProcessCPUAffinity(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").SetProcessCPUAffinity(1, "0-3,8").Build()
+	assert.NoError(t, err)
+	assert.Empty(t, ac.Processes[0].CPUAffinity)
+	assert.Equal(t, "0-3,8", ac.Processes[1].CPUAffinity)
+
+	t.Run("Changing the hint doesn't increase the version", func(t *testing.T) {
+		previous, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+
+		result, err := newTestBuilder("4.4.0").SetProcessCPUAffinity(0, "4-7").SetPreviousAutomationConfig(previous).BuildWithResult()
+		assert.NoError(t, err)
+		assert.False(t, result.Changed)
+		assert.Equal(t, "4-7", result.Config.Processes[0].CPUAffinity)
+	})
+
+	t.Run("Invalid CPU lists are rejected", func(t *testing.T) {
+		for _, cpus := range []string{"", "0-", "a", "0,,1", "3-1", "0-3 8"} {
+			_, err := newTestBuilder("4.4.0").SetProcessCPUAffinity(0, cpus).Build()
+			assert.Error(t, err, cpus)
+		}
+	})
+
+	t.Run("The process must exist", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetProcessCPUAffinity(3, "0").Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestMultiClusterMode(t *testing.T) {
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			SetMultiClusterMode(true).
+			SetMemberCluster(0, "cluster-a").
+			SetMemberCluster(1, "cluster-b").
+			SetMemberCluster(2, "cluster-c")
+	}
+
+	t.Run("Members record their cluster", func(t *testing.T) {
+		ac, err := newBuilder().Build()
+		assert.NoError(t, err)
+		assert.True(t, ac.Options.MultiClusterMode)
+		for i, cluster := range []string{"cluster-a", "cluster-b", "cluster-c"} {
+			assert.Equal(t, cluster, ac.ReplicaSets[0].Members[i].ClusterName)
+		}
+	})
+
+	t.Run("Moving a member doesn't increase the version", func(t *testing.T) {
+		previous, err := newBuilder().Build()
+		assert.NoError(t, err)
+
+		result, err := newBuilder().SetMemberCluster(2, "cluster-a").SetPreviousAutomationConfig(previous).BuildWithResult()
+		assert.NoError(t, err)
+		assert.False(t, result.Changed)
+		assert.Equal(t, "cluster-a", result.Config.ReplicaSets[0].Members[2].ClusterName)
+	})
+
+	t.Run("Enabling multi-cluster mode increases the version", func(t *testing.T) {
+		previous, err := newTestBuilder("4.4.0").
+			Build()
+		assert.NoError(t, err)
+
+		result, err := newBuilder().SetPreviousAutomationConfig(previous).BuildWithResult()
+		assert.NoError(t, err)
+		assert.True(t, result.Changed)
+	})
+
+	t.Run("Every member needs a cluster", func(t *testing.T) {
+		_, err := newBuilder().SetMembers(4).Build()
+		assert.EqualError(t, err, "member 3 of replica set my-rs has no cluster, but every member needs one in multi-cluster mode")
+		_, err = newBuilder().SetMemberCluster(1, "").Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("The member must exist", func(t *testing.T) {
+		_, err := newBuilder().SetMemberCluster(3, "cluster-d").Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Clusters require multi-cluster mode", func(t *testing.T) {
+		_, err := newBuilder().SetMultiClusterMode(false).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestEnableMajorityReadConcern(t *testing.T) {
+	newBuilder := func(version string, log *zap.SugaredLogger) *Builder {
+		return newTestBuilder(version).
+			SetLogger(log)
+	}
+
+	t.Run("Disabling it logs a warning", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder("4.4.0", zap.New(core).Sugar()).SetEnableMajorityReadConcern(false).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, false, p.Args26.Get("replication.enableMajorityReadConcern").Data())
+		}
+		assert.Equal(t, 1, logs.FilterMessageSnippet("change streams and multi-document transactions").Len())
+	})
+
+	t.Run("Enabling it doesn't log a warning", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder("4.4.0", zap.New(core).Sugar()).SetEnableMajorityReadConcern(true).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, true, ac.Processes[0].Args26.Get("replication.enableMajorityReadConcern").Data())
+		assert.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("A default read concern requiring it is rejected", func(t *testing.T) {
+		for _, level := range []string{"majority", "linearizable"} {
+			_, err := newBuilder("4.4.0", zap.S()).
+				SetEnableMajorityReadConcern(false).
+				SetDefaultRWConcern(DefaultRWConcern{DefaultReadConcern: &ReadConcern{Level: level}}).
+				Build()
+			assert.Error(t, err, level)
+		}
+
+		_, err := newBuilder("4.4.0", zap.S()).
+			SetEnableMajorityReadConcern(false).
+			SetDefaultRWConcern(DefaultRWConcern{DefaultReadConcern: &ReadConcern{Level: "local"}}).
+			Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("It can't be disabled from MongoDB 5.0", func(t *testing.T) {
+		_, err := newBuilder("5.0.0", zap.S()).SetEnableMajorityReadConcern(false).Build()
+		assert.Equal(t, ErrOptionNotSupported, errors.Cause(err))
+
+		_, err = newBuilder("5.0.0", zap.S()).SetEnableMajorityReadConcern(true).Build()
+		assert.NoError(t, err)
+	})
+}
+
+func TestDowngradeFCV(t *testing.T) {
+	newBuilder := func(version, fcv string) *Builder {
+		return newTestBuilder(version).
+			SetFCV(fcv).
+			SetMembers(3)
+	}
+	previous, err := newBuilder("4.4.0", "4.4").Build()
+	assert.NoError(t, err)
+
+	t.Run("Binaries can't be downgraded before the FCV", func(t *testing.T) {
+		_, err := newBuilder("4.2.0", "4.2").SetPreviousAutomationConfig(previous).Build()
+		assert.Equal(t, ErrDowngradeFCVNotLowered, errors.Cause(err))
+	})
+
+	t.Run("Binaries can be downgraded once the FCV was lowered", func(t *testing.T) {
+		lowered, err := newBuilder("4.4.0", "4.2").SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+
+		ac, err := newBuilder("4.2.0", "4.2").SetPreviousAutomationConfig(lowered).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "4.2.0", ac.Processes[0].Version)
+	})
+
+	t.Run("Patch downgrades don't depend on the FCV", func(t *testing.T) {
+		patched, err := newBuilder("4.4.2", "4.4").Build()
+		assert.NoError(t, err)
+
+		_, err = newBuilder("4.4.0", "4.4").SetPreviousAutomationConfig(patched).Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Upgrades are not affected", func(t *testing.T) {
+		_, err := newBuilder("5.0.0", "4.4").SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("It can be overridden", func(t *testing.T) {
+		_, err := newBuilder("4.2.0", "4.2").SetAllowUnsafeDowngrade(true).SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+	})
+}
+
+func TestEnableChangeStreams(t *testing.T) {
+	t.Run("The majority read concern is enabled", func(t *testing.T) {
+		for _, version := range []string{"3.6.0", "4.0.0", "4.4.0", "5.0.0"} {
+			ac, err := newTestBuilder(version).EnableChangeStreams().Build()
+			assert.NoError(t, err, version)
+			for _, p := range ac.Processes {
+				assert.Equal(t, true, p.Args26.Get("replication.enableMajorityReadConcern").Data(), version)
+			}
+		}
+	})
+
+	t.Run("Versions before 3.6 are rejected", func(t *testing.T) {
+		_, err := newTestBuilder("3.4.0").EnableChangeStreams().Build()
+		assert.Equal(t, ErrOptionNotSupported, errors.Cause(err))
+	})
+
+	t.Run("The featureCompatibilityVersion must be at least 3.6", func(t *testing.T) {
+		_, err := newTestBuilder("3.6.0").SetFCV("3.4").EnableChangeStreams().Build()
+		assert.Error(t, err)
+		_, err = newTestBuilder("4.0.0").SetFCV("3.6").EnableChangeStreams().Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Disabling the majority read concern conflicts", func(t *testing.T) {
+		_, err := newTestBuilder("4.0.0").SetEnableMajorityReadConcern(false).EnableChangeStreams().Build()
+		assert.EqualError(t, err, "change streams require the majority read concern, but it is disabled")
+
+		_, err = newTestBuilder("4.0.0").EnableChangeStreams().AddModifications(func(config *AutomationConfig) {
+			config.Processes[1].Args26.Set("replication.enableMajorityReadConcern", false)
+		}).Build()
+		assert.EqualError(t, err, "change streams require the majority read concern, but it is disabled for process my-rs-1")
+	})
+
+	t.Run("MMAPv1 is rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.0.0").EnableChangeStreams().AddModifications(func(config *AutomationConfig) {
+			config.Processes[0].Args26.Set("storage.engine", "mmapv1")
+		}).Build()
+		assert.EqualError(t, err, "change streams don't support the MMAPv1 storage engine, which process my-rs-0 uses")
+	})
+}
+
+func TestContainerMode(t *testing.T) {
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			SetContainerMode(true)
+	}
+
+	t.Run("The default paths are on the default mount points", func(t *testing.T) {
+		_, err := newBuilder().Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Paths outside the mount points are rejected", func(t *testing.T) {
+		modifications := map[string]Modification{
+			"download base": func(ac *AutomationConfig) { ac.Options.DownloadBase = "/opt/mongodb" },
+			"dbPath":        func(ac *AutomationConfig) { ac.Processes[1].Args26.Set("storage.dbPath", "/tmp/data") },
+			"log path":      func(ac *AutomationConfig) { ac.Processes[2].SystemLog.Path = "/var/log/mongodb.log" },
+			"mount prefix":  func(ac *AutomationConfig) { ac.Processes[0].Args26.Set("storage.dbPath", "/database") },
+		}
+		for name, modification := range modifications {
+			_, err := newBuilder().AddModifications(modification).Build()
+			assert.Error(t, err, name)
+
+			_, err = newBuilder().SetContainerMode(false).AddModifications(modification).Build()
+			assert.NoError(t, err, name)
+		}
+	})
+
+	t.Run("Processes can't fork", func(t *testing.T) {
+		_, err := newBuilder().
+			SetKubernetesMode(false).
+			SetProcessManagement(ProcessManagementConfig{Fork: true}).
+			Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("The mount points can be configured", func(t *testing.T) {
+		_, err := newBuilder().
+			SetContainerMountPoints("/data", "/var/log/mongodb-mms-automation", "/opt").
+			AddModifications(func(ac *AutomationConfig) { ac.Options.DownloadBase = "/opt/mongodb" }).
+			Build()
+		assert.NoError(t, err)
+
+		_, err = newBuilder().SetContainerMountPoints("/data").Build()
+		assert.Error(t, err, "the logs and the download base aren't on a mount point")
+
+		_, err = newBuilder().SetContainerMountPoints("data").Build()
+		assert.Error(t, err, "mount points must be absolute")
+	})
+}
+
+func TestTTLMonitor(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").SetTTLMonitor(false, 120).Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, false, p.Args26.Get("setParameter.ttlMonitorEnabled").Data())
+		assert.Equal(t, 120, p.Args26.Get("setParameter.ttlMonitorSleepSecs").Data())
+	}
+
+	ac, err = newTestBuilder("4.4.0").Build()
+	assert.NoError(t, err)
+	assert.Nil(t, ac.Processes[0].Args26.Get("setParameter.ttlMonitorEnabled").Data())
+
+	for _, sleepSecs := range []int{0, -1} {
+		_, err = newTestBuilder("4.4.0").SetTTLMonitor(true, sleepSecs).Build()
+		assert.Error(t, err, sleepSecs)
+	}
+}
+
+func TestComponentVerbosity(t *testing.T) {
+	t.Run("Verbosity is set per component", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").SetComponentVerbosity(map[string]int{"query": 2, "replication": 1, "replication.election": 5}).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, 2, p.Args26.Get("systemLog.component.query.verbosity").Data())
+			assert.Equal(t, 1, p.Args26.Get("systemLog.component.replication.verbosity").Data())
+			assert.Equal(t, 5, p.Args26.Get("systemLog.component.replication.election.verbosity").Data())
+		}
+		assert.NoError(t, newTestBuilder("4.4.0").SetComponentVerbosity(map[string]int{"storage.journal": 0}).ValidateAgainstVersionSchema())
+	})
+
+	t.Run("Nothing is set by default", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		assert.Nil(t, ac.Processes[0].Args26.Get("systemLog").Data())
+	})
+
+	t.Run("Levels must be between 0 and 5", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetComponentVerbosity(map[string]int{"query": 6}).Build()
+		assert.EqualError(t, err, "the log verbosity of component query must be between 0 and 5, but got 6")
+		_, err = newTestBuilder("4.4.0").SetComponentVerbosity(map[string]int{"query": -1}).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Components must be known", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetComponentVerbosity(map[string]int{"queries": 2}).Build()
+		assert.EqualError(t, err, `unknown log component "queries"`)
+	})
+}
+
+func TestJournalCompressor(t *testing.T) {
+	ac, err := newTestBuilder("4.4.0").SetJournalCompressor("zstd").Build()
+	assert.NoError(t, err)
+	for _, p := range ac.Processes {
+		assert.Equal(t, "zstd", p.Args26.Get("storage.wiredTiger.engineConfig.journalCompressor").Data())
+	}
+
+	t.Run("Invalid compressors are rejected", func(t *testing.T) {
+		_, err := newTestBuilder("4.4.0").SetJournalCompressor("lz4").Build()
+		assert.Error(t, err)
+
+		_, err = newTestBuilder("4.0.0").SetJournalCompressor("zstd").Build()
+		assert.Equal(t, ErrOptionNotSupported, errors.Cause(err))
+	})
+
+	t.Run("The compressor of existing processes can't be changed", func(t *testing.T) {
+		previous, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+
+		_, err = newTestBuilder("4.4.0").SetJournalCompressor("snappy").SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err, "snappy is the default")
+
+		_, err = newTestBuilder("4.4.0").SetJournalCompressor("zlib").SetPreviousAutomationConfig(previous).Build()
+		assert.Equal(t, ErrJournalCompressorChangeNotAllowed, errors.Cause(err))
+
+		_, err = newTestBuilder("4.4.0").
+			SetJournalCompressor("zlib").
+			SetAllowJournalCompressorChange(true).
+			SetPreviousAutomationConfig(previous).
+			Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("New processes can use another compressor", func(t *testing.T) {
+		previous, err := newTestBuilder("4.4.0").Build()
+		assert.NoError(t, err)
+		previous.Processes = previous.Processes[:0]
+
+		_, err = newTestBuilder("4.4.0").SetJournalCompressor("zlib").SetPreviousAutomationConfig(previous).Build()
+		assert.NoError(t, err)
+	})
+}
+
+func TestWiredTigerCacheTuning(t *testing.T) {
+	t.Run("The cache overflow file is limited on 4.0 and 4.2", func(t *testing.T) {
+		for _, version := range []string{"4.0.10", "4.2.8"} {
+			ac, err := newTestBuilder(version).SetMaxCacheOverflowFileSizeGB(2.5).Build()
+			assert.NoError(t, err)
+			for _, p := range ac.Processes {
+				assert.Equal(t, 2.5, p.Args26.Get("storage.wiredTiger.engineConfig.maxCacheOverflowFileSizeGB").Data())
+			}
+		}
+
+		for _, version := range []string{"3.6.0", "4.4.0"} {
+			_, err := newTestBuilder(version).SetMaxCacheOverflowFileSizeGB(2.5).Build()
+			assert.Equal(t, ErrOptionNotSupported, errors.Cause(err))
+		}
+
+		_, err := newTestBuilder("4.2.8").SetMaxCacheOverflowFileSizeGB(-1).Build()
+		assert.Error(t, err)
+
+		report, err := newTestBuilder("4.2.8").SetMaxCacheOverflowFileSizeGB(2.5).UpgradeCompatibilityReport("4.4.0")
+		assert.NoError(t, err)
+		assert.Contains(t, report.Invalid, "storage.wiredTiger.engineConfig.maxCacheOverflowFileSizeGB")
+
+		assert.NoError(t, newTestBuilder("4.2.8").SetMaxCacheOverflowFileSizeGB(2.5).ValidateAgainstVersionSchema())
+	})
+
+	t.Run("The eviction is tuned through the runtime config", func(t *testing.T) {
+		ac, err := newTestBuilder("4.4.0").SetWiredTigerEviction(WiredTigerEviction{
+			ThreadsMin:   4,
+			ThreadsMax:   8,
+			Target:       80,
+			Trigger:      95,
+			DirtyTrigger: 20,
+		}).Build()
+		assert.NoError(t, err)
+		for _, p := range ac.Processes {
+			assert.Equal(t, "eviction=(threads_min=4,threads_max=8),eviction_target=80,eviction_trigger=95,eviction_dirty_trigger=20",
+				p.Args26.Get("setParameter.wiredTigerEngineRuntimeConfig").Data())
+		}
+	})
+
+	t.Run("Invalid eviction settings are rejected", func(t *testing.T) {
+		for _, eviction := range []WiredTigerEviction{
+			{},
+			{ThreadsMin: 21},
+			{ThreadsMin: 8, ThreadsMax: 4},
+			{Target: 100},
+			{Target: 95, Trigger: 80},
+			{DirtyTarget: 20, DirtyTrigger: 20},
+		} {
+			_, err := newTestBuilder("4.4.0").SetWiredTigerEviction(eviction).Build()
+			assert.Error(t, err, "%+v", eviction)
+		}
+	})
+}
+
+func TestBuildIsDeterministic(t *testing.T) {
+	// the options backed by maps are the ones which could make the output depend on the iteration order
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			SetMembers(5).
+			ConfigureRegionTags(map[int]string{0: "us-east-1", 1: "us-east-1", 2: "eu-west-1", 3: "eu-west-1", 4: "ap-south-1"}).
+			SetWriteConcernModes(map[string]map[string]int{"multiRegion": {"region": 2}, "allRegions": {"region": 3}}).
+			SetGoalStateAnnotations(map[string]string{"generation": "3", "owner": "my-operator", "revision": "abc"}).
+			SetAgentStartupArgs(map[string]interface{}{"logLevel": "INFO", "maxLogFiles": 5}).
+			SetProcessCPUAffinity(0, "0-1").
+			SetProcessCPUAffinity(3, "2-3").
+			SetMemberSecondaryDelay(4, 3600).
+			SetAutoCorrectDelayedMembers(true).
+			EnableSCRAM(MongoDBUser{Username: "my-user", Database: "admin", Roles: []Role{{Role: "readWrite", Database: "my-db"}}}).
+			AddReadOnlyUser("my-reader", "admin", []string{"my-db", "other-db"}).
+			SetSCRAMAgentCredentials("my-password", "my-keyfile")
+	}
+
+	first, err := newBuilder().Build()
+	assert.NoError(t, err)
+	expected, err := json.Marshal(first)
+	assert.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		ac, err := newBuilder().Build()
+		assert.NoError(t, err)
+		actual, err := json.Marshal(ac)
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), string(actual), "identical Builders should build identical bytes")
+	}
+}
@@ -0,0 +1,104 @@
+package automationconfig
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const x509Mechanism = "MONGODB-X509"
+
+// dnAttributeTypePattern matches the attribute types of distinguished names, either a name such as CN or an OID.
+var dnAttributeTypePattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9-]*|\d+(\.\d+)*)$`)
+
+// SetAgentX509Subject configures the automation agent to authenticate with the member certificate which has
+// the given subject, e.g. "CN=mms-automation,OU=agents,O=MongoDB". It requires TLS, authentication and cluster
+// authentication mode x509. MONGODB-X509 is added to the deployment auth mechanisms unless they are configured
+// with SetAuthMechanisms, in which case they need to include it.
+func (b *Builder) SetAgentX509Subject(subject string) *Builder {
+	b.agentX509Subject = subject
+	return b
+}
+
+// validateAgentX509Subject ensures the agent can authenticate with its certificate.
+func (b *Builder) validateAgentX509Subject() error {
+	if b.agentX509Subject == "" {
+		return nil
+	}
+	if !b.tls.enabled() {
+		return errors.Errorf("the agent can only authenticate with x509 when TLS is enabled")
+	}
+	if b.clusterAuthMode != ClusterAuthModeX509 {
+		return errors.Errorf("the agent x509 subject requires cluster authentication mode %s, but got %q", ClusterAuthModeX509, b.clusterAuthMode)
+	}
+	if err := validateDistinguishedName(b.agentX509Subject); err != nil {
+		return errors.Wrapf(err, "invalid agent x509 subject")
+	}
+	return nil
+}
+
+// configureAgentX509 makes the agent authenticate as the subject configured with SetAgentX509Subject.
+func (b *Builder) configureAgentX509(ac *AutomationConfig) error {
+	if b.agentX509Subject == "" {
+		return nil
+	}
+	if ac.Auth.Disabled {
+		return errors.Errorf("the agent can only authenticate with x509 when authentication is enabled")
+	}
+	ac.Auth.AutoUser = b.agentX509Subject
+	ac.Auth.AutoAuthMechanism = x509Mechanism
+	ac.Auth.AutoAuthMechanisms = []string{x509Mechanism}
+	ac.Auth.AutoPwd = ""
+	for _, mechanism := range ac.Auth.DeploymentAuthMechanisms {
+		if mechanism == x509Mechanism {
+			return nil
+		}
+	}
+	if b.authMechanisms != nil {
+		return errors.Errorf("the auth mechanisms %s must include %s for the agent to authenticate with x509", strings.Join(b.authMechanisms, ","), x509Mechanism)
+	}
+	ac.Auth.DeploymentAuthMechanisms = append(ac.Auth.DeploymentAuthMechanisms, x509Mechanism)
+	return nil
+}
+
+// validateDistinguishedName checks that the string is an RFC 4514 distinguished name, i.e. attributes such
+// as "CN=agent" separated by commas, or by plus signs within a multi-valued RDN. Special characters in the
+// values must be escaped with a backslash.
+func validateDistinguishedName(dn string) error {
+	var attributes []string
+	var current strings.Builder
+	escaped := false
+	for _, c := range dn {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',' || c == '+':
+			attributes = append(attributes, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(c)
+	}
+	if escaped {
+		return errors.Errorf("%q ends with an incomplete escape", dn)
+	}
+	attributes = append(attributes, current.String())
+
+	for _, attribute := range attributes {
+		parts := strings.SplitN(attribute, "=", 2)
+		if len(parts) != 2 {
+			return errors.Errorf("%q is not an attribute such as CN=agent", strings.TrimSpace(attribute))
+		}
+		attributeType, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !dnAttributeTypePattern.MatchString(attributeType) {
+			return errors.Errorf("invalid attribute type %q", attributeType)
+		}
+		if value == "" {
+			return errors.Errorf("the attribute %s has no value", attributeType)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package automationconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentX509Subject(t *testing.T) {
+	const subject = "CN=mms-automation,OU=agents,O=MongoDB"
+	alice := MongoDBUser{Username: "alice", Database: "admin"}
+	newBuilder := func() *Builder {
+		return newTestBuilder("4.4.0").
+			SetTLS(TLSModeRequired, "/tls/ca.crt", "/tls/server.pem").
+			SetClusterAuthMode(ClusterAuthModeX509)
+	}
+
+	t.Run("The agent authenticates with its certificate", func(t *testing.T) {
+		ac, err := newBuilder().EnableSCRAM(alice).SetAgentX509Subject(subject).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, subject, ac.Auth.AutoUser)
+		assert.Equal(t, "MONGODB-X509", ac.Auth.AutoAuthMechanism)
+		assert.Equal(t, []string{"MONGODB-X509"}, ac.Auth.AutoAuthMechanisms)
+		assert.Equal(t, []string{"SCRAM-SHA-256", "MONGODB-X509"}, ac.Auth.DeploymentAuthMechanisms)
+	})
+
+	t.Run("Configured auth mechanisms must include x509", func(t *testing.T) {
+		_, err := newBuilder().EnableSCRAM(alice).SetAuthMechanisms("SCRAM-SHA-256").SetAgentX509Subject(subject).Build()
+		assert.Error(t, err)
+
+		ac, err := newBuilder().EnableSCRAM(alice).SetAuthMechanisms("SCRAM-SHA-256", "MONGODB-X509").SetAgentX509Subject(subject).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"SCRAM-SHA-256", "MONGODB-X509"}, ac.Auth.DeploymentAuthMechanisms)
+	})
+
+	t.Run("Requires TLS and x509 cluster authentication", func(t *testing.T) {
+		_, err := newBuilder().EnableSCRAM(alice).SetTLS(TLSModeDisabled, "", "").SetAgentX509Subject(subject).Build()
+		assert.Error(t, err)
+
+		_, err = newBuilder().EnableSCRAM(alice).SetClusterAuthMode(ClusterAuthModeKeyFile).SetAgentX509Subject(subject).Build()
+		assert.Error(t, err)
+	})
+
+	t.Run("Requires authentication", func(t *testing.T) {
+		_, err := newBuilder().SetAgentX509Subject(subject).Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestValidateDistinguishedName(t *testing.T) {
+	for _, dn := range []string{
+		"CN=agent",
+		"CN=mms-automation, OU=agents, O=MongoDB",
+		`CN=Doe\, John,O=MongoDB`,
+		"CN=agent+UID=1,O=MongoDB",
+		"2.5.4.3=agent",
+	} {
+		assert.NoError(t, validateDistinguishedName(dn), dn)
+	}
+	for _, dn := range []string{
+		"",
+		"agent",
+		"CN=",
+		"CN=agent,",
+		"=agent",
+		"C N=agent",
+		`CN=agent\`,
+	} {
+		assert.Error(t, validateDistinguishedName(dn), dn)
+	}
+}
@@ -0,0 +1,12 @@
+package automationconfig
+
+import (
+	"github.com/ghodss/yaml"
+)
+
+// MarshalYAML returns the YAML representation of the AutomationConfig. The config is first marshalled
+// to JSON, so the YAML form has exactly the same fields as the one consumed by the agent, and map keys
+// are sorted so that the output is deterministic.
+func MarshalYAML(ac AutomationConfig) ([]byte, error) {
+	return yaml.Marshal(ac)
+}
@@ -0,0 +1,29 @@
+package automationconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalYAML(t *testing.T) {
+	ac, err := newTestBuilder("4.2.0").
+		AddVersion(defaultMongoDbVersion("4.2.0")).
+		Build()
+	assert.NoError(t, err)
+
+	bytes, err := MarshalYAML(ac)
+	assert.NoError(t, err)
+
+	yamlStr := string(bytes)
+	assert.Contains(t, yamlStr, "name: my-rs-0")
+	assert.Contains(t, yamlStr, "processType: mongod")
+	assert.NotContains(t, yamlStr, "horizons", "omitted JSON fields should be omitted in YAML")
+	assert.NotContains(t, yamlStr, "usersWanted")
+
+	for i := 0; i < 10; i++ {
+		other, err := MarshalYAML(ac)
+		assert.NoError(t, err)
+		assert.Equal(t, bytes, other, "the YAML output should be deterministic")
+	}
+}
@@ -0,0 +1,93 @@
+package automationconfig
+
+import "github.com/pkg/errors"
+
+// zoneTag is the tag of the members configured with SetZoneForMember
+const zoneTag = "zone"
+
+const (
+	// highZonePriority is the priority of the preferred member of each zone with BalancePrioritiesByZone
+	highZonePriority = 2
+	// lowZonePriority is the priority of the other electable members of the zone
+	lowZonePriority = 1
+)
+
+// BalancePrioritiesByZone assigns the priorities of the members from the zones configured with SetZoneForMember,
+// so that each zone has at most one member with a high priority: the first electable member of each zone gets
+// priority 2, and the other electable members of the zone priority 1. Members without a zone, members which
+// can't become primary and members with an explicit priority keep their priority, and an explicit priority of
+// 2 or more makes the member the preferred one of its zone.
+func (b *Builder) BalancePrioritiesByZone() *Builder {
+	b.balancePrioritiesByZone = true
+	return b
+}
+
+// balanceZonePriorities sets the priorities of the members, in the order of their index, for BalancePrioritiesByZone.
+func (b *Builder) balanceZonePriorities(members []ReplicaSetMember) error {
+	preferred := map[string]bool{}
+	// members with an explicit high priority are the preferred member of their zone
+	for i, m := range members {
+		if zone, ok := m.Tags[zoneTag]; ok && b.memberOptions[i].priority != nil && m.Priority >= highZonePriority {
+			preferred[zone] = true
+		}
+	}
+	for i := range members {
+		m := &members[i]
+		zone, ok := m.Tags[zoneTag]
+		if !ok || m.Priority == 0 || b.memberOptions[i].priority != nil {
+			continue
+		}
+		if preferred[zone] {
+			m.Priority = lowZonePriority
+			continue
+		}
+		m.Priority = highZonePriority
+		preferred[zone] = true
+	}
+	if len(preferred) == 0 {
+		return errors.Errorf("balancing the priorities of replica set %s by zone requires electable members with a zone", b.name)
+	}
+	return nil
+}
+
+// MemberZones returns the availability zone of each member of the replica set with the given name, keyed by
+// the name of its process, which is the name of its pod. Members without a zone are not included.
+func (ac AutomationConfig) MemberZones(replicaSetName string) map[string]string {
+	zones := map[string]string{}
+	for _, rs := range ac.ReplicaSets {
+		if rs.Id != replicaSetName {
+			continue
+		}
+		for _, m := range rs.Members {
+			if zone, ok := m.Tags[zoneTag]; ok {
+				zones[m.Host] = zone
+			}
+		}
+	}
+	return zones
+}
+
+// warnSingleZone logs a warning when all voting members of a replica set run in the same zone, as losing
+// the zone makes the replica set unavailable. Replica sets with members without a zone are not checked.
+func (b *Builder) warnSingleZone(ac AutomationConfig) {
+	for _, rs := range ac.ReplicaSets {
+		zones := map[string]bool{}
+		voting := 0
+		for _, m := range rs.Members {
+			if m.Votes == 0 {
+				continue
+			}
+			zone, ok := m.Tags[zoneTag]
+			if !ok {
+				return
+			}
+			zones[zone] = true
+			voting++
+		}
+		if voting > 1 && len(zones) == 1 {
+			for zone := range zones {
+				b.log.Warnf("All %d voting members of replica set %s run in zone %s, the replica set is unavailable if the zone fails", voting, rs.Id, zone)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package automationconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestZoneForMember(t *testing.T) {
+	newBuilder := func(log *zap.SugaredLogger) *Builder {
+		return newTestBuilder("4.4.0").
+			SetLogger(log)
+	}
+
+	t.Run("Members are tagged with their zone", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder(zap.New(core).Sugar()).
+			ConfigureRegionTags(map[int]string{0: "us-east-1"}).
+			SetZoneForMember(0, "us-east-1a").
+			SetZoneForMember(1, "us-east-1b").
+			SetZoneForMember(2, "us-east-1c").
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"region": "us-east-1", "zone": "us-east-1a"}, ac.ReplicaSets[0].Members[0].Tags)
+		assert.Equal(t, map[string]string{
+			"my-rs-0": "us-east-1a",
+			"my-rs-1": "us-east-1b",
+			"my-rs-2": "us-east-1c",
+		}, ac.MemberZones("my-rs"))
+		assert.Equal(t, 0, logs.FilterMessageSnippet("zone").Len())
+	})
+
+	t.Run("A warning is logged if all voting members are in the same zone", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		_, err := newBuilder(zap.New(core).Sugar()).
+			SetZoneForMember(0, "us-east-1a").
+			SetZoneForMember(1, "us-east-1a").
+			SetZoneForMember(2, "us-east-1a").
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, logs.FilterMessageSnippet("zone us-east-1a").Len())
+	})
+
+	t.Run("Members without a zone are not checked", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		ac, err := newBuilder(zap.New(core).Sugar()).
+			SetZoneForMember(0, "us-east-1a").
+			SetZoneForMember(1, "us-east-1a").
+			Build()
+		assert.NoError(t, err)
+		assert.Len(t, ac.MemberZones("my-rs"), 2)
+		assert.Equal(t, 0, logs.FilterMessageSnippet("zone").Len())
+	})
+
+	t.Run("The zone must not be empty", func(t *testing.T) {
+		_, err := newBuilder(zap.S()).SetZoneForMember(0, "").Build()
+		assert.Error(t, err)
+	})
+}
+
+func TestBalancePrioritiesByZone(t *testing.T) {
+	newBuilder := func(members int) *Builder {
+		return newTestBuilder("4.4.0").
+			SetMembers(members).
+			BalancePrioritiesByZone()
+	}
+	priorities := func(ac AutomationConfig) []int {
+		var priorities []int
+		for _, m := range ac.ReplicaSets[0].Members {
+			priorities = append(priorities, m.Priority)
+		}
+		return priorities
+	}
+
+	t.Run("Each zone has one high priority member", func(t *testing.T) {
+		ac, err := newBuilder(5).
+			SetZoneForMember(0, "us-east-1a").
+			SetZoneForMember(1, "us-east-1a").
+			SetZoneForMember(2, "us-east-1b").
+			SetZoneForMember(3, "us-east-1b").
+			SetZoneForMember(4, "us-east-1c").
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []int{2, 1, 2, 1, 2}, priorities(ac))
+	})
+
+	t.Run("Non-electable members and explicit priorities are kept", func(t *testing.T) {
+		zero, three := 0, 3
+		ac, err := newBuilder(0).
+			SetMembersSpec([]MemberSpec{
+				{Priority: &zero, Tags: map[string]string{"zone": "us-east-1a"}},
+				{Tags: map[string]string{"zone": "us-east-1a"}},
+				{Priority: &three, Tags: map[string]string{"zone": "us-east-1b"}},
+				{Tags: map[string]string{"zone": "us-east-1b"}},
+				{},
+			}).
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []int{0, 2, 3, 1, 1}, priorities(ac))
+	})
+
+	t.Run("Requires members with a zone", func(t *testing.T) {
+		_, err := newBuilder(3).Build()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,10 @@
+// Package testdefaults holds the defaults of the replica sets built in tests. It is shared by the tests of the
+// automationconfig package, which can't import testutil as it imports automationconfig, and by testutil.
+package testdefaults
+
+const (
+	ReplicaSetName = "my-rs"
+	Domain         = "my-ns.svc.cluster.local"
+	MongoDBVersion = "4.4.0"
+	Members        = 3
+)
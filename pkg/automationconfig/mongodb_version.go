@@ -0,0 +1,101 @@
+package automationconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseMajorMinor returns the major and minor components of a MongoDB version
+// such as "4.2.6" or "4.4.0-ent". ok is false if the version can't be parsed.
+func parseMajorMinor(version string) (major, minor int, ok bool) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(strings.SplitN(parts[1], "-", 2)[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// isVersionAtLeast returns true if the given version is greater than or equal to major.minor.
+// Versions which can't be parsed are assumed to be recent.
+func isVersionAtLeast(version string, major, minor int) bool {
+	actualMajor, actualMinor, ok := parseMajorMinor(version)
+	if !ok {
+		return true
+	}
+	if actualMajor != major {
+		return actualMajor > major
+	}
+	return actualMinor >= minor
+}
+
+// isPatchVersionAtLeast returns true if the given version is greater than or equal to major.minor.patch.
+// A missing patch component is treated as 0, and versions which can't be parsed are assumed to be recent.
+func isPatchVersionAtLeast(version string, major, minor, patch int) bool {
+	actualMajor, actualMinor, ok := parseMajorMinor(version)
+	if !ok {
+		return true
+	}
+	if actualMajor != major || actualMinor != minor {
+		return isVersionAtLeast(version, major, minor)
+	}
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 3 {
+		return patch == 0
+	}
+	actualPatch, err := strconv.Atoi(strings.SplitN(parts[2], "-", 2)[0])
+	if err != nil {
+		return true
+	}
+	return actualPatch >= patch
+}
+
+// usesTLSNamespace returns true if the given version configures TLS through net.tls.
+// MongoDB 4.2 renamed the net.ssl options to net.tls.
+func usesTLSNamespace(version string) bool {
+	return isVersionAtLeast(version, 4, 2)
+}
+
+// usesSecondaryDelaySecs returns true if the given version configures delayed members
+// through secondaryDelaySecs. MongoDB 5.0 renamed slaveDelay to secondaryDelaySecs.
+func usesSecondaryDelaySecs(version string) bool {
+	return isVersionAtLeast(version, 5, 0)
+}
+
+// majorMinorOf returns the "major.minor" form of the version, as used by the feature compatibility version.
+func majorMinorOf(version string) (string, bool) {
+	major, minor, ok := parseMajorMinor(version)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d.%d", major, minor), true
+}
+
+// versionLess orders MongoDB versions such as "4.4.10" and "4.4.10-ent" by their numeric components, so that
+// "4.4.9" comes before "4.4.10". Components which aren't numbers are compared as strings.
+func versionLess(a, b string) bool {
+	split := func(version string) []string {
+		return strings.FieldsFunc(version, func(r rune) bool { return r == '.' || r == '-' })
+	}
+	aParts, bParts := split(a), split(b)
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		if aParts[i] == bParts[i] {
+			continue
+		}
+		aNumber, aErr := strconv.Atoi(aParts[i])
+		bNumber, bErr := strconv.Atoi(bParts[i])
+		if aErr == nil && bErr == nil {
+			return aNumber < bNumber
+		}
+		return aParts[i] < bParts[i]
+	}
+	return len(aParts) < len(bParts)
+}
@@ -0,0 +1,73 @@
+package automationconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMajorMinor(t *testing.T) {
+	major, minor, ok := parseMajorMinor("4.2.6")
+	assert.True(t, ok)
+	assert.Equal(t, 4, major)
+	assert.Equal(t, 2, minor)
+
+	major, minor, ok = parseMajorMinor("4.4-ent")
+	assert.True(t, ok)
+	assert.Equal(t, 4, major)
+	assert.Equal(t, 4, minor)
+
+	_, _, ok = parseMajorMinor("")
+	assert.False(t, ok)
+
+	_, _, ok = parseMajorMinor("latest")
+	assert.False(t, ok)
+}
+
+func TestIsVersionAtLeast(t *testing.T) {
+	assert.True(t, isVersionAtLeast("4.2.0", 4, 2))
+	assert.True(t, isVersionAtLeast("4.4.1", 4, 2))
+	assert.True(t, isVersionAtLeast("5.0.0", 4, 4))
+	assert.False(t, isVersionAtLeast("4.0.18", 4, 2))
+	assert.False(t, isVersionAtLeast("3.6.0", 4, 0))
+	assert.True(t, isVersionAtLeast("", 4, 2), "unparsable versions are assumed to be recent")
+}
+
+func TestIsPatchVersionAtLeast(t *testing.T) {
+	assert.True(t, isPatchVersionAtLeast("4.4.2", 4, 4, 2))
+	assert.True(t, isPatchVersionAtLeast("4.4.10-ent", 4, 4, 2))
+	assert.True(t, isPatchVersionAtLeast("5.0.0", 4, 4, 2))
+	assert.False(t, isPatchVersionAtLeast("4.4.1", 4, 4, 2))
+	assert.False(t, isPatchVersionAtLeast("4.2.12", 4, 4, 2))
+	assert.False(t, isPatchVersionAtLeast("4.4", 4, 4, 2))
+	assert.True(t, isPatchVersionAtLeast("", 4, 4, 2), "unparsable versions are assumed to be recent")
+}
+
+func TestUsesTLSNamespace(t *testing.T) {
+	assert.False(t, usesTLSNamespace("4.0.18"))
+	assert.True(t, usesTLSNamespace("4.2.0"))
+	assert.True(t, usesTLSNamespace("4.4.0"))
+}
+
+func TestUsesSecondaryDelaySecs(t *testing.T) {
+	assert.False(t, usesSecondaryDelaySecs("4.4.0"))
+	assert.True(t, usesSecondaryDelaySecs("5.0.0"))
+	assert.True(t, usesSecondaryDelaySecs("6.0.0"))
+}
+
+func TestMajorMinorOf(t *testing.T) {
+	fcv, ok := majorMinorOf("4.2.6")
+	assert.True(t, ok)
+	assert.Equal(t, "4.2", fcv)
+
+	_, ok = majorMinorOf("")
+	assert.False(t, ok)
+}
+
+func TestVersionLess(t *testing.T) {
+	assert.True(t, versionLess("4.4.9", "4.4.10"))
+	assert.True(t, versionLess("4.2.10", "4.4.0"))
+	assert.True(t, versionLess("4.4.0", "4.4.0-ent"))
+	assert.False(t, versionLess("4.4.0", "4.4.0"))
+	assert.False(t, versionLess("5.0.0", "4.4.0"))
+}
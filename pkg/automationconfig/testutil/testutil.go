@@ -0,0 +1,88 @@
+package testutil
+
+import (
+	"strings"
+
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig"
+	"github.com/mongodb/mongodb-kubernetes-operator/pkg/automationconfig/internal/testdefaults"
+	"github.com/pkg/errors"
+)
+
+const (
+	// the defaults are shared with the tests of the automationconfig package
+	ReplicaSetName = testdefaults.ReplicaSetName
+	Domain         = testdefaults.Domain
+	MongoDBVersion = testdefaults.MongoDBVersion
+	Members        = testdefaults.Members
+
+	// maxMembers and maxVotingMembers are the limits of the members of a MongoDB replica set
+	maxMembers       = 50
+	maxVotingMembers = 7
+)
+
+// NoOpAuthEnabler leaves authentication disabled.
+type NoOpAuthEnabler struct{}
+
+func (NoOpAuthEnabler) EnableAuth(auth automationconfig.Auth) automationconfig.Auth {
+	return auth
+}
+
+// NewTestBuilder returns a Builder for a 3 member replica set, with a MongoDB version and authentication
+// disabled, so that Build can be called right away. Tests only need to configure what they are testing.
+func NewTestBuilder() *automationconfig.Builder {
+	return automationconfig.NewBuilder().
+		SetName(ReplicaSetName).
+		SetDomain(Domain).
+		SetTopology(automationconfig.ReplicaSetTopology).
+		SetMembers(Members).
+		SetMongoDBVersion(MongoDBVersion).
+		SetFCV("4.4").
+		AddVersion(MongoDBVersionConfig(MongoDBVersion)).
+		SetAuthEnabler(NoOpAuthEnabler{})
+}
+
+// BuildLoadTestConfig builds the config of a replica set with the given number of members, e.g. for load tests.
+// Authentication is disabled and the version has a single dummy build, so it is meant for testing only. As
+// MongoDB allows at most 7 voting members, the members after the 7th are non-voting. None of the optional
+// validations, such as the checks of the TLS files, are enabled.
+func BuildLoadTestConfig(name string, members int, version string) (automationconfig.AutomationConfig, error) {
+	if members < 1 || members > maxMembers {
+		return automationconfig.AutomationConfig{}, errors.Errorf("a replica set has between 1 and %d members, but got %d", maxMembers, members)
+	}
+	zero := 0
+	specs := make([]automationconfig.MemberSpec, members)
+	for i := maxVotingMembers; i < members; i++ {
+		specs[i] = automationconfig.MemberSpec{Votes: &zero, Priority: &zero}
+	}
+
+	builder := automationconfig.NewBuilder().
+		SetName(name).
+		SetDomain(name + ".svc.cluster.local").
+		SetTopology(automationconfig.ReplicaSetTopology).
+		SetMembersSpec(specs).
+		SetMongoDBVersion(version).
+		AddVersion(MongoDBVersionConfig(version)).
+		SetAuthEnabler(NoOpAuthEnabler{})
+	if parts := strings.SplitN(version, ".", 3); len(parts) >= 2 {
+		builder.SetFCV(parts[0] + "." + parts[1])
+	}
+	return builder.Build()
+}
+
+// MongoDBVersionConfig returns a version with a single dummy linux build.
+func MongoDBVersionConfig(version string) automationconfig.MongoDbVersionConfig {
+	return automationconfig.MongoDbVersionConfig{
+		Name: version,
+		Builds: []automationconfig.BuildConfig{
+			{
+				Architecture: "amd64",
+				GitVersion:   "some-git-version",
+				Platform:     "linux",
+				Url:          "some-url",
+				Flavor:       "rhel",
+				MaxOsVersion: "8.0",
+				MinOsVersion: "7.0",
+			},
+		},
+	}
+}
@@ -0,0 +1,45 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTestBuilder(t *testing.T) {
+	ac, err := NewTestBuilder().Build()
+	assert.NoError(t, err)
+	assert.Len(t, ac.Processes, Members)
+	assert.Len(t, ac.Versions, 1)
+	assert.Equal(t, ReplicaSetName, ac.ReplicaSets[0].Id)
+	assert.True(t, ac.Auth.Disabled)
+	assert.Equal(t, "/var/lib/mongodb-mms-automation", ac.Options.DownloadBase)
+
+	other, err := NewTestBuilder().Build()
+	assert.NoError(t, err)
+	assert.Equal(t, ac, other, "every builder should be independent and identical")
+}
+
+func TestBuildLoadTestConfig(t *testing.T) {
+	ac, err := BuildLoadTestConfig("load-test", 50, "4.4.0")
+	assert.NoError(t, err)
+	assert.Len(t, ac.Processes, 50)
+	assert.Len(t, ac.ReplicaSets[0].Members, 50)
+	assert.True(t, ac.Auth.Disabled)
+	assert.Equal(t, "4.4.0", ac.Processes[49].Version)
+	assert.Equal(t, "4.4", ac.Processes[49].FeatureCompatibilityVersion)
+
+	voting := 0
+	for _, m := range ac.ReplicaSets[0].Members {
+		if m.Votes > 0 {
+			voting++
+		}
+	}
+	assert.Equal(t, 7, voting)
+
+	_, err = BuildLoadTestConfig("load-test", 0, "4.4.0")
+	assert.Error(t, err)
+
+	_, err = BuildLoadTestConfig("load-test", 51, "4.4.0")
+	assert.Error(t, err)
+}
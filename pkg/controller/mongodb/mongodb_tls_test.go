@@ -166,6 +166,23 @@ func TestAutomationConfig_IsCorrectlyConfiguredWithTLS(t *testing.T) {
 			assert.True(t, process.Args26.Get("net.tls.allowConnectionsWithoutCertificates").MustBool())
 		}
 	})
+
+	t.Run("With TLS disabled after it was enabled", func(t *testing.T) {
+		mdb := newTestReplicaSetWithTLS()
+		mdb.Annotations[tlsRolledOutAnnotationKey] = "true"
+		previous := createAC(mdb)
+
+		mdb.Spec.Security.TLS.Enabled = false
+		manifest, err := mockManifestProvider(mdb.Spec.Version)()
+		assert.NoError(t, err)
+		ac, err := buildAutomationConfig(mdb, manifest.BuildsForVersion(mdb.Spec.Version), previous, automationconfig.NOOP())
+		assert.NoError(t, err, "the resource disabling TLS should allow it")
+		assert.Equal(t, previous.Version+1, ac.Version)
+
+		for _, process := range ac.Processes {
+			assert.False(t, process.Args26.Has("net.tls"))
+		}
+	})
 }
 
 func TestTLSOperatorSecret(t *testing.T) {
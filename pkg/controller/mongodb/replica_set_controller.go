@@ -472,6 +472,8 @@ func buildAutomationConfig(mdb mdbv1.MongoDB, mdbVersionConfig automationconfig.
 		SetPreviousAutomationConfig(currentAc).
 		SetMongoDBVersion(mdb.Spec.Version).
 		SetFCV(mdb.GetFCV()).
+		// TLS is only disabled on a running deployment when the resource disables it
+		SetAllowTLSDisable(!mdb.Spec.Security.TLS.Enabled).
 		AddVersion(mdbVersionConfig).
 		AddModifications(getMongodConfigModification(mdb)).
 		AddModifications(modifications...)